@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/btassone/alpine-hero/internal/ansible"
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/generator"
+	"github.com/spf13/cobra"
+)
+
+func newAnsibleCmd() *cobra.Command {
+	var (
+		output, inventoryFile, group string
+		vault, force, backup         bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "ansible",
+		Short: "Export an Ansible inventory and host_vars for the installed hosts",
+		Long: `Export an Ansible YAML inventory and one host_vars file per host, so
+playbooks run after the install use the same hostnames, addresses and users
+that went into the answer files:
+
+  inventory.yml           every host in the group given by --group
+  host_vars/<host>.yml    ansible_host, ansible_user and ansible_become_method,
+                          and the settings as alpine_hero_* variables
+
+The hosts are the configuration given by --config and the flags, or every host
+of --inventory, with the addresses from its network block allocated and
+recorded in the lock file as generate does.
+
+Passwords are never written. With --vault they are exported as references to
+vault_alpine_hero_password, to be defined in an ansible-vault encrypted file.
+
+The files are written to the directory ansible unless --output is given.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hosts, saveLock, err := loadHosts(inventoryFile)
+			if err != nil {
+				return err
+			}
+			configs := make([]*config.Config, len(hosts))
+			for i, h := range hosts {
+				configs[i] = h.Config
+			}
+
+			files, err := ansible.Files(configs, ansible.Options{Group: group, Vault: vault})
+			if err != nil {
+				return err
+			}
+			for _, f := range files {
+				err := generator.New(cfg, filepath.Join(output, filepath.FromSlash(f.Path)),
+					generator.WithStreams(cmd.OutOrStdout(), cmd.ErrOrStderr()),
+					generator.WithOutputPolicy(outputPolicy),
+					generator.WithForce(force),
+					generator.WithBackup(backup),
+					generator.WithCreateDirs(true),
+				).WriteFile(f.Data)
+				if err != nil {
+					return err
+				}
+			}
+			return saveLock()
+		},
+	}
+
+	addConfigFlags(cmd)
+	cmd.Flags().StringVarP(&output, "output", "o", "ansible", "Directory to write the inventory and host_vars to")
+	cmd.Flags().StringVar(&inventoryFile, "inventory", "", "Export every host of an inventory file")
+	cmd.Flags().StringVar(&group, "group", ansible.DefaultGroup, "Inventory group of the hosts")
+	cmd.Flags().BoolVar(&vault, "vault", false, "Reference passwords as vault_ variables instead of leaving them out")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite existing files")
+	cmd.Flags().BoolVar(&backup, "backup", false, "Keep a timestamped backup of every overwritten file")
+
+	return cmd
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnsibleCommand(t *testing.T) {
+	tmpDir, stderr := setupCommand(t)
+
+	out := filepath.Join(tmpDir, "single")
+	rootCmd.SetArgs([]string{"ansible", "-o", out, "--hostname", "pi-kitchen", "--password", "s3cret", "--vault"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("ansible error = %v\n%s", err, stderr.String())
+	}
+	data, err := os.ReadFile(filepath.Join(out, "host_vars", "pi-kitchen.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cret") || !strings.Contains(string(data), "alpine_hero_password: '{{ vault_alpine_hero_password }}'") {
+		t.Errorf("host_vars =\n%s\nwant the password as a vault reference", data)
+	}
+	if data, err := os.ReadFile(filepath.Join(out, "inventory.yml")); err != nil || !strings.Contains(string(data), "pi-kitchen: {}") {
+		t.Errorf("inventory = %q, %v", data, err)
+	}
+
+	// a second run needs --force
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"ansible", "-o", out, "--hostname", "pi-kitchen"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("ansible error = %v, want an overwrite error", err)
+	}
+}
+
+func TestAnsibleCommand_Inventory(t *testing.T) {
+	tmpDir, stderr := setupCommand(t)
+
+	hosts := filepath.Join(tmpDir, "hosts.yaml")
+	content := `network:
+  subnet: 10.20.0.0/24
+  start: .50
+  gateway: .1
+  dns: [10.20.0.1]
+hosts:
+  - hostname: pi-kitchen
+  - hostname: pi-office
+`
+	if err := os.WriteFile(hosts, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(tmpDir, "ansible")
+	rootCmd.SetArgs([]string{"ansible", "--inventory", hosts, "-o", out, "--group", "pis"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("ansible --inventory error = %v\n%s", err, stderr.String())
+	}
+	data, err := os.ReadFile(filepath.Join(out, "inventory.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "    pis:\n      hosts:\n        pi-kitchen: {}\n        pi-office: {}\n") {
+		t.Errorf("inventory =\n%s", data)
+	}
+	data, err = os.ReadFile(filepath.Join(out, "host_vars", "pi-office.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"ansible_host: 10.20.0.51\n", "alpine_hero_gateway: 10.20.0.1\n", "alpine_hero_network: static\n"} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("host_vars of pi-office missing %q\n%s", s, data)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(tmpDir, "hosts.lock")); err != nil || !strings.Contains(string(data), "pi-office: 10.20.0.51") {
+		t.Errorf("lock file = %q, %v, want the allocations recorded", data, err)
+	}
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/btassone/alpine-hero/internal/apkovl"
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/generator"
+	"github.com/spf13/cobra"
+)
+
+func newApkovlCmd() *cobra.Command {
+	var (
+		output        string
+		force, backup bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "apkovl",
+		Short: "Build an overlay that installs Alpine unattended on first boot",
+		Long: `Build an Alpine local backup overlay (apkovl) for a fully headless install.
+Copy it to the root of the boot media next to the Alpine files, and on first
+boot it brings up the network, runs setup-alpine with the answer file and
+reboots into the installed system. The disk is erased without asking, and
+again on every boot from the media while the overlay is on it.
+
+The overlay contains the answer file, an OpenRC local.d start script that runs
+setup-alpine once, the network configuration and hostname for the first boot,
+and root's authorized keys when --ssh-key is set, so the install can be
+followed over ssh. The log of the install is kept in
+/var/log/alpine-hero-setup.log.
+
+The configuration is taken from --config and the same flags as generate. The
+overlay is written to <hostname>.apkovl.tar.gz unless --output is given.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+
+			answers, err := renderAnswers(cfg)
+			if err != nil {
+				return err
+			}
+			overlay, err := buildOverlay(cfg, answers)
+			if err != nil {
+				return err
+			}
+
+			path := output
+			if path == "" {
+				path = cfg.Hostname + ".apkovl.tar.gz"
+			}
+			return generator.New(cfg, path,
+				generator.WithStreams(cmd.OutOrStdout(), cmd.ErrOrStderr()),
+				generator.WithOutputPolicy(outputPolicy),
+				generator.WithForce(force),
+				generator.WithBackup(backup),
+			).WriteFile(overlay)
+		},
+	}
+
+	addConfigFlags(cmd)
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file path, or - for standard output (default: <hostname>.apkovl.tar.gz)")
+	cmd.Flags().StringVar(&templateFile, "template", "", "Template file to use instead of the built-in one")
+	cmd.Flags().StringVar(&partialsDir, "partials", "", "Directory of *.tmpl partials available to the template")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite an existing output file")
+	cmd.Flags().BoolVar(&backup, "backup", false, "Keep a timestamped backup of an overwritten output file")
+
+	return cmd
+}
+
+// renderAnswers renders the answer file for c with the template selected
+// by --template and --partials
+func renderAnswers(c *config.Config) ([]byte, error) {
+	var buf bytes.Buffer
+	err := generator.New(c, "", generator.WithTemplate(templateFile), generator.WithPartials(partialsDir)).Render(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// buildOverlay returns the apkovl tarball for c around answers
+func buildOverlay(c *config.Config, answers []byte) ([]byte, error) {
+	files, err := apkovl.Files(c, answers)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := apkovl.Write(&buf, files, time.Now()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/apkovl"
+)
+
+func TestApkovlCommand(t *testing.T) {
+	tmpDir, stderr := setupCommand(t)
+
+	rootCmd.SetArgs([]string{"apkovl", "--hostname", "pi-kitchen", "--password", "s3cret"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("apkovl error = %v\n%s", err, stderr.String())
+	}
+
+	f, err := os.Open(filepath.Join(tmpDir, "pi-kitchen.apkovl.tar.gz"))
+	if err != nil {
+		t.Fatalf("overlay not written to <hostname>.apkovl.tar.gz: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var answers string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Name == apkovl.AnswersPath {
+			data, _ := io.ReadAll(tr)
+			answers = string(data)
+		}
+	}
+	for _, want := range []string{`HOSTNAMEOPTS="-n pi-kitchen"`, `PWUSER="s3cret"`} {
+		if !strings.Contains(answers, want) {
+			t.Errorf("answer file in the overlay missing %q\n%s", want, answers)
+		}
+	}
+
+	// the overlay is protected like an answer file
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"apkovl", "--hostname", "pi-kitchen"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("apkovl error = %v, want the existing overlay protected", err)
+	}
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"apkovl", "--hostname", "pi_kitchen"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "invalid hostname") {
+		t.Errorf("apkovl error = %v, want the configuration validated", err)
+	}
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/btassone/alpine-hero/internal/cloudinit"
+	"github.com/btassone/alpine-hero/internal/fatimg"
+	"github.com/btassone/alpine-hero/internal/generator"
+	"github.com/spf13/cobra"
+)
+
+func newCloudInitCmd() *cobra.Command {
+	var (
+		output        string
+		image         bool
+		force, backup bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "cloud-init",
+		Short: "Generate a cloud-init NoCloud seed for Alpine cloud images",
+		Long: `Generate a NoCloud seed for Alpine cloud images that use cloud-init or
+tiny-cloud instead of setup-alpine, from the same configuration as the
+answer file:
+
+  meta-data       instance-id and local-hostname
+  user-data       hostname, timezone, keyboard, the user with its hashed
+                  password, SSH keys and doas access, packages and NTP
+  network-config  network config version 2 for the interface
+
+Settings without a cloud-init equivalent, such as the install disk, are
+reported on standard error and left out.
+
+The seed is written to the directory <hostname>-cidata unless --output is
+given. With --image it is written to a FAT32 image labelled CIDATA instead,
+<hostname>-cidata.img by default, to attach to a VM as a disk.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+
+			seed, err := cloudinit.Render(cfg)
+			if err != nil {
+				return err
+			}
+			for _, name := range seed.Unmapped {
+				cmd.PrintErrf("warning: %s has no cloud-init equivalent and is not part of the seed\n", name)
+			}
+
+			path := output
+			if path == "" {
+				path = cfg.Hostname + "-cidata"
+				if image {
+					path += ".img"
+				}
+			}
+			opts := []generator.Option{
+				generator.WithStreams(cmd.OutOrStdout(), cmd.ErrOrStderr()),
+				generator.WithOutputPolicy(outputPolicy),
+				generator.WithForce(force),
+				generator.WithBackup(backup),
+			}
+
+			if image {
+				var files []fatimg.File
+				for _, f := range seed.Files() {
+					files = append(files, fatimg.File{Path: f.Name, Data: f.Data})
+				}
+				imgOpts := fatimg.Options{Label: cloudinit.Label, ModTime: time.Now()}
+				return generator.New(cfg, path, opts...).WriteWith(func(f *os.File) error {
+					return fatimg.Write(f, files, imgOpts)
+				})
+			}
+
+			opts = append(opts, generator.WithCreateDirs(true))
+			for _, f := range seed.Files() {
+				if err := generator.New(cfg, filepath.Join(path, f.Name), opts...).WriteFile(f.Data); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	addConfigFlags(cmd)
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Seed directory, or image file with --image (default: <hostname>-cidata)")
+	cmd.Flags().BoolVar(&image, "image", false, "Write a FAT32 image labelled CIDATA instead of a directory")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite existing seed files")
+	cmd.Flags().BoolVar(&backup, "backup", false, "Keep a timestamped backup of every overwritten file")
+
+	return cmd
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/fatimg"
+)
+
+func TestCloudInitCommand(t *testing.T) {
+	tmpDir, stderr := setupCommand(t)
+
+	seedDir := filepath.Join(tmpDir, "seed")
+	rootCmd.SetArgs([]string{"cloud-init", "-o", seedDir, "--hostname", "vm-build", "--address", "10.20.0.50/24", "--dns", "10.20.0.1"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("cloud-init error = %v\n%s", err, stderr.String())
+	}
+	for name, want := range map[string]string{
+		"meta-data":      "local-hostname: vm-build",
+		"user-data":      "#cloud-config",
+		"network-config": "- 10.20.0.50/24",
+	} {
+		data, err := os.ReadFile(filepath.Join(seedDir, name))
+		if err != nil {
+			t.Fatalf("%s not written: %v", name, err)
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s missing %q:\n%s", name, want, data)
+		}
+	}
+	if !strings.Contains(stderr.String(), "warning: disk has no cloud-init equivalent") {
+		t.Errorf("stderr = %q, want the install disk reported", stderr.String())
+	}
+
+	resetFlags(t)
+	imgPath := filepath.Join(tmpDir, "seed.img")
+	rootCmd.SetArgs([]string{"cloud-init", "--image", "-o", imgPath, "--hostname", "vm-build"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("cloud-init --image error = %v\n%s", err, stderr.String())
+	}
+	f, err := os.Open(imgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	img, err := fatimg.Read(f)
+	if err != nil {
+		t.Fatalf("image is not FAT32: %v", err)
+	}
+	var names []string
+	for _, f := range img.Files {
+		names = append(names, f.Path)
+	}
+	if img.Label != "CIDATA" || strings.Join(names, " ") != "meta-data network-config user-data" {
+		t.Errorf("image label = %q, files = %v", img.Label, names)
+	}
+
+	// the seed is protected like an answer file
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"cloud-init", "-o", seedDir})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("cloud-init error = %v, want the existing seed protected", err)
+	}
+}
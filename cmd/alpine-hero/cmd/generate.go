@@ -1,32 +1,178 @@
 package cmd
 
 import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
 	"github.com/btassone/alpine-hero/internal/generator"
 	"github.com/spf13/cobra"
 )
 
 func newGenerateCmd() *cobra.Command {
+	var (
+		force, backup, diff, dryRun bool
+		inventoryFile, bundleDir    string
+		formatNames                 []string
+		jobs                        int
+	)
+
 	cmd := &cobra.Command{
 		Use:   "generate",
 		Short: "Generate the answers file",
-		Long:  `Generate an answers file based on the provided configuration or default values.`,
+		Long: `Generate an answers file based on the provided configuration or default values.
+
+Use --output - to write the answer file to standard output, for example to
+pipe it to another host with ssh. Status messages are written to standard
+error.
+
+The answer file is written to a temporary file and renamed into place, so an
+existing file is never left half written. An existing file is only replaced
+with --force, and --backup keeps a timestamped copy of it. --diff shows what
+would change without writing anything.
+
+--dry-run runs every check a real run does and exits the same way, but prints
+the answer file to standard output with passwords and other secrets masked
+instead of writing it, so it can be shared for review.
+
+With --inventory one answer file is generated per host of an inventory file.
+Each host starts from the configuration given by --config and the flags, then
+the inventory defaults and its own settings are applied. Answer files are
+written to the path pattern from the inventory's output key or --output, with
+missing directories created. All invalid hosts are reported before anything
+is written, and a summary table is printed at the end. Hosts are generated in
+parallel, --jobs at a time, and the summary lists them in inventory order.
+Interrupting the command lets running hosts finish and skips the rest.
+
+Inventory entries can stand for several hosts with count, and hostnames can be
+patterns such as edge-{{seq 3}} or rack{{.Rack}}-node{{.Index}}.
+
+An inventory with a network block gives every host without an address one
+from its pool and records it in a lock file next to the inventory, so hosts
+keep their address on later runs. --dry-run and --diff do not update the lock
+file.
+
+--format selects other output formats: ` + formatList() + `.
+A format other than answers is written to its own file name unless --output
+is given. --bundle DIR writes every --format into DIR in one run, each under
+its own file name.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			gen := generator.New(cfg, outputFile)
-			return gen.Generate()
+			opts := []generator.Option{
+				generator.WithTemplate(templateFile),
+				generator.WithPartials(partialsDir),
+				generator.WithStreams(cmd.OutOrStdout(), cmd.ErrOrStderr()),
+				generator.WithOutputPolicy(outputPolicy),
+				generator.WithForce(force),
+				generator.WithBackup(backup),
+				generator.WithDiff(diff),
+				generator.WithDryRun(dryRun),
+			}
+			var formats []generator.Format
+			seen := make(map[string]bool)
+			for _, name := range formatNames {
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				f, err := generator.LookupFormat(name)
+				if err != nil {
+					return err
+				}
+				formats = append(formats, f)
+			}
+			if len(formats) == 0 {
+				return fmt.Errorf("--format needs at least one format: %s", formatList())
+			}
+			if bundleDir != "" {
+				if inventoryFile != "" {
+					return fmt.Errorf("--bundle cannot be used with --inventory")
+				}
+				return generateBundle(bundleDir, formats, opts)
+			}
+			if len(formats) > 1 {
+				return fmt.Errorf("%d formats given, use --bundle DIR to write several formats in one run", len(formats))
+			}
+
+			// the answer file is what the generator renders by default
+			output := outputFile
+			if f := formats[0]; f.Name != "answers" {
+				r, err := f.New(opts...)
+				if err != nil {
+					return err
+				}
+				opts = append(opts, generator.WithRenderer(r))
+				if !cmd.Flags().Changed("output") {
+					output = f.File
+				}
+			}
+
+			if inventoryFile != "" {
+				pattern := ""
+				if cmd.Flags().Changed("output") {
+					pattern = outputFile
+				}
+				return generateInventory(cmd, inventoryFile, pattern, jobs, !dryRun && !diff, opts)
+			}
+			return generator.New(cfg, output, opts...).Generate()
 		},
 	}
 
 	// Add flags specific to generate command
+	addConfigFlags(cmd)
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "answers.txt", "Output file path, or - for standard output")
+	cmd.Flags().StringVar(&templateFile, "template", "", "Template file to use instead of the built-in one")
+	cmd.Flags().StringVar(&partialsDir, "partials", "", "Directory of *.tmpl partials available to the template")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite an existing output file")
+	cmd.Flags().BoolVar(&backup, "backup", false, "Keep a timestamped backup of an overwritten output file")
+	cmd.Flags().BoolVar(&diff, "diff", false, "Show the changes to the output file without writing it")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the answer file with secrets masked instead of writing it")
+	cmd.Flags().StringVar(&inventoryFile, "inventory", "", "Generate one answer file per host of an inventory file")
+	cmd.Flags().IntVarP(&jobs, "jobs", "j", 0, "Number of hosts to generate in parallel with --inventory (default: number of CPUs)")
+	cmd.Flags().StringSliceVar(&formatNames, "format", []string{"answers"}, "Output formats (comma-separated): "+formatList())
+	cmd.Flags().StringVar(&bundleDir, "bundle", "", "Write every --format into this directory")
+	cmd.MarkFlagsMutuallyExclusive("diff", "dry-run")
+	cmd.MarkFlagsMutuallyExclusive("bundle", "output")
+
+	return cmd
+}
+
+// generateBundle writes the output of every format into dir under the file
+// name of the format
+func generateBundle(dir string, formats []generator.Format, opts []generator.Option) error {
+	for _, f := range formats {
+		r, err := f.New(opts...)
+		if err != nil {
+			return err
+		}
+		formatOpts := append(append([]generator.Option{}, opts...), generator.WithRenderer(r), generator.WithCreateDirs(true))
+		if err := generator.New(cfg, filepath.Join(dir, f.File), formatOpts...).Generate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatList returns the names of the registered formats for help texts
+func formatList() string {
+	var names []string
+	for _, f := range generator.Formats() {
+		names = append(names, f.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// addConfigFlags binds the flags for every configuration field to cfg
+func addConfigFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&cfg.Hostname, "hostname", "n", cfg.Hostname, "Hostname for the Alpine system")
 	cmd.Flags().StringVarP(&cfg.Username, "username", "u", cfg.Username, "Username for the main user")
 	cmd.Flags().StringVarP(&cfg.Password, "password", "p", cfg.Password, "Password for the main user")
 	cmd.Flags().StringVarP(&cfg.Timezone, "timezone", "t", cfg.Timezone, "Timezone for the system")
 	cmd.Flags().StringVarP(&cfg.Keymap, "keymap", "k", cfg.Keymap, "Keyboard layout")
 	cmd.Flags().StringVarP(&cfg.NetworkIface, "interface", "i", cfg.NetworkIface, "Network interface to configure")
+	cmd.Flags().StringVar(&cfg.Address, "address", cfg.Address, "Static address of the interface in CIDR notation (default: DHCP)")
+	cmd.Flags().StringVar(&cfg.Gateway, "gateway", cfg.Gateway, "Default gateway for a static address")
+	cmd.Flags().StringSliceVar(&cfg.DNS, "dns", cfg.DNS, "Nameservers, required with a static address (comma-separated)")
 	cmd.Flags().StringVarP(&cfg.DiskDevice, "disk", "d", cfg.DiskDevice, "Disk device for installation")
 	cmd.Flags().StringSliceVar(&cfg.Groups, "groups", cfg.Groups, "User groups (comma-separated)")
 	cmd.Flags().StringVar(&cfg.SSHKey, "ssh-key", "", "Path to SSH public key file")
-	cmd.Flags().StringVarP(&outputFile, "output", "o", "answers.txt", "Output file path")
-
-	return cmd
 }
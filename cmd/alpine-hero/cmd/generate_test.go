@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -112,7 +113,7 @@ HOSTNAMEOPTS="-n {{ .Hostname }}"
 
 			// Prepare command arguments
 			args := append([]string{"generate"}, tt.args...)
-			args = append(args, "--output", tmpFile.Name())
+			args = append(args, "--force", "--output", tmpFile.Name())
 			rootCmd.SetArgs(args)
 
 			// Execute command
@@ -139,3 +140,176 @@ HOSTNAMEOPTS="-n {{ .Hostname }}"
 		})
 	}
 }
+
+func TestGenerateCommand_Stdout(t *testing.T) {
+	resetFlags(t)
+	var stdout, stderr bytes.Buffer
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&stderr)
+	defer func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		outputFile = "answers.txt"
+		resetFlags(t)
+	}()
+
+	rootCmd.SetArgs([]string{"generate", "--hostname", "piped-host", "-o", "-"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	if !strings.Contains(stdout.String(), `HOSTNAMEOPTS="-n piped-host"`) {
+		t.Errorf("stdout = %q, want the answer file", stdout.String())
+	}
+	if strings.Contains(stdout.String(), "Successfully") {
+		t.Errorf("stdout contains a status message: %q", stdout.String())
+	}
+	if _, err := os.Stat("-"); !os.IsNotExist(err) {
+		t.Error(`generate -o - created a file named "-"`)
+	}
+}
+
+func TestGenerateCommand_Overwrite(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "answers.txt")
+	resetFlags(t)
+	var stdout bytes.Buffer
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(io.Discard)
+	defer func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		outputFile = "answers.txt"
+		resetFlags(t)
+	}()
+
+	rootCmd.SetArgs([]string{"generate", "-o", output})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"generate", "--hostname", "second", "-o", output})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "use --force") {
+		t.Errorf("generate error = %v, want refusal to overwrite", err)
+	}
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"generate", "--hostname", "second", "--diff", "-o", output})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate --diff error = %v", err)
+	}
+	if !strings.Contains(stdout.String(), `+HOSTNAMEOPTS="-n second"`) {
+		t.Errorf("generate --diff output = %q, want the changed hostname", stdout.String())
+	}
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"generate", "--hostname", "second", "--force", "--backup", "-o", output})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate --force error = %v", err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `HOSTNAMEOPTS="-n second"`) {
+		t.Errorf("generate --force did not overwrite the answer file")
+	}
+	backups, err := filepath.Glob(output + ".*.bak")
+	if err != nil || len(backups) != 1 {
+		t.Errorf("backups = %v, %v, want exactly one", backups, err)
+	}
+}
+
+func TestGenerateCommand_DryRun(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "answers.txt")
+	resetFlags(t)
+	var stdout, stderr bytes.Buffer
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&stderr)
+	defer func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		resetFlags(t)
+	}()
+
+	rootCmd.SetArgs([]string{"generate", "--password", "top-secret", "--dry-run", "-o", output})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate --dry-run error = %v", err)
+	}
+	if !strings.Contains(stdout.String(), `PWUSER="********"`) {
+		t.Errorf("stdout = %q, want the masked password", stdout.String())
+	}
+	if strings.Contains(stdout.String()+stderr.String(), "top-secret") {
+		t.Error("generate --dry-run printed the password")
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Error("generate --dry-run wrote the answer file")
+	}
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"generate", "--dry-run", "--diff", "-o", output})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("generate --dry-run --diff error = nil, want the flags to be exclusive")
+	}
+}
+
+func TestGenerateCommand_Formats(t *testing.T) {
+	tmpDir := t.TempDir()
+	resetFlags(t)
+	var stdout, stderr bytes.Buffer
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&stderr)
+	defer func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		outputFile = "answers.txt"
+		resetFlags(t)
+	}()
+
+	rootCmd.SetArgs([]string{"generate", "--format", "json", "--hostname", "json-host", "-o", "-"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate --format json error = %v", err)
+	}
+	if !strings.Contains(stdout.String(), `"hostname": "json-host"`) {
+		t.Errorf("stdout = %q, want the JSON settings", stdout.String())
+	}
+
+	bundle := filepath.Join(tmpDir, "bundle")
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"generate", "--format", "answers,json,env", "--bundle", bundle, "--hostname", "bundled"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate --bundle error = %v\n%s", err, stderr.String())
+	}
+	for name, want := range map[string]string{
+		"answers.txt": `HOSTNAMEOPTS="-n bundled"`,
+		"config.json": `"hostname": "bundled"`,
+		"config.env":  "export ALPINE_HOSTNAME='bundled'",
+	} {
+		data, err := os.ReadFile(filepath.Join(bundle, name))
+		if err != nil {
+			t.Fatalf("%s not in the bundle: %v", name, err)
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s missing %q:\n%s", name, want, data)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "unknown format", args: []string{"--format", "yaml"}, wantErr: `unknown format "yaml"`},
+		{name: "several formats", args: []string{"--format", "json,env"}, wantErr: "use --bundle DIR"},
+		{name: "bundle with inventory", args: []string{"--bundle", bundle, "--inventory", "hosts.yaml"}, wantErr: "--bundle cannot be used with --inventory"},
+		{name: "existing bundle", args: []string{"--format", "env", "--bundle", bundle}, wantErr: "already exists"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags(t)
+			rootCmd.SetArgs(append([]string{"generate"}, tt.args...))
+			if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("generate error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/btassone/alpine-hero/internal/fatimg"
+	"github.com/btassone/alpine-hero/internal/generator"
+	"github.com/btassone/alpine-hero/internal/media"
+	"github.com/spf13/cobra"
+)
+
+func newImageCmd() *cobra.Command {
+	var (
+		output, label string
+		size          int64
+		extra         []string
+		withOverlay   bool
+		force, backup bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "image",
+		Short: "Build a FAT32 disk image with the answer file and overlay",
+		Long: `Build a small FAT32 disk image holding the install seed, for attaching to a VM
+as a second disk or writing to a USB stick with dd. The image contains:
+
+  answers.txt               the answer file
+  <hostname>.apkovl.tar.gz  the headless install overlay, unless --apkovl=false
+  extra files               every --add SRC[:DEST], DEST defaults to the file name
+
+The Alpine installer searches every disk for an overlay, so booting the Alpine
+media with the image attached installs the host unattended. --label sets the
+volume label for tools that find the seed by label.
+
+The image is built without mkfs.vfat or root access. It is the smallest FAT32
+file system that holds the files, about 33 MiB, unless --size is given.
+
+The configuration is taken from --config and the same flags as generate. The
+image is written to <hostname>.img unless --output is given.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+			if err := fatimg.ValidateLabel(label); err != nil {
+				return err
+			}
+
+			answers, err := renderAnswers(cfg)
+			if err != nil {
+				return err
+			}
+			files := []fatimg.File{{Path: media.Answers, Data: answers}}
+			if withOverlay {
+				overlay, err := buildOverlay(cfg, answers)
+				if err != nil {
+					return err
+				}
+				files = append(files, fatimg.File{Path: cfg.Hostname + ".apkovl.tar.gz", Data: overlay})
+			}
+			for _, spec := range extra {
+				f, err := readExtraFile(spec)
+				if err != nil {
+					return err
+				}
+				files = append(files, f)
+			}
+
+			opts := fatimg.Options{Label: label, Size: size << 20, ModTime: time.Now()}
+			path := output
+			if path == "" {
+				path = cfg.Hostname + ".img"
+			}
+			return generator.New(cfg, path,
+				generator.WithStreams(cmd.OutOrStdout(), cmd.ErrOrStderr()),
+				generator.WithOutputPolicy(outputPolicy),
+				generator.WithForce(force),
+				generator.WithBackup(backup),
+			).WriteWith(func(f *os.File) error { return fatimg.Write(f, files, opts) })
+		},
+	}
+
+	addConfigFlags(cmd)
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file path, or - for standard output (default: <hostname>.img)")
+	cmd.Flags().StringVar(&label, "label", fatimg.DefaultLabel, "Volume label of the image (up to 11 characters)")
+	cmd.Flags().Int64Var(&size, "size", 0, "Image size in MiB (default: the smallest that fits)")
+	cmd.Flags().StringArrayVar(&extra, "add", nil, "Extra file to add as SRC[:DEST] (repeatable)")
+	cmd.Flags().BoolVar(&withOverlay, "apkovl", true, "Add the headless install overlay")
+	cmd.Flags().StringVar(&templateFile, "template", "", "Template file to use instead of the built-in one")
+	cmd.Flags().StringVar(&partialsDir, "partials", "", "Directory of *.tmpl partials available to the template")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite an existing output file")
+	cmd.Flags().BoolVar(&backup, "backup", false, "Keep a timestamped backup of an overwritten output file")
+
+	return cmd
+}
+
+// readExtraFile reads the file of an --add SRC[:DEST] flag
+func readExtraFile(spec string) (fatimg.File, error) {
+	src, dest, ok := strings.Cut(spec, ":")
+	if !ok || dest == "" {
+		dest = filepath.Base(src)
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fatimg.File{}, fmt.Errorf("failed to read extra file: %w", err)
+	}
+	return fatimg.File{Path: strings.TrimPrefix(filepath.ToSlash(dest), "/"), Data: data}, nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/fatimg"
+)
+
+func TestImageCommand(t *testing.T) {
+	tmpDir, stderr := setupCommand(t)
+
+	script := filepath.Join(tmpDir, "setup.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	imgPath := filepath.Join(tmpDir, "seed.img")
+	rootCmd.SetArgs([]string{"image", "-o", imgPath, "--hostname", "vm-build", "--label", "SEED",
+		"--add", script, "--add", script + ":scripts/first-boot.sh"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("image error = %v\n%s", err, stderr.String())
+	}
+
+	f, err := os.Open(imgPath)
+	if err != nil {
+		t.Fatalf("image not written: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	img, err := fatimg.Read(f)
+	if err != nil {
+		t.Fatalf("image is not FAT32: %v", err)
+	}
+	if img.Label != "SEED" {
+		t.Errorf("label = %q, want SEED", img.Label)
+	}
+	got := make(map[string]string)
+	for _, f := range img.Files {
+		got[f.Path] = string(f.Data)
+	}
+	for _, name := range []string{"answers.txt", "vm-build.apkovl.tar.gz", "setup.sh", "scripts/first-boot.sh"} {
+		if _, ok := got[name]; !ok {
+			t.Errorf("image is missing %s, has %v", name, img.Files)
+		}
+	}
+	if !strings.Contains(got["answers.txt"], `HOSTNAMEOPTS="-n vm-build"`) {
+		t.Errorf("answers.txt =\n%s", got["answers.txt"])
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "existing image", args: []string{"-o", imgPath}, wantErr: "already exists"},
+		{name: "invalid label", args: []string{"-o", "-", "--label", "ALPINE/HERO"}, wantErr: "invalid volume label"},
+		{name: "missing extra file", args: []string{"-o", "-", "--add", filepath.Join(tmpDir, "missing")}, wantErr: "failed to read extra file"},
+		{name: "too small", args: []string{"-o", "-", "--size", "8"}, wantErr: "too small for FAT32"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags(t)
+			rootCmd.SetArgs(append([]string{"image"}, tt.args...))
+			if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("image error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/generator"
+	"github.com/btassone/alpine-hero/internal/parser"
+	"github.com/spf13/cobra"
+)
+
+func newImportCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "import ANSWERS",
+		Short: "Import an existing answer file into a config file",
+		Long: `Parse an existing setup-alpine answer file and write its settings as a YAML
+config file that can be passed to the other commands with --config.
+
+Settings that the configuration cannot represent are reported as warnings.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open answer file: %w", err)
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+
+			file, err := parser.Parse(f)
+			if err != nil {
+				return err
+			}
+			answers, err := file.Answers()
+			if err != nil {
+				return err
+			}
+			imported := answers.Config()
+
+			lost, err := unpreserved(file, imported)
+			if err != nil {
+				return err
+			}
+			for _, a := range lost {
+				cmd.PrintErrf("warning: %s on line %d is not preserved in the config file\n", a.Name, a.Line)
+			}
+
+			if err := imported.Save(output); err != nil {
+				return err
+			}
+			cmd.PrintErrf("Imported %s into %s\n", args[0], output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "alpine-hero.yaml", "Config file to write")
+
+	return cmd
+}
+
+// unpreserved regenerates the answer file from the imported configuration and
+// returns the original assignments whose value would not survive the import
+func unpreserved(file *parser.File, imported *config.Config) ([]parser.Assignment, error) {
+	var buf bytes.Buffer
+	if err := generator.New(imported, "").Render(&buf); err != nil {
+		return nil, err
+	}
+	regenerated, err := parser.Parse(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse regenerated answer file: %w", err)
+	}
+
+	var lost []parser.Assignment
+	for _, a := range file.Assignments {
+		if last, _ := file.Lookup(a.Name); last.Line != a.Line {
+			continue
+		}
+		if b, ok := regenerated.Lookup(a.Name); !ok || b.Value != a.Value {
+			lost = append(lost, a)
+		}
+	}
+	return lost, nil
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+func TestImportCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	answers := `KEYMAPOPTS="uk uk"
+HOSTNAMEOPTS="-n imported-host"
+INTERFACESOPTS="auto lo
+iface lo inet loopback
+
+auto wlan0
+iface wlan0 inet dhcp
+"
+TIMEZONEOPTS="-z Europe/London"
+PROXYOPTS="none"
+APKREPOSOPTS="-f"
+SSHDOPTS="-c openssh"
+NTPOPTS="-c busybox"
+DISKOPTS="-m sys /dev/sda"
+USEROPTS="-a -u -g wheel importer"
+PWUSER="imported-pass"
+`
+	answersPath := filepath.Join(tmpDir, "answers.txt")
+	if err := os.WriteFile(answersPath, []byte(answers), 0600); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(tmpDir, "imported.yaml")
+
+	var stderr bytes.Buffer
+	rootCmd.SetErr(&stderr)
+	defer rootCmd.SetErr(nil)
+	rootCmd.SetArgs([]string{"import", answersPath, "--output", output})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("import error = %v\nstderr: %s", err, stderr.String())
+	}
+
+	if !strings.Contains(stderr.String(), "warning: NTPOPTS on line 13 is not preserved") {
+		t.Errorf("expected warning about NTPOPTS, got: %s", stderr.String())
+	}
+
+	got, err := config.Load(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &config.Config{
+		Hostname:     "imported-host",
+		Username:     "importer",
+		Password:     "imported-pass",
+		Timezone:     "Europe/London",
+		Keymap:       "uk",
+		NetworkIface: "wlan0",
+		DiskDevice:   "/dev/sda",
+		Groups:       []string{"wheel"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("imported config = %+v, want %+v", got, want)
+	}
+}
+
+func TestImportCommand_SyntaxError(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	answersPath := filepath.Join(tmpDir, "answers.txt")
+	if err := os.WriteFile(answersPath, []byte("PWUSER=\"unterminated\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rootCmd.SetArgs([]string{"import", answersPath, "--output", filepath.Join(tmpDir, "out.yaml")})
+	err := rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "unterminated double quote") {
+		t.Errorf("import error = %v, want unterminated double quote", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "out.yaml")); !os.IsNotExist(err) {
+		t.Errorf("config file should not be written on syntax errors")
+	}
+}
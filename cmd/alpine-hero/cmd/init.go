@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/btassone/alpine-hero/internal/wizard"
+	"github.com/spf13/cobra"
+)
+
+func newInitCmd() *cobra.Command {
+	var (
+		force          bool
+		nonInteractive bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "init [FILE]",
+		Short: "Create a config file interactively",
+		Long: `Prompt for every configuration setting and write the answers to FILE
+(alpine-hero.yaml by default), ready to be passed to the other commands with
+--config.
+
+Pressing enter keeps the default shown in brackets. Each answer is validated as
+soon as it is entered. Timezone and keyboard layout can be picked from a list by
+number. With --non-interactive no questions are asked and the defaults are
+written as they are.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "alpine-hero.yaml"
+			if len(args) > 0 {
+				path = args[0]
+			}
+			if _, err := os.Stat(path); err == nil && !force {
+				return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+			}
+
+			c := *cfg
+			if !nonInteractive {
+				if err := wizard.New(cmd.InOrStdin(), cmd.OutOrStdout()).Run(&c); err != nil {
+					return err
+				}
+			}
+			if err := c.Validate(); err != nil {
+				return fmt.Errorf("invalid configuration: %w", err)
+			}
+
+			if err := c.Save(path); err != nil {
+				return err
+			}
+			cmd.PrintErrf("Wrote config file %s\n", path)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite an existing config file")
+	cmd.Flags().BoolVar(&nonInteractive, "non-interactive", false, "Accept every default without prompting")
+
+	return cmd
+}
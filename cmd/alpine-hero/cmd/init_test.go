@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+func TestInitCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	resetFlags(t)
+	var stdout bytes.Buffer
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(io.Discard)
+	defer func() {
+		rootCmd.SetIn(nil)
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		resetFlags(t)
+	}()
+
+	path := filepath.Join(tmpDir, "pi.yaml")
+	rootCmd.SetIn(strings.NewReader("pi-kitchen\n\n\n15\n2\n\n10.20.0.50/24\n10.20.0.1\n10.20.0.1\n\n\n\n"))
+	rootCmd.SetArgs([]string{"init", path})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("init error = %v\noutput:\n%s", err, stdout.String())
+	}
+	got, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := config.New()
+	want.Hostname = "pi-kitchen"
+	want.Timezone = "Europe/London"
+	want.Keymap = "uk"
+	want.Address = "10.20.0.50/24"
+	want.Gateway = "10.20.0.1"
+	want.DNS = []string{"10.20.0.1"}
+	if got.Hostname != want.Hostname || got.Timezone != want.Timezone || got.Keymap != want.Keymap ||
+		got.Address != want.Address || got.Gateway != want.Gateway || !reflect.DeepEqual(got.DNS, want.DNS) {
+		t.Errorf("init wrote %+v, want %+v", got, want)
+	}
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"init", path})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "use --force") {
+		t.Errorf("init error = %v, want refusal to overwrite", err)
+	}
+
+	resetFlags(t)
+	rootCmd.SetIn(strings.NewReader(""))
+	rootCmd.SetArgs([]string{"init", "--non-interactive", "--force", path})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("init --non-interactive error = %v", err)
+	}
+	got, err = config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Hostname != config.New().Hostname {
+		t.Errorf("init --non-interactive wrote hostname %q, want the default", got.Hostname)
+	}
+
+	resetFlags(t)
+	rootCmd.SetIn(strings.NewReader("pi\n"))
+	rootCmd.SetArgs([]string{"init", filepath.Join(tmpDir, "short.yaml")})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "unexpected end of input") {
+		t.Errorf("init error = %v, want an end of input error", err)
+	}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/btassone/alpine-hero/internal/generator"
+	"github.com/btassone/alpine-hero/internal/inventory"
+	"github.com/spf13/cobra"
+)
+
+// loadHosts returns the hosts of the inventory at path with their addresses
+// allocated, or the configuration given by --config and the flags if path is
+// empty. saveLock records the allocations in the lock file and is called
+// once the files of the hosts have been written.
+func loadHosts(path string) (hosts []inventory.Host, saveLock func() error, err error) {
+	if path == "" {
+		if err := cfg.Validate(); err != nil {
+			return nil, nil, err
+		}
+		return []inventory.Host{{Config: cfg}}, func() error { return nil }, nil
+	}
+	inv, err := inventory.Load(path, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := inv.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("inventory %s is invalid:\n%w", path, err)
+	}
+	if err := inv.AllocateAddresses(); err != nil {
+		return nil, nil, err
+	}
+	return inv.Hosts, inv.SaveLock, nil
+}
+
+// generateInventory generates the answer file of every host in the inventory
+// at path, at most jobs at a time. pattern overrides the inventory's output
+// pattern when set. Address allocations are saved to the lock file when
+// saveLock is set and every host succeeded.
+func generateInventory(cmd *cobra.Command, path, pattern string, jobs int, saveLock bool, opts []generator.Option) error {
+	inv, err := inventory.Load(path, cfg)
+	if err != nil {
+		return err
+	}
+	if pattern != "" {
+		inv.Output = pattern
+	}
+	if inv.Output == generator.Stdout {
+		return fmt.Errorf("--output - cannot be used with --inventory, give an output path pattern instead")
+	}
+	if err := inv.Validate(); err != nil {
+		return fmt.Errorf("inventory %s is invalid:\n%w", path, err)
+	}
+	if err := inv.AllocateAddresses(); err != nil {
+		return err
+	}
+
+	// per host status messages are replaced by the summary table
+	opts = append(opts,
+		generator.WithStreams(cmd.OutOrStdout(), io.Discard),
+		generator.WithCreateDirs(true),
+	)
+
+	batch := make([]generator.Job, len(inv.Hosts))
+	for i, h := range inv.Hosts {
+		// Validate has already checked every output pattern
+		output, _ := inv.OutputPath(h)
+		batch[i] = generator.Job{Config: h.Config, Output: output}
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+	results, err := generator.Batch(ctx, batch, jobs, opts...)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(cmd.ErrOrStderr(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "HOST\tOUTPUT\tRESULT")
+	failed := 0
+	for _, r := range results {
+		result := "ok"
+		if r.Err != nil {
+			failed++
+			result = "failed: " + r.Err.Error()
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", r.Job.Config.Hostname, r.Job.Output, result)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d hosts failed", failed, len(inv.Hosts))
+	}
+	if saveLock {
+		return inv.SaveLock()
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateCommand_Inventory(t *testing.T) {
+	tmpDir := t.TempDir()
+	resetFlags(t)
+	var stdout, stderr bytes.Buffer
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&stderr)
+	defer func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		resetFlags(t)
+	}()
+
+	hosts := filepath.Join(tmpDir, "hosts.yaml")
+	content := `output: ` + tmpDir + `/out/{{.Hostname}}/answers.txt
+defaults:
+  timezone: Europe/London
+hosts:
+  - hostname: pi-kitchen
+  - hostname: pi-office
+    interface: wlan0
+`
+	if err := os.WriteFile(hosts, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rootCmd.SetArgs([]string{"generate", "--inventory", hosts})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate --inventory error = %v\n%s", err, stderr.String())
+	}
+	for host, want := range map[string]string{
+		"pi-kitchen": "auto eth0",
+		"pi-office":  "auto wlan0",
+	} {
+		data, err := os.ReadFile(filepath.Join(tmpDir, "out", host, "answers.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []string{`HOSTNAMEOPTS="-n ` + host + `"`, `TIMEZONEOPTS="-z Europe/London"`, want} {
+			if !strings.Contains(string(data), s) {
+				t.Errorf("answer file of %s missing %q", host, s)
+			}
+		}
+	}
+	summary := stderr.String()
+	if !strings.HasPrefix(summary, "HOST        OUTPUT") || strings.Count(summary, "  ok\n") != 2 {
+		t.Errorf("summary =\n%s\nwant a table with two successful hosts", summary)
+	}
+
+	// a second run needs --force, and the summary shows the failures
+	resetFlags(t)
+	stderr.Reset()
+	rootCmd.SetArgs([]string{"generate", "--inventory", hosts})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "2 of 2 hosts failed") {
+		t.Errorf("generate --inventory error = %v, want both hosts to fail", err)
+	}
+	if !strings.Contains(stderr.String(), "failed: ") {
+		t.Errorf("summary =\n%s\nwant the failures listed", stderr.String())
+	}
+
+	// --output overrides the pattern of the inventory
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"generate", "--inventory", hosts, "--output", filepath.Join(tmpDir, "flat", "{{.Hostname}}.txt")})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate --inventory --output error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "flat", "pi-office.txt")); err != nil {
+		t.Errorf("answer file not written to the --output pattern: %v", err)
+	}
+}
+
+func TestGenerateCommand_InventoryInvalid(t *testing.T) {
+	tmpDir := t.TempDir()
+	resetFlags(t)
+	defer resetFlags(t)
+
+	hosts := filepath.Join(tmpDir, "hosts.yaml")
+	content := `output: ` + tmpDir + `/{{.Hostname}}.txt
+hosts:
+  - hostname: pi
+  - hostname: pi
+  - hostname: other
+    username: ""
+`
+	if err := os.WriteFile(hosts, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rootCmd.SetArgs([]string{"generate", "--inventory", hosts})
+	err := rootCmd.Execute()
+	if err == nil {
+		t.Fatal("generate --inventory error = nil")
+	}
+	for _, want := range []string{"username cannot be empty", "hostname pi is used by the hosts on lines 3, 4"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %v, want it to contain %q", err, want)
+		}
+	}
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 1 {
+		t.Errorf("invalid inventory wrote files: %v", entries)
+	}
+}
+
+func TestGenerateCommand_InventoryJobs(t *testing.T) {
+	tmpDir := t.TempDir()
+	resetFlags(t)
+	var stdout, stderr bytes.Buffer
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&stderr)
+	defer func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		resetFlags(t)
+	}()
+
+	var hostnames []string
+	content := "output: " + tmpDir + "/{{.Hostname}}.txt\nhosts:\n"
+	for i := 0; i < 12; i++ {
+		name := fmt.Sprintf("node-%02d", i)
+		hostnames = append(hostnames, name)
+		content += "  - hostname: " + name + "\n"
+	}
+	hosts := filepath.Join(tmpDir, "hosts.yaml")
+	if err := os.WriteFile(hosts, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rootCmd.SetArgs([]string{"generate", "--inventory", hosts, "--jobs", "4", "--dry-run"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate --inventory --jobs error = %v\n%s", err, stderr.String())
+	}
+
+	// answer files and summary rows follow the inventory order
+	var printed, summary []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if strings.HasPrefix(line, "HOSTNAMEOPTS=") {
+			printed = append(printed, strings.Trim(strings.TrimPrefix(line, `HOSTNAMEOPTS="-n `), `"`))
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n")[1:] {
+		summary = append(summary, strings.Fields(line)[0])
+	}
+	want := strings.Join(hostnames, " ")
+	if got := strings.Join(printed, " "); got != want {
+		t.Errorf("answer files printed for %s, want %s", got, want)
+	}
+	if got := strings.Join(summary, " "); got != want {
+		t.Errorf("summary lists %s, want %s", got, want)
+	}
+}
+
+func TestGenerateCommand_InventoryNetwork(t *testing.T) {
+	tmpDir := t.TempDir()
+	resetFlags(t)
+	var stdout, stderr bytes.Buffer
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&stderr)
+	defer func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		resetFlags(t)
+	}()
+
+	hosts := filepath.Join(tmpDir, "hosts.yaml")
+	content := `output: ` + tmpDir + `/{{.Hostname}}.txt
+network:
+  subnet: 10.20.0.0/24
+  start: .50
+  gateway: .1
+  dns: [10.20.0.1, 10.20.0.2]
+hosts:
+  - hostname: pi-kitchen
+  - hostname: pi-office
+`
+	if err := os.WriteFile(hosts, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lockFile := filepath.Join(tmpDir, "hosts.lock")
+
+	rootCmd.SetArgs([]string{"generate", "--inventory", hosts, "--dry-run"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate --inventory --dry-run error = %v\n%s", err, stderr.String())
+	}
+	for _, want := range []string{"address 10.20.0.51/24\n\tgateway 10.20.0.1\n", `DNSOPTS="10.20.0.1 10.20.0.2"`} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("dry run output missing %q\n%s", want, stdout.String())
+		}
+	}
+	if _, err := os.Stat(lockFile); !os.IsNotExist(err) {
+		t.Error("dry run wrote the lock file")
+	}
+
+	// a run where a host fails does not record the allocations
+	if err := os.WriteFile(filepath.Join(tmpDir, "pi-office.txt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"generate", "--inventory", hosts})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "1 of 2 hosts failed") {
+		t.Fatalf("generate --inventory error = %v, want pi-office to fail", err)
+	}
+	if _, err := os.Stat(lockFile); !os.IsNotExist(err) {
+		t.Error("failed run wrote the lock file")
+	}
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"generate", "--inventory", hosts, "--force"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate --inventory error = %v\n%s", err, stderr.String())
+	}
+	data, err := os.ReadFile(lockFile)
+	if err != nil || !strings.Contains(string(data), "pi-office: 10.20.0.51") {
+		t.Errorf("lock file = %q, %v, want the allocations recorded", data, err)
+	}
+}
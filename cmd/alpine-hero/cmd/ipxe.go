@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/btassone/alpine-hero/internal/generator"
+	"github.com/btassone/alpine-hero/internal/ipxe"
+	"github.com/btassone/alpine-hero/internal/server"
+	"github.com/spf13/cobra"
+)
+
+func newIPXECmd() *cobra.Command {
+	var (
+		output, inventoryFile, baseURL, serveURL string
+		perMAC, force, backup                    bool
+		opts                                     ipxe.Options
+	)
+
+	cmd := &cobra.Command{
+		Use:   "ipxe",
+		Short: "Generate iPXE scripts that network boot hosts into an unattended install",
+		Long: `Generate iPXE scripts that boot the Alpine netboot kernel with the overlay
+of a host, which installs the system with its answer file:
+
+  boot.ipxe                a menu of every host, which boots the host with the
+                           MAC address of the booting interface right away
+  <mac>.ipxe               with --per-mac, a script per host with a mac in the
+                           inventory, named like ${netX/mac:hexhyp}.ipxe
+
+The kernel gets alpine_repo, modloop, apkovl and the --console and --cmdline
+parameters. The kernel, initramfs and modloop are loaded from --boot-url.
+
+The scripts work as static files: with --url the overlay of every host, with
+its answer file, is written next to the scripts as <hostname>.apkovl.tar.gz,
+and --url is the URL the directory is served at. With --serve the overlays
+and answer files are fetched from a running alpine-hero serve at that URL
+instead, so only the scripts are written; they carry no tokens, so use them
+with a serve without --tokens. alpine-hero serve --ipxe serves the same
+scripts itself, and with --tokens adds a host's token to its script when the
+host fetches it from its static address.
+
+The hosts are the configuration given by --config and the flags, or every host
+of --inventory. The files are written to the directory ipxe unless --output
+is given.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hosts, saveLock, err := loadHosts(inventoryFile)
+			if err != nil {
+				return err
+			}
+
+			var files []ipxeFile
+			boot := make([]ipxe.Host, len(hosts))
+			for i, h := range hosts {
+				name := h.Config.Hostname
+				boot[i] = ipxe.Host{Name: name, MAC: h.MAC}
+				if serveURL != "" {
+					base := strings.TrimSuffix(serveURL, "/")
+					boot[i].Apkovl = base + server.ApkovlPath(name)
+					boot[i].Answers = base + server.AnswersPath(name)
+					continue
+				}
+				answers, err := renderAnswers(h.Config)
+				if err != nil {
+					return err
+				}
+				overlay, err := buildOverlay(h.Config, answers)
+				if err != nil {
+					return err
+				}
+				file := name + ".apkovl.tar.gz"
+				boot[i].Apkovl = strings.TrimSuffix(baseURL, "/") + "/" + file
+				files = append(files, ipxeFile{file, overlay})
+			}
+
+			if perMAC {
+				for i, h := range hosts {
+					if h.MAC == "" {
+						_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s has no mac and gets no script\n", h.Config.Hostname)
+						continue
+					}
+					script, err := ipxe.Script(boot[i], opts)
+					if err != nil {
+						return err
+					}
+					files = append(files, ipxeFile{ipxe.MACFile(h.MAC), script})
+				}
+			} else {
+				menu, err := ipxe.Menu(boot, opts)
+				if err != nil {
+					return err
+				}
+				files = append(files, ipxeFile{ipxe.MenuFile, menu})
+			}
+
+			for _, f := range files {
+				err := generator.New(cfg, filepath.Join(output, f.name),
+					generator.WithStreams(cmd.OutOrStdout(), cmd.ErrOrStderr()),
+					generator.WithOutputPolicy(outputPolicy),
+					generator.WithForce(force),
+					generator.WithBackup(backup),
+					generator.WithCreateDirs(true),
+				).WriteFile(f.data)
+				if err != nil {
+					return err
+				}
+			}
+			return saveLock()
+		},
+	}
+
+	addConfigFlags(cmd)
+	addIPXEFlags(cmd, &opts)
+	cmd.Flags().StringVarP(&output, "output", "o", "ipxe", "Directory to write the scripts and overlays to")
+	cmd.Flags().StringVar(&inventoryFile, "inventory", "", "Generate scripts for every host of an inventory file")
+	cmd.Flags().StringVar(&baseURL, "url", "", "URL the output directory is served at, to load the overlays from")
+	cmd.Flags().StringVar(&serveURL, "serve", "", "URL of an alpine-hero serve to load the overlays and answer files from")
+	cmd.Flags().BoolVar(&perMAC, "per-mac", false, "Write a script per MAC address instead of a menu")
+	cmd.Flags().StringVar(&templateFile, "template", "", "Template file to use instead of the built-in one")
+	cmd.Flags().StringVar(&partialsDir, "partials", "", "Directory of *.tmpl partials available to the template")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite existing files")
+	cmd.Flags().BoolVar(&backup, "backup", false, "Keep a timestamped backup of every overwritten file")
+	cmd.MarkFlagsOneRequired("url", "serve")
+	cmd.MarkFlagsMutuallyExclusive("url", "serve")
+
+	return cmd
+}
+
+// ipxeFile is a file written by the ipxe command
+type ipxeFile struct {
+	name string
+	data []byte
+}
+
+// addIPXEFlags binds the flags of the boot scripts to opts
+func addIPXEFlags(cmd *cobra.Command, opts *ipxe.Options) {
+	cmd.Flags().StringVar(&opts.BootURL, "boot-url", ipxe.DefaultBootURL, "Netboot directory with the kernel, initramfs and modloop")
+	cmd.Flags().StringVar(&opts.Flavor, "flavor", ipxe.DefaultFlavor, "Kernel flavor to boot")
+	cmd.Flags().StringVar(&opts.Repo, "repo", ipxe.DefaultRepo, "Repository the booted system installs from")
+	cmd.Flags().StringArrayVar(&opts.Console, "console", nil, "Kernel console, for example ttyS0,115200 (repeatable)")
+	cmd.Flags().StringArrayVar(&opts.Cmdline, "cmdline", nil, "Kernel parameter to add (repeatable)")
+}
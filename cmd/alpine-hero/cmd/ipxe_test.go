@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIPXECommand(t *testing.T) {
+	tmpDir, stderr := setupCommand(t)
+
+	hosts := filepath.Join(tmpDir, "hosts.yaml")
+	content := `hosts:
+  - hostname: pi-kitchen
+    mac: 52:54:00:AB:CD:01
+  - hostname: pi-office
+`
+	if err := os.WriteFile(hosts, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(tmpDir, "menu")
+	rootCmd.SetArgs([]string{"ipxe", "--inventory", hosts, "-o", out, "--url", "http://10.0.0.2/boot/", "--console", "ttyS0,115200"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("ipxe error = %v\n%s", err, stderr.String())
+	}
+	menu, err := os.ReadFile(filepath.Join(out, "boot.ipxe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"iseq ${netX/mac} 52:54:00:ab:cd:01 && goto pi-kitchen ||",
+		"apkovl=http://10.0.0.2/boot/pi-kitchen.apkovl.tar.gz",
+		"apkovl=http://10.0.0.2/boot/pi-office.apkovl.tar.gz",
+		"console=ttyS0,115200",
+	} {
+		if !strings.Contains(string(menu), want) {
+			t.Errorf("boot.ipxe =\n%s\nwant it to contain %q", menu, want)
+		}
+	}
+	if strings.Contains(string(menu), "alpine_hero_answers=") {
+		t.Errorf("boot.ipxe =\n%s\nwant the answer files bundled in the overlays", menu)
+	}
+	for _, name := range []string{"pi-kitchen.apkovl.tar.gz", "pi-office.apkovl.tar.gz"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Errorf("overlay %s: %v", name, err)
+		}
+	}
+
+	// with --serve only the per-MAC scripts are written
+	resetFlags(t)
+	stderr.Reset()
+	out = filepath.Join(tmpDir, "serve")
+	rootCmd.SetArgs([]string{"ipxe", "--inventory", hosts, "-o", out, "--serve", "http://10.0.0.2:8080", "--per-mac"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("ipxe --serve error = %v\n%s", err, stderr.String())
+	}
+	entries, err := os.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "52-54-00-ab-cd-01.ipxe" {
+		t.Fatalf("ipxe --serve wrote %v, want only 52-54-00-ab-cd-01.ipxe", entries)
+	}
+	script, err := os.ReadFile(filepath.Join(out, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"apkovl=http://10.0.0.2:8080/apkovl/pi-kitchen.apkovl.tar.gz",
+		"alpine_hero_answers=http://10.0.0.2:8080/answers/pi-kitchen",
+	} {
+		if !strings.Contains(string(script), want) {
+			t.Errorf("script =\n%s\nwant it to contain %q", script, want)
+		}
+	}
+	if !strings.Contains(stderr.String(), "pi-office has no mac") {
+		t.Errorf("stderr = %q, want a warning for pi-office", stderr.String())
+	}
+
+	// --url or --serve is required
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"ipxe", "-o", filepath.Join(tmpDir, "none")})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("ipxe without --url or --serve succeeded, want an error")
+	}
+}
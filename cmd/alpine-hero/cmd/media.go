@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/btassone/alpine-hero/internal/generator"
+	"github.com/btassone/alpine-hero/internal/media"
+	"github.com/spf13/cobra"
+)
+
+func newMediaCmd() *cobra.Command {
+	var withOverlay, force, backup bool
+
+	cmd := &cobra.Command{
+		Use:   "media DIR",
+		Short: "Write the alpine-hero files to Raspberry Pi boot media",
+		Long: `Write the files alpine-hero controls to the root of Raspberry Pi boot media,
+for example an SD card the Alpine Raspberry Pi tarball has been unpacked onto:
+
+  answers.txt               the answer file
+  <hostname>.apkovl.tar.gz  the headless install overlay, unless --apkovl=false
+  usercfg.txt               firmware settings from the pi section of the config
+  cmdline.txt               kernel parameters from the pi section of the config
+
+usercfg.txt and cmdline.txt are merged with the files on the media instead of
+replaced. The firmware settings go into a block marked with "# BEGIN
+alpine-hero" and "# END alpine-hero" that is updated on later runs, and
+kernel parameters replace existing ones with the same name. usercfg.txt is
+read by the config.txt of the Alpine tarball. An existing answers.txt or
+overlay is only replaced with --force, and checked before anything is written.
+
+The configuration is taken from --config and the same flags as generate.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := args[0]
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+
+			answers, err := renderAnswers(cfg)
+			if err != nil {
+				return err
+			}
+			var overlay []byte
+			if withOverlay {
+				if overlay, err = buildOverlay(cfg, answers); err != nil {
+					return err
+				}
+			}
+
+			files, err := media.Files(dir, cfg, answers, overlay)
+			if err != nil {
+				return err
+			}
+			// refuse before writing anything, so the media is not left
+			// with a new answer file next to an old overlay
+			for _, f := range files {
+				path := filepath.Join(dir, f.Name)
+				if _, err := os.Lstat(path); err == nil && !f.Merged && !force {
+					return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+				}
+			}
+			for _, f := range files {
+				err := generator.New(cfg, filepath.Join(dir, f.Name),
+					generator.WithStreams(cmd.OutOrStdout(), cmd.ErrOrStderr()),
+					generator.WithOutputPolicy(outputPolicy),
+					generator.WithForce(force || f.Merged),
+					generator.WithBackup(backup),
+				).WriteFile(f.Data)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	addConfigFlags(cmd)
+	cmd.Flags().BoolVar(&withOverlay, "apkovl", true, "Write the headless install overlay")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite an existing answer file and overlay")
+	cmd.Flags().BoolVar(&backup, "backup", false, "Keep a timestamped backup of every replaced file")
+	cmd.Flags().StringVar(&templateFile, "template", "", "Template file to use instead of the built-in one")
+	cmd.Flags().StringVar(&partialsDir, "partials", "", "Directory of *.tmpl partials available to the template")
+	cmd.Flags().BoolVar(&cfg.Pi.EnableUART, "enable-uart", cfg.Pi.EnableUART, "Enable the serial console UART")
+	cmd.Flags().IntVar(&cfg.Pi.GPUMem, "gpu-mem", cfg.Pi.GPUMem, "Memory in MB reserved for the GPU")
+	cmd.Flags().StringSliceVar(&cfg.Pi.DTOverlays, "dtoverlay", cfg.Pi.DTOverlays, "Device tree overlays to load (comma-separated)")
+	cmd.Flags().StringSliceVar(&cfg.Pi.DTParams, "dtparam", cfg.Pi.DTParams, "Device tree parameters to set (comma-separated)")
+	cmd.Flags().StringArrayVar(&cfg.Pi.Cmdline, "cmdline", cfg.Pi.Cmdline, "Kernel parameter to add to cmdline.txt (repeatable)")
+
+	return cmd
+}
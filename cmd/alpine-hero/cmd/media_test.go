@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMediaCommand(t *testing.T) {
+	dir, stderr := setupCommand(t)
+
+	// the files of the Alpine tarball that the command merges with
+	files := map[string]string{
+		"cmdline.txt": "modules=loop,squashfs,sd-mod,usb-storage quiet console=tty1\n",
+		"usercfg.txt": "hdmi_safe=1\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	args := []string{"media", dir, "--hostname", "pi-kitchen",
+		"--enable-uart", "--gpu-mem", "16", "--dtoverlay", "disable-bt",
+		"--cmdline", "console=serial0,115200"}
+	rootCmd.SetArgs(args)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("media error = %v\n%s", err, stderr.String())
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s not written: %v", name, err)
+		}
+		return string(data)
+	}
+	if got := read("answers.txt"); !strings.Contains(got, `HOSTNAMEOPTS="-n pi-kitchen"`) {
+		t.Errorf("answers.txt =\n%s", got)
+	}
+	if got := read("pi-kitchen.apkovl.tar.gz"); !strings.HasPrefix(got, "\x1f\x8b") {
+		t.Error("pi-kitchen.apkovl.tar.gz is not a gzip file")
+	}
+	wantCfg := "hdmi_safe=1\n\n# BEGIN alpine-hero\n[all]\nenable_uart=1\ngpu_mem=16\ndtoverlay=disable-bt\n# END alpine-hero\n"
+	if got := read("usercfg.txt"); got != wantCfg {
+		t.Errorf("usercfg.txt =\n%s\nwant\n%s", got, wantCfg)
+	}
+	wantCmdline := "modules=loop,squashfs,sd-mod,usb-storage quiet console=tty1 console=serial0,115200\n"
+	if got := read("cmdline.txt"); got != wantCmdline {
+		t.Errorf("cmdline.txt = %q, want %q", got, wantCmdline)
+	}
+
+	// running again needs --force to replace the answer file and overlay,
+	// and writes nothing without it
+	resetFlags(t)
+	rootCmd.SetArgs(append(args, "--gpu-mem", "32"))
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "answers.txt already exists, use --force") {
+		t.Errorf("media error = %v, want a refusal to overwrite answers.txt", err)
+	}
+	if got := read("usercfg.txt"); got != wantCfg {
+		t.Errorf("usercfg.txt after a refused run =\n%s", got)
+	}
+	if err := os.Remove(filepath.Join(dir, "answers.txt")); err != nil {
+		t.Fatal(err)
+	}
+	resetFlags(t)
+	rootCmd.SetArgs(append(args, "--gpu-mem", "32"))
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "pi-kitchen.apkovl.tar.gz already exists") {
+		t.Errorf("media error = %v, want a refusal to overwrite the overlay", err)
+	}
+
+	// with --force the answer file and overlay are replaced and the merged
+	// files updated in place
+	resetFlags(t)
+	rootCmd.SetArgs(append(args, "--gpu-mem", "32", "--force"))
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("media error = %v\n%s", err, stderr.String())
+	}
+	if got := read("usercfg.txt"); got != strings.Replace(wantCfg, "gpu_mem=16", "gpu_mem=32", 1) {
+		t.Errorf("usercfg.txt after a second run =\n%s", got)
+	}
+	if got := read("cmdline.txt"); got != wantCmdline {
+		t.Errorf("cmdline.txt after a second run = %q", got)
+	}
+
+	// a different host would leave two overlays on the media
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"media", dir, "--hostname", "pi-garage"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "already has the overlay pi-kitchen.apkovl.tar.gz") {
+		t.Errorf("media error = %v, want the other overlay reported", err)
+	}
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"media", dir, "--gpu-mem", "8"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "gpu_mem") {
+		t.Errorf("media error = %v, want the pi settings validated", err)
+	}
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/btassone/alpine-hero/internal/generator"
+	"github.com/btassone/alpine-hero/internal/packer"
+	"github.com/spf13/cobra"
+)
+
+func newPackerCmd() *cobra.Command {
+	var (
+		output                  string
+		opts                    packer.Options
+		force, backup, headless bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "packer",
+		Short: "Generate a Packer template that builds an Alpine image with QEMU",
+		Long: `Generate a Packer build directory for a qcow2 image of the configuration:
+
+  alpine.pkr.hcl     a template for the qemu builder
+  http/answers.txt   the answer file, served by Packer during the build
+
+The machine boots the Alpine ISO, logs in as root, fetches the answer file
+from the Packer HTTP server and runs setup-alpine -f with it, erasing the
+disk without asking. Packer then connects to the installed system over SSH
+with the configured username and password. The password is not written to
+the template: pass it as the sensitive variable ssh_password with
+-var ssh_password=... or the PKR_VAR_ssh_password environment variable.
+The answer file does hold the password in clear and Packer serves it to
+anyone who can reach its HTTP server during the build, so do not commit
+http/answers.txt and build on a trusted network.
+
+The disk must be a virtio disk such as /dev/vda or a SCSI disk such as
+/dev/sda. Disk size, memory and CPUs are taken from the vm block of the
+config file or --disk-size, --memory and --cpus.
+
+The files are written to the directory packer unless --output is given. Run
+the build with:
+
+  packer init packer && PKR_VAR_ssh_password=... packer build packer`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+			if cfg.Address != "" {
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s has the static address %s, Packer can only connect if QEMU's user network reaches it\n", cfg.Hostname, cfg.Address)
+			}
+
+			answers, err := renderAnswers(cfg)
+			if err != nil {
+				return err
+			}
+			opts.Headless = headless
+			files, err := packer.Files(cfg, answers, opts)
+			if err != nil {
+				return err
+			}
+			for _, f := range files {
+				err := generator.New(cfg, filepath.Join(output, filepath.FromSlash(f.Path)),
+					generator.WithStreams(cmd.OutOrStdout(), cmd.ErrOrStderr()),
+					generator.WithOutputPolicy(outputPolicy),
+					generator.WithForce(force),
+					generator.WithBackup(backup),
+					generator.WithCreateDirs(true),
+				).WriteFile(f.Data)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	addConfigFlags(cmd)
+	cmd.Flags().StringVarP(&output, "output", "o", "packer", "Directory to write the template and answer file to")
+	cmd.Flags().StringVar(&templateFile, "template", "", "Template file to use instead of the built-in one")
+	cmd.Flags().StringVar(&partialsDir, "partials", "", "Directory of *.tmpl partials available to the template")
+	cmd.Flags().StringVar(&opts.ISOURL, "iso-url", packer.DefaultISOURL, "Alpine ISO the machine boots")
+	cmd.Flags().StringVar(&opts.ISOChecksum, "iso-checksum", "", "Checksum of the ISO (default: the .sha256 file next to the ISO)")
+	cmd.Flags().StringVar(&cfg.VM.DiskSize, "disk-size", cfg.VM.DiskSize, "Disk size with an optional K, M, G or T suffix (default "+packer.DefaultDiskSize+")")
+	cmd.Flags().IntVar(&cfg.VM.Memory, "memory", cfg.VM.Memory, fmt.Sprintf("Memory of the machine in MB (default %d)", packer.DefaultMemory))
+	cmd.Flags().IntVar(&cfg.VM.CPUs, "cpus", cfg.VM.CPUs, fmt.Sprintf("Number of CPUs of the machine (default %d)", packer.DefaultCPUs))
+	cmd.Flags().BoolVar(&headless, "headless", false, "Run the machine without a display")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite existing files")
+	cmd.Flags().BoolVar(&backup, "backup", false, "Keep a timestamped backup of every overwritten file")
+
+	return cmd
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPackerCommand(t *testing.T) {
+	tmpDir, stderr := setupCommand(t)
+
+	configPath := filepath.Join(tmpDir, "golden.yaml")
+	content := "hostname: golden\ndisk: /dev/vda\nvm:\n  disk_size: 20G\n  memory: 2048\n"
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(tmpDir, "packer")
+	rootCmd.SetArgs([]string{"packer", "--config", configPath, "-o", out, "--memory", "4096", "--headless"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("packer error = %v\n%s", err, stderr.String())
+	}
+	tmpl, err := os.ReadFile(filepath.Join(out, "alpine.pkr.hcl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"20G"`, "= 4096\n", "= true\n", `"golden.qcow2"`, "ERASE_DISKS='/dev/vda' setup-alpine -e -f /tmp/answers.txt"} {
+		if !strings.Contains(string(tmpl), s) {
+			t.Errorf("template missing %s\n%s", s, tmpl)
+		}
+	}
+	answers, err := os.ReadFile(filepath.Join(out, "http", "answers.txt"))
+	if err != nil || !strings.Contains(string(answers), `DISKOPTS="-m sys /dev/vda"`) {
+		t.Errorf("answers.txt = %q, %v", answers, err)
+	}
+
+	// a disk the qemu builder cannot attach is rejected before writing
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"packer", "-o", filepath.Join(tmpDir, "pi")})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "cannot be attached by the qemu builder") {
+		t.Errorf("packer error = %v, want the SD card disk rejected", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "pi")); !os.IsNotExist(err) {
+		t.Error("packer wrote files for a rejected configuration")
+	}
+}
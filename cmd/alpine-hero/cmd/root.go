@@ -3,12 +3,19 @@ package cmd
 import (
 	"github.com/btassone/alpine-hero/internal/config"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
 	// Shared configuration that will be used across commands
-	cfg        *config.Config
-	outputFile string
+	cfg          *config.Config
+	outputFile   string
+	configFile   string
+	templateFile string
+	partialsDir  string
+	// outputPolicy decides where commands may write files, set by the
+	// output block of --config
+	outputPolicy = config.DefaultOutputPolicy()
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -17,6 +24,7 @@ var rootCmd = &cobra.Command{
 	Short: "Alpine Linux answer file generator",
 	Long: `A CLI tool to generate Alpine Linux answer files for automated installation.
 This tool helps create the answers file needed for automated Alpine Linux installation.`,
+	PersistentPreRunE: loadConfigFile,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -27,8 +35,70 @@ func Execute() error {
 func init() {
 	cfg = config.New()
 
+	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "Read configuration from a YAML config file")
+
 	// Add all subcommands
 	rootCmd.AddCommand(newGenerateCmd())
+	rootCmd.AddCommand(newApkovlCmd())
+	rootCmd.AddCommand(newMediaCmd())
+	rootCmd.AddCommand(newImageCmd())
+	rootCmd.AddCommand(newCloudInitCmd())
+	rootCmd.AddCommand(newAnsibleCmd())
+	rootCmd.AddCommand(newPackerCmd())
+	rootCmd.AddCommand(newServeCmd())
+	rootCmd.AddCommand(newIPXECmd())
 	rootCmd.AddCommand(newValidateCmd())
+	rootCmd.AddCommand(newImportCmd())
+	rootCmd.AddCommand(newInitCmd())
+	rootCmd.AddCommand(newVerifyCmd())
+	rootCmd.AddCommand(newTemplateCmd())
 	rootCmd.AddCommand(newVersionCmd())
 }
+
+// loadConfigFile replaces the defaults with the values from --config while
+// keeping every flag that was set explicitly on the command line
+func loadConfigFile(cmd *cobra.Command, args []string) error {
+	if configFile == "" {
+		return nil
+	}
+
+	loaded, err := config.LoadFile(configFile)
+	if err != nil {
+		return err
+	}
+	outputPolicy = loaded.Output
+
+	// Flags are bound to the fields of cfg, so remember what was passed on the
+	// command line before the file overwrites it
+	type setting struct {
+		flag  *pflag.Flag
+		value string
+		slice []string
+	}
+	var changed []setting
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		s := setting{flag: f, value: f.Value.String()}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			s.slice = sv.GetSlice()
+		}
+		changed = append(changed, s)
+	})
+
+	*cfg = loaded.Config
+
+	for _, s := range changed {
+		if sv, ok := s.flag.Value.(pflag.SliceValue); ok {
+			if err := sv.Replace(s.slice); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.flag.Value.Set(s.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
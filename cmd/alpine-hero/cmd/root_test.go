@@ -1,7 +1,15 @@
 package cmd
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func TestRootCommand(t *testing.T) {
@@ -34,3 +42,120 @@ func TestRootCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestRootCommand_ConfigFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer func() {
+		configFile = ""
+		*cfg = *config.New()
+		outputPolicy = config.DefaultOutputPolicy()
+	}()
+	resetFlags(t)
+
+	configPath := filepath.Join(tmpDir, "alpine-hero.yaml")
+	content := "hostname: from-file\nusername: fileuser\ngroups: [wheel]\n"
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(tmpDir, "answers.txt")
+	rootCmd.SetArgs([]string{"generate", "--config", configPath, "--username", "flaguser", "--output", output})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`HOSTNAMEOPTS="-n from-file"`,
+		`USEROPTS="-a -u -g wheel flaguser"`,
+		`TIMEZONEOPTS="-z UTC"`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("generated file missing %q\ngot:\n%s", want, data)
+		}
+	}
+}
+
+func TestRootCommand_OutputPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	defer func() {
+		configFile = ""
+		resetFlags(t)
+	}()
+	resetFlags(t)
+
+	denied := filepath.Join(tmpDir, "denied")
+	if err := os.Mkdir(denied, 0755); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(tmpDir, "alpine-hero.yaml")
+	content := "hostname: from-file\noutput:\n  denied_roots: [" + denied + "]\n"
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rootCmd.SetArgs([]string{"apkovl", "--config", configPath, "--output", filepath.Join(denied, "pi.apkovl.tar.gz")})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "denied root") {
+		t.Errorf("apkovl error = %v, want the output policy of the config file applied", err)
+	}
+}
+
+// resetFlags restores the default values and clears the changed state that
+// earlier tests left on the shared command tree, since flags that look
+// explicitly set take precedence over the config file
+func resetFlags(t *testing.T) {
+	t.Helper()
+	*cfg = *config.New()
+	outputPolicy = config.DefaultOutputPolicy()
+	var reset func(c *cobra.Command)
+	reset = func(c *cobra.Command) {
+		c.Flags().VisitAll(func(f *pflag.Flag) {
+			if sv, ok := f.Value.(pflag.SliceValue); ok {
+				var def []string
+				if d := strings.Trim(f.DefValue, "[]"); d != "" {
+					def = strings.Split(d, ",")
+				}
+				_ = sv.Replace(def)
+			} else if err := f.Value.Set(f.DefValue); err != nil {
+				t.Fatalf("failed to reset --%s: %v", f.Name, err)
+			}
+			f.Changed = false
+		})
+		for _, sub := range c.Commands() {
+			reset(sub)
+		}
+	}
+	for _, c := range rootCmd.Commands() {
+		reset(c)
+	}
+}
+
+// setupCommand prepares a test of a subcommand: it resets the flags,
+// captures the output of rootCmd and changes into a new temporary directory.
+// It returns the directory and the captured standard error. Everything is
+// restored when the test ends.
+func setupCommand(t *testing.T) (dir string, stderr *bytes.Buffer) {
+	t.Helper()
+	dir = t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	resetFlags(t)
+	stderr = &bytes.Buffer{}
+	rootCmd.SetOut(&bytes.Buffer{})
+	rootCmd.SetErr(stderr)
+	t.Cleanup(func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		resetFlags(t)
+		_ = os.Chdir(wd)
+	})
+	return dir, stderr
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/inventory"
+	"github.com/btassone/alpine-hero/internal/ipxe"
+	"github.com/btassone/alpine-hero/internal/server"
+	"github.com/spf13/cobra"
+)
+
+func newServeCmd() *cobra.Command {
+	var (
+		listen, baseURL, inventoryFile string
+		tokens, withIPXE               bool
+		ipxeOpts                       ipxe.Options
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve answer files over HTTP for network installs",
+		Long: `Serve the answer files of the configured hosts over HTTP, so setup-alpine
+can fetch them during a network install:
+
+  GET /answers/<hostname>   the answer file of a host
+  GET /answers/mac/<mac>    the answer file of the host with the mac of its
+                            inventory entry
+  GET /answers              the answer file of the host whose address is the
+                            address of the client
+  GET /healthz              ok while the server is running
+
+With --ipxe it also serves iPXE scripts that network boot the hosts into an
+unattended install with these answer files, as the ipxe command generates:
+
+  GET /boot.ipxe            a menu of every host, booting the host with the
+                            MAC address of the booting interface right away
+  GET /ipxe/<mac>.ipxe      the script of the host with that mac
+  GET /apkovl/<hostname>.apkovl.tar.gz
+                            the overlay the scripts boot with, without the
+                            answer file, which is fetched from /answers
+
+The hosts are the configuration given by --config and the flags, or every host
+of --inventory with the addresses from its network block allocated. Answer
+files are rendered on every request, so changes to --template are served
+without a restart.
+
+With --tokens every host gets a random one-time token that has to be passed
+as ?token=..., and the answer file can only be fetched once. Unknown hosts,
+wrong tokens and used tokens all get 403 Forbidden. The URLs with the tokens
+are printed on start. Anyone can fetch the iPXE scripts, so a script only
+contains the token of a host when the host fetches it from its static
+address; other hosts have to be given their URL some other way. Every request
+is logged to standard error, without the token.
+
+The answer files contain the passwords in clear and are served over plain
+HTTP, so only serve them on a network you trust.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var opts *ipxe.Options
+			if withIPXE {
+				opts = &ipxeOpts
+			}
+			srv, hosts, err := answerServer(inventoryFile, tokens, opts, cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+
+			ln, err := net.Listen("tcp", listen)
+			if err != nil {
+				return fmt.Errorf("failed to listen on %s: %w", listen, err)
+			}
+			if baseURL == "" {
+				baseURL = defaultBaseURL(ln.Addr())
+			}
+			_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Serving answer files on %s\n", baseURL)
+			if err := printURLs(cmd.ErrOrStderr(), srv, hosts, baseURL); err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			httpServer := &http.Server{Handler: srv, ReadHeaderTimeout: 10 * time.Second}
+			go func() {
+				<-ctx.Done()
+				shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				if err := httpServer.Shutdown(shutdown); err != nil {
+					_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "failed to shut down the server: %v\n", err)
+				}
+			}()
+			if err := httpServer.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("failed to serve: %w", err)
+			}
+			return nil
+		},
+	}
+
+	addConfigFlags(cmd)
+	cmd.Flags().StringVar(&listen, "listen", ":8080", "Address to listen on")
+	cmd.Flags().StringVar(&baseURL, "url", "", "URL the hosts reach the server at, used in the printed URLs (default: http://<hostname>:<port>)")
+	cmd.Flags().StringVar(&inventoryFile, "inventory", "", "Serve every host of an inventory file")
+	cmd.Flags().BoolVar(&tokens, "tokens", false, "Require a one-time token for every answer file")
+	cmd.Flags().BoolVar(&withIPXE, "ipxe", false, "Serve iPXE scripts and overlays to network boot the hosts")
+	addIPXEFlags(cmd, &ipxeOpts)
+	cmd.Flags().StringVar(&templateFile, "template", "", "Template file to use instead of the built-in one")
+	cmd.Flags().StringVar(&partialsDir, "partials", "", "Directory of *.tmpl partials available to the template")
+
+	return cmd
+}
+
+// answerServer returns the server for the configuration given by the flags
+// or the hosts of inventoryFile, and the hosts it serves. It serves iPXE
+// scripts if ipxeOpts is not nil.
+func answerServer(inventoryFile string, tokens bool, ipxeOpts *ipxe.Options, log io.Writer) (*server.Server, []inventory.Host, error) {
+	hosts, saveLock, err := loadHosts(inventoryFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	srv, err := server.New(hosts, server.Options{
+		Render: renderAnswers,
+		Tokens: tokens,
+		Log:    log,
+		// the overlays are served without a token, so they leave out the
+		// answer file and fetch it from /answers
+		Overlay: func(c *config.Config) ([]byte, error) { return buildOverlay(c, nil) },
+		IPXE:    ipxeOpts,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := saveLock(); err != nil {
+		return nil, nil, err
+	}
+	return srv, hosts, nil
+}
+
+// printURLs prints the answer file URL of every host, with its token
+func printURLs(w io.Writer, srv *server.Server, hosts []inventory.Host, baseURL string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "HOST\tURL")
+	for _, h := range hosts {
+		url := strings.TrimSuffix(baseURL, "/") + server.AnswersPath(h.Config.Hostname)
+		if token := srv.Token(h.Config.Hostname); token != "" {
+			url += "?token=" + token
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", h.Config.Hostname, url)
+	}
+	return tw.Flush()
+}
+
+// defaultBaseURL returns the URL of the listener, with the name of this
+// machine if it listens on every address
+func defaultBaseURL(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return "http://" + addr.String()
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		if name, err := os.Hostname(); err == nil {
+			host = name
+		}
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
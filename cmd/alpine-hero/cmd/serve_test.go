@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/apkovl"
+	"github.com/btassone/alpine-hero/internal/ipxe"
+)
+
+func TestAnswerServer(t *testing.T) {
+	tmpDir := t.TempDir()
+	resetFlags(t)
+	defer resetFlags(t)
+
+	hosts := filepath.Join(tmpDir, "hosts.yaml")
+	content := `defaults:
+  timezone: Europe/London
+hosts:
+  - hostname: pi-kitchen
+    mac: 52:54:00:ab:cd:ef
+  - hostname: pi-office
+    address: 10.20.0.7/24
+    dns: [10.20.0.1]
+`
+	if err := os.WriteFile(hosts, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var logBuf bytes.Buffer
+	srv, served, err := answerServer(hosts, true, nil, &logBuf)
+	if err != nil {
+		t.Fatalf("answerServer() error = %v", err)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var urls bytes.Buffer
+	if err := printURLs(&urls, srv, served, ts.URL+"/"); err != nil {
+		t.Fatalf("printURLs() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(urls.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "HOST") {
+		t.Fatalf("printURLs() =\n%s", urls.String())
+	}
+	kitchenURL := strings.Fields(lines[1])[1]
+	if want := ts.URL + "/answers/pi-kitchen?token=" + srv.Token("pi-kitchen"); kitchenURL != want {
+		t.Errorf("URL of pi-kitchen = %s, want %s", kitchenURL, want)
+	}
+
+	resp, err := http.Get(kitchenURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	for _, s := range []string{`HOSTNAMEOPTS="-n pi-kitchen"`, `TIMEZONEOPTS="-z Europe/London"`} {
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), s) {
+			t.Errorf("GET %s = %d, body missing %q\n%s", kitchenURL, resp.StatusCode, s, body)
+		}
+	}
+	if resp, err := http.Get(kitchenURL); err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("second GET = %v, %v, want 403", resp, err)
+	}
+	if !strings.Contains(logBuf.String(), "GET /answers/pi-kitchen 200 ") {
+		t.Errorf("log =\n%s", logBuf.String())
+	}
+}
+
+func TestAnswerServer_Single(t *testing.T) {
+	resetFlags(t)
+	defer resetFlags(t)
+
+	cfg.Hostname = "pi-den"
+	srv, served, err := answerServer("", false, nil, io.Discard)
+	if err != nil || len(served) != 1 {
+		t.Fatalf("answerServer() = %d hosts, %v", len(served), err)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/answers/pi-den", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `HOSTNAMEOPTS="-n pi-den"`) {
+		t.Errorf("GET /answers/pi-den = %d\n%s", rec.Code, rec.Body.String())
+	}
+
+	cfg.Password = ""
+	if _, _, err := answerServer("", false, nil, io.Discard); err == nil || !strings.Contains(err.Error(), "password cannot be empty") {
+		t.Errorf("answerServer() error = %v, want the invalid config rejected", err)
+	}
+}
+
+func TestAnswerServer_IPXE(t *testing.T) {
+	resetFlags(t)
+	defer resetFlags(t)
+
+	cfg.Hostname = "pi-den"
+	srv, _, err := answerServer("", true, &ipxe.Options{Flavor: "virt"}, io.Discard)
+	if err != nil {
+		t.Fatalf("answerServer() error = %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://10.0.0.2:8080/boot.ipxe", nil))
+	for _, want := range []string{
+		"vmlinuz-virt",
+		"apkovl=http://10.0.0.2:8080/apkovl/pi-den.apkovl.tar.gz",
+		"alpine_hero_answers=http://10.0.0.2:8080/answers/pi-den\n",
+	} {
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("GET /boot.ipxe = %d, body missing %q\n%s", rec.Code, want, rec.Body.String())
+		}
+	}
+	// the scripts are public, so they do not carry the token
+	if strings.Contains(rec.Body.String(), srv.Token("pi-den")) {
+		t.Errorf("GET /boot.ipxe serves the token of pi-den\n%s", rec.Body.String())
+	}
+
+	// the overlay is served without a token and without the answer file
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/apkovl/pi-den.apkovl.tar.gz", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+		t.Fatalf("GET /apkovl/pi-den.apkovl.tar.gz = %d", rec.Code)
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Name == apkovl.AnswersPath && h.Size != 0 {
+			t.Errorf("overlay answer file has %d bytes, want it empty", h.Size)
+		}
+	}
+}
+
+func TestDefaultBaseURL(t *testing.T) {
+	name, _ := os.Hostname()
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"127.0.0.1:8080", "http://127.0.0.1:8080"},
+		{"[::1]:8080", "http://[::1]:8080"},
+		{"0.0.0.0:8080", "http://" + net.JoinHostPort(name, "8080")},
+		{"[::]:9000", "http://" + net.JoinHostPort(name, "9000")},
+	}
+	for _, tt := range tests {
+		addr, err := net.ResolveTCPAddr("tcp", tt.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := defaultBaseURL(addr); got != tt.want {
+			t.Errorf("defaultBaseURL(%s) = %s, want %s", tt.addr, got, tt.want)
+		}
+	}
+}
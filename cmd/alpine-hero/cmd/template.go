@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/btassone/alpine-hero/internal/generator"
+	"github.com/btassone/alpine-hero/templates"
+	"github.com/spf13/cobra"
+)
+
+func newTemplateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "template",
+		Short: "Work with answer file templates",
+		Long: `Commands for customising the answer file template.
+
+The built-in template is used unless generate is given --template or the
+TEMPLATE_DIR environment variable names a directory containing answers.tmpl.`,
+	}
+
+	cmd.AddCommand(newTemplateExportCmd())
+	cmd.AddCommand(newTemplateLintCmd())
+
+	return cmd
+}
+
+func newTemplateExportCmd() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "export [FILE]",
+		Short: "Write the built-in template to disk for customisation",
+		Long: `Write the built-in answer file template to FILE (answers.tmpl by default) so it
+can be edited and passed back to generate with --template.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "answers.tmpl"
+			if len(args) > 0 {
+				path = args[0]
+			}
+
+			flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+			if force {
+				flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			}
+			f, err := os.OpenFile(path, flags, 0644)
+			if err != nil {
+				if os.IsExist(err) {
+					return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+				}
+				return fmt.Errorf("failed to create template file: %w", err)
+			}
+			if _, err := f.WriteString(templates.Answers); err != nil {
+				_ = f.Close()
+				return fmt.Errorf("failed to write template file: %w", err)
+			}
+			if err := f.Close(); err != nil {
+				return fmt.Errorf("failed to write template file: %w", err)
+			}
+
+			cmd.Printf("Exported built-in template to %s\n", path)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite an existing file")
+
+	return cmd
+}
+
+func newTemplateLintCmd() *cobra.Command {
+	var (
+		partials string
+		strict   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "lint [FILE]",
+		Short: "Check a template against the configuration schema",
+		Long: `Statically check an answer file template without rendering it.
+
+Every field reference is resolved against the configuration, including fields
+reached through range and with blocks and partials. Unknown fields are errors.
+Configuration fields the template never uses and interpolations that are not
+passed through shellEscape or quote are reported as warnings.
+
+FILE defaults to the template generate would use.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var path string
+			if len(args) > 0 {
+				path = args[0]
+			}
+
+			gen := generator.New(cfg, "", generator.WithTemplate(path), generator.WithPartials(partials))
+			issues, err := gen.Lint()
+			if err != nil {
+				return err
+			}
+
+			var errs, warnings int
+			for _, issue := range issues {
+				cmd.Println(issue)
+				if issue.Severity == generator.SeverityError {
+					errs++
+				} else {
+					warnings++
+				}
+			}
+
+			if errs > 0 || (strict && warnings > 0) {
+				return fmt.Errorf("template has %d error(s) and %d warning(s)", errs, warnings)
+			}
+			if len(issues) == 0 {
+				cmd.Println("Template is valid")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&partials, "partials", "", "Directory of partial templates to load")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Fail on warnings as well as errors")
+
+	return cmd
+}
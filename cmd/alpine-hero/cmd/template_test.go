@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/templates"
+)
+
+func TestTemplateExportCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "answers.tmpl")
+
+	rootCmd.SetArgs([]string{"template", "export", path})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("template export error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != templates.Answers {
+		t.Errorf("exported template differs from the built-in one")
+	}
+
+	rootCmd.SetArgs([]string{"template", "export", path})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "use --force") {
+		t.Errorf("template export error = %v, want refusal to overwrite", err)
+	}
+
+	if err := os.WriteFile(path, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetArgs([]string{"template", "export", "--force", path})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("template export --force error = %v", err)
+	}
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != templates.Answers {
+		t.Errorf("--force did not overwrite the template")
+	}
+}
+
+func TestGenerateCommand_TemplateFlag(t *testing.T) {
+	tmpDir := t.TempDir()
+	resetFlags(t)
+	defer func() {
+		templateFile = ""
+		resetFlags(t)
+	}()
+
+	tmpl := filepath.Join(tmpDir, "custom.tmpl")
+	if err := os.WriteFile(tmpl, []byte(`CUSTOM="{{ shellEscape .Hostname }}"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(tmpDir, "answers.txt")
+
+	rootCmd.SetArgs([]string{"generate", "--template", tmpl, "--hostname", "custom-host", "--output", output})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `CUSTOM="custom-host"` {
+		t.Errorf("generated file = %q, want the custom template output", data)
+	}
+}
+
+func TestTemplateLintCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	clean := filepath.Join(tmpDir, "clean.tmpl")
+	if err := os.WriteFile(clean, []byte(templates.Answers), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetArgs([]string{"template", "lint", clean})
+	if err := rootCmd.Execute(); err != nil {
+		t.Errorf("template lint of the built-in template error = %v", err)
+	}
+
+	warnings := filepath.Join(tmpDir, "warnings.tmpl")
+	if err := os.WriteFile(warnings, []byte(`HOSTNAMEOPTS="-n {{ .Hostname }}"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetArgs([]string{"template", "lint", warnings})
+	if err := rootCmd.Execute(); err != nil {
+		t.Errorf("template lint with warnings error = %v, want success", err)
+	}
+	rootCmd.SetArgs([]string{"template", "lint", "--strict", warnings})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "0 error(s)") {
+		t.Errorf("template lint --strict error = %v, want failure on warnings", err)
+	}
+
+	typo := filepath.Join(tmpDir, "typo.tmpl")
+	if err := os.WriteFile(typo, []byte(`HOSTNAMEOPTS="-n {{ shellEscape .Hostnme }}"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetArgs([]string{"template", "lint", typo})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "1 error(s)") {
+		t.Errorf("template lint error = %v, want 1 error", err)
+	}
+}
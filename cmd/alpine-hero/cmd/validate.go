@@ -1,16 +1,93 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/parser"
 	"github.com/spf13/cobra"
 )
 
 func newValidateCmd() *cobra.Command {
-	return &cobra.Command{
+	var answersFile string
+
+	cmd := &cobra.Command{
 		Use:   "validate",
 		Short: "Validate the current configuration",
-		Long:  `Check if the current configuration values are valid for Alpine Linux installation.`,
+		Long: `Check if the current configuration values are valid for Alpine Linux installation.
+
+With --answers, an existing setup-alpine answer file is checked instead: its
+known variables are mapped back into a configuration and validated, and unknown
+variables, malformed quoting and missing mandatory variables are reported with
+their line numbers. The SSH key file an answer file names is not read, only
+the format of the setting is checked.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if answersFile != "" {
+				return validateAnswers(cmd.OutOrStdout(), answersFile)
+			}
 			return cfg.Validate()
 		},
 	}
+
+	cmd.Flags().StringVar(&answersFile, "answers", "", "Validate an existing answer file instead of the flags")
+
+	return cmd
+}
+
+// validateAnswers reports every problem found in an answer file and returns
+// an error if there was at least one
+func validateAnswers(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open answer file: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var problems parser.ErrorList
+	file, err := parser.Parse(f)
+	if err != nil {
+		var list parser.ErrorList
+		if !errors.As(err, &list) {
+			return err
+		}
+		problems = append(problems, list...)
+	}
+	problems = append(problems, file.Check()...)
+
+	answers, err := file.Config()
+	if err != nil {
+		var list parser.ErrorList
+		if errors.As(err, &list) {
+			problems = append(problems, list...)
+		}
+	}
+	// the SSH key of a foreign answer file names a file on the machine it
+	// was written for, so only its format is checked and no local file is read
+	key := answers.SSHKey
+	answers.SSHKey = ""
+	for _, err := range []error{answers.Validate(), config.ValidateSSHKeyFormat(key)} {
+		if err != nil {
+			problems = append(problems, &parser.Error{Msg: err.Error()})
+		}
+	}
+
+	if len(problems) == 0 {
+		_, err := fmt.Fprintf(w, "%s: answer file is valid\n", path)
+		return err
+	}
+
+	problems.Sort()
+	for _, p := range problems {
+		if p.Line > 0 {
+			_, _ = fmt.Fprintf(w, "%s:%d: %s\n", path, p.Line, p.Msg)
+		} else {
+			_, _ = fmt.Fprintf(w, "%s: %s\n", path, p.Msg)
+		}
+	}
+	return fmt.Errorf("answer file %s has %d problem(s)", path, len(problems))
 }
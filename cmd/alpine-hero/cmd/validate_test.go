@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateCommand_Answers(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "alpine-hero-validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(path string) {
+		err := os.RemoveAll(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}(tmpDir)
+
+	tests := []struct {
+		name     string
+		content  string
+		wantErr  bool
+		contains []string
+	}{
+		{
+			name: "valid answer file",
+			content: `KEYMAPOPTS="us us"
+HOSTNAMEOPTS="-n test-host"
+DISKOPTS="-m sys /dev/sda"
+USEROPTS="-a -u -g audio,video testuser"
+PWUSER="testpass"
+`,
+			contains: []string{"answer file is valid"},
+		},
+		{
+			name: "ssh key file is not read",
+			content: `KEYMAPOPTS="us us"
+HOSTNAMEOPTS="-n test-host"
+DISKOPTS="-m sys /dev/sda"
+USEROPTS="-a -u -g audio,video testuser"
+PWUSER="testpass"
+SSHKEY="/nonexistent/.ssh/id_ed25519.pub"
+`,
+			contains: []string{"answer file is valid"},
+		},
+		{
+			name: "malformed ssh key",
+			content: `KEYMAPOPTS="us us"
+HOSTNAMEOPTS="-n test-host"
+DISKOPTS="-m sys /dev/sda"
+USEROPTS="-a -u -g audio,video testuser"
+PWUSER="testpass"
+SSHKEY="not a key"
+`,
+			wantErr:  true,
+			contains: []string{"answers.txt: invalid SSH public key format"},
+		},
+		{
+			name: "problems are reported with line numbers",
+			content: `KEYMAPOPTS="us us"
+FOO="bar"
+DISKOPTS="-m sys /dev/sda"
+PWUSER="secret
+`,
+			wantErr: true,
+			contains: []string{
+				"answers.txt:2: unknown variable FOO",
+				"answers.txt:4: unterminated double quote",
+				"answers.txt: missing mandatory variable HOSTNAMEOPTS",
+				"answers.txt: missing mandatory variable USEROPTS",
+				"answers.txt: hostname cannot be empty",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, "answers.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			err := validateAnswers(&buf, path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateAnswers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			output := buf.String()
+			for _, want := range tt.contains {
+				if !strings.Contains(output, want) {
+					t.Errorf("output missing %q\ngot: %s", want, output)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/btassone/alpine-hero/internal/verify"
+	"github.com/spf13/cobra"
+)
+
+// secretVariables are answer variables whose values are never printed
+var secretVariables = map[string]bool{
+	"PWUSER": true,
+}
+
+func newVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify [ANSWERS]",
+		Short: "Check what setup-alpine will see in an answer file",
+		Long: `Source an answer file in /bin/sh with an empty environment, the way setup-alpine
+does, and compare every answer variable with the value expected from the
+configuration. Any difference is reported and makes the command fail.
+
+The expected values are built from the configuration, which is taken from
+--config and the same flags as generate. An answer file generated with
+--template is verified with the same --template and --partials: only the
+variables that template sets are compared. The answer file defaults to
+answers.txt.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "answers.txt"
+			if len(args) > 0 {
+				path = args[0]
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 10*time.Second)
+			defer cancel()
+
+			want := verify.Expected(cfg)
+			got, err := verify.Source(ctx, path)
+			if err != nil {
+				return err
+			}
+			if templateFile != "" {
+				rendered, err := renderAnswers(cfg)
+				if err != nil {
+					return err
+				}
+				set, err := verify.Variables(rendered)
+				if err != nil {
+					return err
+				}
+				want = verify.Only(want, set)
+				got = verify.Only(got, want)
+			}
+			mismatches := verify.Compare(want, got)
+			if len(mismatches) == 0 {
+				cmd.Printf("%s: all answer variables match the configuration\n", path)
+				return nil
+			}
+
+			printMismatches(cmd.ErrOrStderr(), mismatches)
+			return fmt.Errorf("answer file %s does not match the configuration: %d variable(s) differ", path, len(mismatches))
+		},
+	}
+
+	addConfigFlags(cmd)
+	cmd.Flags().StringVar(&templateFile, "template", "", "Template file the answer file was generated with")
+	cmd.Flags().StringVar(&partialsDir, "partials", "", "Directory of *.tmpl partials available to the template")
+
+	return cmd
+}
+
+func printMismatches(w io.Writer, mismatches []verify.Mismatch) {
+	show := func(name, value string, set bool) string {
+		switch {
+		case !set:
+			return "(unset)"
+		case secretVariables[name]:
+			return "(hidden)"
+		}
+		return fmt.Sprintf("%q", value)
+	}
+
+	for _, m := range mismatches {
+		_, _ = fmt.Fprintf(w, "%s:\n  expected: %s\n  got:      %s\n", m.Name, show(m.Name, m.Want, m.WantSet), show(m.Name, m.Got, m.GotSet))
+	}
+}
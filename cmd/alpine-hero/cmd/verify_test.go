@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/verify"
+)
+
+func TestVerifyCommand(t *testing.T) {
+	if _, err := os.Stat(verify.Shell); err != nil {
+		t.Skipf("%s is not available", verify.Shell)
+	}
+	tmpDir := t.TempDir()
+	resetFlags(t)
+	defer resetFlags(t)
+
+	output := filepath.Join(tmpDir, "answers.txt")
+	rootCmd.SetArgs([]string{"generate", "--hostname", "verify-host", "--password", "s3cr$t", "--output", output})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+
+	var stderr bytes.Buffer
+	rootCmd.SetErr(&stderr)
+	defer rootCmd.SetErr(nil)
+
+	rootCmd.SetArgs([]string{"verify", "--hostname", "verify-host", "--password", "s3cr$t", output})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("verify error = %v\nstderr: %s", err, stderr.String())
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(data), `PWUSER="s3cr\$t"`, `PWUSER="other"`, 1)
+	tampered = strings.Replace(tampered, "-n verify-host", "-n other-host", 1)
+	if err := os.WriteFile(output, []byte(tampered), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stderr.Reset()
+	rootCmd.SetArgs([]string{"verify", "--hostname", "verify-host", "--password", "s3cr$t", output})
+	err = rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "2 variable(s) differ") {
+		t.Fatalf("verify error = %v, want 2 differing variables", err)
+	}
+	for _, want := range []string{
+		"HOSTNAMEOPTS:\n  expected: \"-n verify-host\"\n  got:      \"-n other-host\"",
+		"PWUSER:\n  expected: (hidden)\n  got:      (hidden)",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("stderr missing %q\ngot: %s", want, stderr.String())
+		}
+	}
+	if strings.Contains(stderr.String(), "s3cr$t") {
+		t.Errorf("stderr leaks the password: %s", stderr.String())
+	}
+}
+
+func TestVerifyCommand_Template(t *testing.T) {
+	if _, err := os.Stat(verify.Shell); err != nil {
+		t.Skipf("%s is not available", verify.Shell)
+	}
+	tmpDir := t.TempDir()
+	resetFlags(t)
+	var stderr bytes.Buffer
+	rootCmd.SetErr(&stderr)
+	defer func() {
+		rootCmd.SetErr(nil)
+		resetFlags(t)
+	}()
+
+	tmpl := filepath.Join(tmpDir, "custom.tmpl")
+	content := `HOSTNAMEOPTS="-n {{ shellEscape .Hostname }}"
+DNSOPTS="-d example.com 10.0.0.1"
+PWUSER="{{ shellEscape .Password }}"
+`
+	if err := os.WriteFile(tmpl, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(tmpDir, "answers.txt")
+	rootCmd.SetArgs([]string{"generate", "--template", tmpl, "--hostname", "custom-host", "--password", "s3cr$t", "--output", output})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+
+	rootCmd.SetArgs([]string{"verify", "--template", tmpl, "--hostname", "custom-host", "--password", "s3cr$t", output})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("verify --template error = %v\nstderr: %s", err, stderr.String())
+	}
+
+	// the built-in template expects the variables the custom one leaves out
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"verify", "--hostname", "custom-host", "--password", "s3cr$t", output})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("verify without --template succeeded, want the built-in template's variables missing")
+	}
+}
@@ -0,0 +1,213 @@
+package ansible
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultGroup is the inventory group of the hosts when none is given
+const DefaultGroup = "alpine"
+
+// InventoryFile is the name of the inventory in the export directory
+const InventoryFile = "inventory.yml"
+
+// header is the first line of every generated file
+const header = "# Generated by alpine-hero from the same settings as the answer files.\n"
+
+// variables map config fields, by their yaml key, to the Ansible variables
+// they are exported as. Fields tagged secret:"true" are left out, or
+// exported as a reference to a vault_ prefixed variable with Options.Vault.
+var variables = []struct {
+	Field string
+	Name  string
+}{
+	{"hostname", "alpine_hero_hostname"},
+	{"username", "alpine_hero_user"},
+	{"password", "alpine_hero_password"},
+	{"groups", "alpine_hero_user_groups"},
+	{"ssh_key", "alpine_hero_ssh_key_file"},
+	{"timezone", "alpine_hero_timezone"},
+	{"keymap", "alpine_hero_keymap"},
+	{"interface", "alpine_hero_interface"},
+	{"address", "alpine_hero_address"},
+	{"gateway", "alpine_hero_gateway"},
+	{"dns", "alpine_hero_dns"},
+	{"disk", "alpine_hero_disk"},
+}
+
+// Options configure the export
+type Options struct {
+	// Group is the inventory group of the hosts, DefaultGroup if empty
+	Group string
+	// Vault exports secrets as references to vault_ prefixed variables,
+	// which are expected in an ansible-vault encrypted file, instead of
+	// leaving them out
+	Vault bool
+}
+
+// File is a file of the export, with a slash separated path relative to the
+// export directory
+type File struct {
+	Path string
+	Data []byte
+}
+
+// groupName matches the group names Ansible accepts without warnings
+var groupName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Files returns the inventory listing hosts in one group and a host_vars file
+// for every host
+func Files(hosts []*config.Config, opts Options) ([]File, error) {
+	group := opts.Group
+	if group == "" {
+		group = DefaultGroup
+	}
+	if !groupName.MatchString(group) {
+		return nil, fmt.Errorf("invalid group name %q, it must be letters, digits and underscores and not start with a digit", group)
+	}
+
+	members := &yaml.Node{Kind: yaml.MappingNode}
+	var files []File
+	seen := make(map[string]bool)
+	for _, cfg := range hosts {
+		if cfg.Hostname == "" {
+			return nil, fmt.Errorf("a host has no hostname")
+		}
+		if seen[cfg.Hostname] {
+			return nil, fmt.Errorf("duplicate hostname %s", cfg.Hostname)
+		}
+		seen[cfg.Hostname] = true
+
+		vars, err := HostVars(cfg, opts.Vault)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Path: path.Join("host_vars", cfg.Hostname+".yml"), Data: vars})
+		members.Content = append(members.Content, scalar(cfg.Hostname), &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle})
+	}
+
+	inv := mapping("all", mapping("children", mapping(group, mapping("hosts", members))))
+	data, err := encode(inv)
+	if err != nil {
+		return nil, err
+	}
+	return append([]File{{Path: InventoryFile, Data: data}}, files...), nil
+}
+
+// HostVars returns the host_vars file of cfg. Besides the variables it sets
+// the connection variables, ansible_host for a static address, and the
+// derived alpine_hero_network and alpine_hero_packages.
+func HostVars(cfg *config.Config, vault bool) ([]byte, error) {
+	vars := &yaml.Node{Kind: yaml.MappingNode}
+	add := func(name string, value any) error {
+		var v yaml.Node
+		if err := v.Encode(value); err != nil {
+			return fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		vars.Content = append(vars.Content, scalar(name), &v)
+		return nil
+	}
+
+	if cfg.Address != "" {
+		prefix, err := netip.ParsePrefix(cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", cfg.Address, err)
+		}
+		if err := add("ansible_host", prefix.Addr().String()); err != nil {
+			return nil, err
+		}
+	}
+	if err := add("ansible_user", cfg.Username); err != nil {
+		return nil, err
+	}
+	if err := add("ansible_become_method", "doas"); err != nil {
+		return nil, err
+	}
+	if vault {
+		if err := add("ansible_become_password", vaultRef("alpine_hero_password")); err != nil {
+			return nil, err
+		}
+	}
+
+	v := reflect.ValueOf(cfg).Elem()
+	for _, variable := range variables {
+		field, ok := fieldByKey(v.Type(), variable.Field)
+		if !ok {
+			return nil, fmt.Errorf("config has no field %s", variable.Field)
+		}
+		value := v.FieldByIndex(field.Index)
+		if value.IsZero() {
+			continue
+		}
+		out := value.Interface()
+		if field.Tag.Get("secret") == "true" {
+			if !vault {
+				continue
+			}
+			out = vaultRef(variable.Name)
+		}
+		if err := add(variable.Name, out); err != nil {
+			return nil, err
+		}
+	}
+
+	network := "dhcp"
+	if cfg.Address != "" {
+		network = "static"
+	}
+	if err := add("alpine_hero_network", network); err != nil {
+		return nil, err
+	}
+	if err := add("alpine_hero_packages", config.Packages()); err != nil {
+		return nil, err
+	}
+	return encode(vars)
+}
+
+// fieldByKey returns the field of t with the yaml key
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == key {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// vaultRef returns the Jinja reference to the vault variable of name
+func vaultRef(name string) string {
+	return "{{ vault_" + name + " }}"
+}
+
+func scalar(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: s}
+}
+
+// mapping returns a mapping node with a single key
+func mapping(key string, value *yaml.Node) *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{scalar(key), value}}
+}
+
+// encode returns node as YAML with a two space indent after the header
+func encode(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, fmt.Errorf("failed to encode Ansible variables: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode Ansible variables: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,155 @@
+package ansible
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+func TestFiles(t *testing.T) {
+	kitchen := config.New()
+	kitchen.Hostname = "pi-kitchen"
+	kitchen.Address = "10.20.0.50/24"
+	kitchen.Gateway = "10.20.0.1"
+	kitchen.DNS = []string{"10.20.0.1"}
+	kitchen.SSHKey = "/home/admin/.ssh/id_ed25519.pub"
+	garage := config.New()
+	garage.Hostname = "pi-garage"
+	garage.Password = "s3cret"
+
+	files, err := Files([]*config.Config{kitchen, garage}, Options{Group: "pis"})
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+		for _, secret := range []string{"changeme", "s3cret", "password"} {
+			if strings.Contains(string(f.Data), secret) {
+				t.Errorf("%s contains %q:\n%s", f.Path, secret, f.Data)
+			}
+		}
+	}
+	if got := strings.Join(paths, " "); got != "inventory.yml host_vars/pi-kitchen.yml host_vars/pi-garage.yml" {
+		t.Errorf("Files() = %s", got)
+	}
+
+	wantInventory := header + `all:
+  children:
+    pis:
+      hosts:
+        pi-kitchen: {}
+        pi-garage: {}
+`
+	if string(files[0].Data) != wantInventory {
+		t.Errorf("inventory =\n%s\nwant\n%s", files[0].Data, wantInventory)
+	}
+
+	wantVars := header + `ansible_host: 10.20.0.50
+ansible_user: alpine
+ansible_become_method: doas
+alpine_hero_hostname: pi-kitchen
+alpine_hero_user: alpine
+alpine_hero_user_groups:
+  - audio
+  - video
+  - netdev
+alpine_hero_ssh_key_file: /home/admin/.ssh/id_ed25519.pub
+alpine_hero_timezone: UTC
+alpine_hero_keymap: us
+alpine_hero_interface: eth0
+alpine_hero_address: 10.20.0.50/24
+alpine_hero_gateway: 10.20.0.1
+alpine_hero_dns:
+  - 10.20.0.1
+alpine_hero_disk: /dev/mmcblk0
+alpine_hero_network: static
+alpine_hero_packages:
+  - chrony
+  - doas
+  - openssh
+`
+	if string(files[1].Data) != wantVars {
+		t.Errorf("host_vars =\n%s\nwant\n%s", files[1].Data, wantVars)
+	}
+
+	var vars map[string]any
+	if err := yaml.Unmarshal(files[2].Data, &vars); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := vars["ansible_host"]; ok || vars["alpine_hero_network"] != "dhcp" {
+		t.Errorf("DHCP host vars = %v, want no ansible_host", vars)
+	}
+}
+
+func TestHostVars_Vault(t *testing.T) {
+	cfg := config.New()
+	cfg.Password = "s3cret"
+
+	data, err := HostVars(cfg, true)
+	if err != nil {
+		t.Fatalf("HostVars() error = %v", err)
+	}
+	if strings.Contains(string(data), "s3cret") {
+		t.Errorf("HostVars() writes the password in clear:\n%s", data)
+	}
+	var vars map[string]any
+	if err := yaml.Unmarshal(data, &vars); err != nil {
+		t.Fatal(err)
+	}
+	want := "{{ vault_alpine_hero_password }}"
+	if vars["alpine_hero_password"] != want || vars["ansible_become_password"] != want {
+		t.Errorf("vault references = %v, %v, want %s", vars["alpine_hero_password"], vars["ansible_become_password"], want)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	// every mapped field exists, and every secret config field is mapped so
+	// the vault handling applies to it
+	mapped := make(map[string]bool)
+	typ := reflect.TypeOf(config.Config{})
+	for _, v := range variables {
+		if _, ok := fieldByKey(typ, v.Field); !ok {
+			t.Errorf("variable %s maps the unknown field %s", v.Name, v.Field)
+		}
+		if !strings.HasPrefix(v.Name, "alpine_hero_") {
+			t.Errorf("variable %s is not prefixed with alpine_hero_", v.Name)
+		}
+		mapped[v.Field] = true
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		key, _, _ := strings.Cut(typ.Field(i).Tag.Get("yaml"), ",")
+		if typ.Field(i).Tag.Get("secret") == "true" && !mapped[key] {
+			t.Errorf("secret field %s is not mapped", key)
+		}
+	}
+}
+
+func TestFiles_Errors(t *testing.T) {
+	named := func(name string) *config.Config {
+		cfg := config.New()
+		cfg.Hostname = name
+		return cfg
+	}
+	tests := []struct {
+		name    string
+		hosts   []*config.Config
+		opts    Options
+		wantErr string
+	}{
+		{name: "invalid group", hosts: []*config.Config{named("a")}, opts: Options{Group: "pi-fleet"}, wantErr: "invalid group name"},
+		{name: "duplicate hostname", hosts: []*config.Config{named("a"), named("a")}, wantErr: "duplicate hostname a"},
+		{name: "no hostname", hosts: []*config.Config{named("")}, wantErr: "has no hostname"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Files(tt.hosts, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Files() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package apkovl
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/generator"
+)
+
+// AnswersPath is where the answer file is stored in the overlay
+const AnswersPath = "etc/alpine-hero/answers"
+
+// StartScript is the local.d script that installs the system on first boot
+const StartScript = "etc/local.d/alpine-hero.start"
+
+// AnswersParam is the kernel parameter giving the URL of an answer file to
+// install with instead of the one in the overlay, for example one served by
+// alpine-hero serve to a network booted machine
+const AnswersParam = "alpine_hero_answers"
+
+// File is an entry of the overlay. Paths are relative to the root of the
+// system the overlay is extracted on.
+type File struct {
+	Path string
+	Mode fs.FileMode
+	Data []byte
+	// Link is the target of a symbolic link, in which case Data is unused
+	Link string
+}
+
+// startScript runs setup-alpine with the answer file once per boot. It
+// removes itself and the answer file first, so a failed install drops to a
+// normal login instead of retrying, and keeps a log for that case. Only the
+// running system forgets them though: the overlay is extracted from the boot
+// media again on every boot, so booting from the media again erases the disk
+// and installs again. The answer file is fetched from the URL of the
+// AnswersParam kernel parameter if there is one, and an empty answer file
+// needs that parameter.
+const startScript = `#!/bin/sh
+# Installs Alpine Linux unattended on first boot. Written by alpine-hero.
+
+answers=/` + AnswersPath + `
+[ -f "$answers" ] || exit 0
+
+cp "$answers" /tmp/alpine-hero-answers
+rm -f "$answers" "$0"
+
+exec >/var/log/alpine-hero-setup.log 2>&1
+set -f
+for arg in $(cat /proc/cmdline); do
+	case "$arg" in
+	` + AnswersParam + `=*)
+		wget -q -O /tmp/alpine-hero-answers "${arg#*=}" || exit 1
+		;;
+	esac
+done
+if [ ! -s /tmp/alpine-hero-answers ]; then
+	echo "no answer file, boot with ` + AnswersParam + `=URL"
+	exit 1
+fi
+ERASE_DISKS=%s setup-alpine -e -f /tmp/alpine-hero-answers && reboot
+`
+
+// Files returns the overlay for cfg: the answer file, the start script and
+// the services needed to run it, the network configuration, nameservers and
+// hostname for the first boot, and root's authorized keys if cfg has an SSH
+// key
+func Files(cfg *config.Config, answers []byte) ([]File, error) {
+	disk, err := generator.Quote(cfg.DiskDevice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to quote disk: %w", err)
+	}
+	files := []File{
+		{Path: "etc/hostname", Mode: 0644, Data: []byte(cfg.Hostname + "\n")},
+		{Path: "etc/network/interfaces", Mode: 0644, Data: []byte(Interfaces(cfg))},
+		{Path: AnswersPath, Mode: 0600, Data: answers},
+		{Path: StartScript, Mode: 0755, Data: []byte(fmt.Sprintf(startScript, disk))},
+		// Alpine only enables its default services for an overlay that asks
+		// for them with this file
+		{Path: "etc/.default_boot_services", Mode: 0644},
+		{Path: "etc/runlevels/boot/networking", Mode: 0777, Link: "/etc/init.d/networking"},
+		{Path: "etc/runlevels/default/local", Mode: 0777, Link: "/etc/init.d/local"},
+	}
+
+	if len(cfg.DNS) > 0 {
+		var resolv strings.Builder
+		for _, ns := range cfg.DNS {
+			fmt.Fprintf(&resolv, "nameserver %s\n", ns)
+		}
+		files = append(files, File{Path: "etc/resolv.conf", Mode: 0644, Data: []byte(resolv.String())})
+	}
+	if cfg.SSHKey != "" {
+		key, err := os.ReadFile(cfg.SSHKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSH key file: %w", err)
+		}
+		if !bytes.HasSuffix(key, []byte("\n")) {
+			key = append(key, '\n')
+		}
+		files = append(files, File{Path: "root/.ssh/authorized_keys", Mode: 0600, Data: key})
+	}
+	return files, nil
+}
+
+// Interfaces returns the interfaces(5) file that brings up the network
+// interface of cfg the way the answer file configures it
+func Interfaces(cfg *config.Config) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "auto lo\niface lo inet loopback\n\nauto %s\n", cfg.NetworkIface)
+	if cfg.Address == "" {
+		fmt.Fprintf(&b, "iface %s inet dhcp\n", cfg.NetworkIface)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "iface %s inet static\n\taddress %s\n", cfg.NetworkIface, cfg.Address)
+	if cfg.Gateway != "" {
+		fmt.Fprintf(&b, "\tgateway %s\n", cfg.Gateway)
+	}
+	return b.String()
+}
+
+// Write writes files as a gzip compressed tarball owned by root, with every
+// entry timestamped modTime. Only the parent directories whose mode matters
+// get an entry of their own, see dirMode; the others keep their mode on the
+// system the overlay is extracted on, or get the default of tar if missing.
+func Write(w io.Writer, files []File, modTime time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	dirs := make(map[string]bool)
+	var entries []*tar.Header
+	for _, f := range files {
+		for dir := path.Dir(f.Path); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+			if mode, ok := dirMode(dir); ok {
+				entries = append(entries, &tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: mode})
+			}
+		}
+	}
+	// parents sort before their children
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	data := make(map[string][]byte)
+	for _, f := range files {
+		h := &tar.Header{Typeflag: tar.TypeReg, Name: f.Path, Mode: int64(f.Mode.Perm()), Size: int64(len(f.Data))}
+		if f.Link != "" {
+			h = &tar.Header{Typeflag: tar.TypeSymlink, Name: f.Path, Linkname: f.Link, Mode: int64(f.Mode.Perm())}
+		}
+		data[f.Path] = f.Data
+		entries = append(entries, h)
+	}
+
+	for _, h := range entries {
+		h.Uname, h.Gname = "root", "root"
+		h.ModTime = modTime.Truncate(time.Second)
+		if err := tw.WriteHeader(h); err != nil {
+			return fmt.Errorf("failed to write overlay: %w", err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			if _, err := tw.Write(data[h.Name]); err != nil {
+				return fmt.Errorf("failed to write overlay: %w", err)
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write overlay: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write overlay: %w", err)
+	}
+	return nil
+}
+
+// dirMode returns the mode of the directories the overlay sets explicitly:
+// root's home and .ssh directories, which sshd wants private
+func dirMode(dir string) (int64, bool) {
+	if dir == "root" || path.Base(dir) == ".ssh" {
+		return 0700, true
+	}
+	return 0, false
+}
@@ -0,0 +1,178 @@
+package apkovl
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+// entry is a tar header reduced to what the tests check
+type entry struct {
+	name  string
+	mode  int64
+	typ   byte
+	link  string
+	owner string
+	data  string
+}
+
+func readTarball(t *testing.T, data []byte) []entry {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("not a gzip file: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var entries []entry
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid tarball: %v", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry{
+			name:  h.Name,
+			mode:  h.Mode,
+			typ:   h.Typeflag,
+			link:  h.Linkname,
+			owner: fmt.Sprintf("%d:%d %s:%s", h.Uid, h.Gid, h.Uname, h.Gname),
+			data:  string(content),
+		})
+	}
+	return entries
+}
+
+func TestWrite(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519.pub")
+	if err := os.WriteFile(keyPath, []byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5 admin@example.com"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.New()
+	cfg.Hostname = "pi-kitchen"
+	cfg.DiskDevice = "/dev/sda"
+	cfg.SSHKey = keyPath
+	cfg.DNS = []string{"10.20.0.1", "2001:db8::53"}
+
+	files, err := Files(cfg, []byte("HOSTNAMEOPTS=\"-n pi-kitchen\"\n"))
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	var buf bytes.Buffer
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := Write(&buf, files, modTime); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	var got []string
+	byName := make(map[string]entry)
+	for _, e := range readTarball(t, buf.Bytes()) {
+		got = append(got, fmt.Sprintf("%c %o %s", e.typ, e.mode, e.name))
+		byName[e.name] = e
+		if e.owner != "0:0 root:root" {
+			t.Errorf("%s is owned by %s, want root", e.name, e.owner)
+		}
+	}
+	want := []string{
+		"5 700 root/",
+		"5 700 root/.ssh/",
+		"0 644 etc/hostname",
+		"0 644 etc/network/interfaces",
+		"0 600 etc/alpine-hero/answers",
+		"0 755 etc/local.d/alpine-hero.start",
+		"0 644 etc/.default_boot_services",
+		"2 777 etc/runlevels/boot/networking",
+		"2 777 etc/runlevels/default/local",
+		"0 644 etc/resolv.conf",
+		"0 600 root/.ssh/authorized_keys",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if e := byName["etc/runlevels/default/local"]; e.link != "/etc/init.d/local" {
+		t.Errorf("local service link = %q", e.link)
+	}
+	if e := byName["etc/hostname"]; e.data != "pi-kitchen\n" {
+		t.Errorf("hostname = %q", e.data)
+	}
+	if e := byName["etc/resolv.conf"]; e.data != "nameserver 10.20.0.1\nnameserver 2001:db8::53\n" {
+		t.Errorf("resolv.conf = %q", e.data)
+	}
+	if e := byName[AnswersPath]; e.data != "HOSTNAMEOPTS=\"-n pi-kitchen\"\n" {
+		t.Errorf("answers = %q", e.data)
+	}
+	if e := byName["root/.ssh/authorized_keys"]; e.data != "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5 admin@example.com\n" {
+		t.Errorf("authorized_keys = %q", e.data)
+	}
+	script := byName[StartScript].data
+	for _, s := range []string{"#!/bin/sh\n", "answers=/etc/alpine-hero/answers\n", "alpine_hero_answers=*)", "ERASE_DISKS='/dev/sda' setup-alpine -e -f"} {
+		if !strings.Contains(script, s) {
+			t.Errorf("start script missing %q\n%s", s, script)
+		}
+	}
+	if sh, err := exec.LookPath("sh"); err == nil {
+		if out, err := exec.Command(sh, "-n", "-c", script).CombinedOutput(); err != nil {
+			t.Errorf("start script is not valid shell: %v\n%s", err, out)
+		}
+	}
+
+	// the same input gives the same tarball
+	var again bytes.Buffer
+	if err := Write(&again, files, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+		t.Error("Write() is not reproducible")
+	}
+}
+
+func TestFiles_Errors(t *testing.T) {
+	cfg := config.New()
+	cfg.SSHKey = filepath.Join(t.TempDir(), "missing.pub")
+	if _, err := Files(cfg, nil); err == nil || !strings.Contains(err.Error(), "failed to read SSH key file") {
+		t.Errorf("Files() error = %v, want the missing key reported", err)
+	}
+
+	cfg.SSHKey = ""
+	files, err := Files(cfg, nil)
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f.Path, "root/") {
+			t.Errorf("Files() without an SSH key contains %s", f.Path)
+		}
+	}
+}
+
+func TestInterfaces(t *testing.T) {
+	cfg := config.New()
+	if got, want := Interfaces(cfg), "auto lo\niface lo inet loopback\n\nauto eth0\niface eth0 inet dhcp\n"; got != want {
+		t.Errorf("Interfaces() = %q, want %q", got, want)
+	}
+
+	cfg.NetworkIface = "wlan0"
+	cfg.Address = "10.20.0.50/24"
+	cfg.Gateway = "10.20.0.1"
+	want := "auto lo\niface lo inet loopback\n\nauto wlan0\niface wlan0 inet static\n\taddress 10.20.0.50/24\n\tgateway 10.20.0.1\n"
+	if got := Interfaces(cfg); got != want {
+		t.Errorf("Interfaces() = %q, want %q", got, want)
+	}
+}
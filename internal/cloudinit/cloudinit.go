@@ -0,0 +1,251 @@
+package cloudinit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/netip"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/passwd"
+	"gopkg.in/yaml.v3"
+)
+
+// Names of the files of a NoCloud seed
+const (
+	UserData      = "user-data"
+	MetaData      = "meta-data"
+	NetworkConfig = "network-config"
+)
+
+// Label is the volume label NoCloud looks for on a seed disk
+const Label = "CIDATA"
+
+// mapped are the yaml names of the config fields that have a NoCloud
+// equivalent. Every other field is reported by Render when it is set.
+var mapped = map[string]bool{
+	"hostname":  true,
+	"username":  true,
+	"password":  true,
+	"timezone":  true,
+	"keymap":    true,
+	"interface": true,
+	"groups":    true,
+	"ssh_key":   true,
+	"address":   true,
+	"gateway":   true,
+	"dns":       true,
+}
+
+// Seed is a rendered NoCloud seed
+type Seed struct {
+	UserData      []byte
+	MetaData      []byte
+	NetworkConfig []byte
+	// Unmapped holds the yaml names of the config fields that are set but
+	// have no cloud-init equivalent, such as the install disk
+	Unmapped []string
+}
+
+// File is a file of a NoCloud seed
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Files returns the files of the seed
+func (s *Seed) Files() []File {
+	return []File{
+		{Name: MetaData, Data: s.MetaData},
+		{Name: UserData, Data: s.UserData},
+		{Name: NetworkConfig, Data: s.NetworkConfig},
+	}
+}
+
+type userData struct {
+	Hostname string    `yaml:"hostname"`
+	Timezone string    `yaml:"timezone,omitempty"`
+	Keyboard *keyboard `yaml:"keyboard,omitempty"`
+	Users    []user    `yaml:"users"`
+	Packages []string  `yaml:"packages"`
+	NTP      ntp       `yaml:"ntp"`
+}
+
+type keyboard struct {
+	Layout string `yaml:"layout"`
+}
+
+type user struct {
+	Name              string   `yaml:"name"`
+	Groups            []string `yaml:"groups,omitempty"`
+	Shell             string   `yaml:"shell"`
+	LockPasswd        bool     `yaml:"lock_passwd"`
+	HashedPasswd      string   `yaml:"hashed_passwd,omitempty"`
+	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys,omitempty"`
+	Doas              []string `yaml:"doas"`
+}
+
+type ntp struct {
+	Enabled   bool   `yaml:"enabled"`
+	NTPClient string `yaml:"ntp_client"`
+}
+
+type metaData struct {
+	InstanceID    string `yaml:"instance-id"`
+	LocalHostname string `yaml:"local-hostname"`
+}
+
+type networkConfig struct {
+	Version   int                 `yaml:"version"`
+	Ethernets map[string]ethernet `yaml:"ethernets"`
+}
+
+type ethernet struct {
+	DHCP4       bool         `yaml:"dhcp4,omitempty"`
+	Addresses   []string     `yaml:"addresses,omitempty"`
+	Routes      []route      `yaml:"routes,omitempty"`
+	Nameservers *nameservers `yaml:"nameservers,omitempty"`
+}
+
+type nameservers struct {
+	Addresses []string `yaml:"addresses"`
+}
+
+type route struct {
+	To  string `yaml:"to"`
+	Via string `yaml:"via"`
+}
+
+// Render renders cfg as a NoCloud seed. The main user is an admin like the
+// one setup-alpine creates, in the wheel group and allowed to use doas, and
+// its password is stored as a SHA-512 crypt hash.
+func Render(cfg *config.Config) (*Seed, error) {
+	u := user{
+		Name:       cfg.Username,
+		Groups:     adminGroups(cfg.Groups),
+		Shell:      "/bin/ash",
+		LockPasswd: cfg.Password == "",
+		Doas:       []string{"permit persist " + cfg.Username + " as root"},
+	}
+	if cfg.Password != "" {
+		hash, err := passwd.Hash(cfg.Password)
+		if err != nil {
+			return nil, err
+		}
+		u.HashedPasswd = hash
+	}
+	if cfg.SSHKey != "" {
+		keys, err := readKeys(cfg.SSHKey)
+		if err != nil {
+			return nil, err
+		}
+		u.SSHAuthorizedKeys = keys
+	}
+
+	ud := userData{
+		Hostname: cfg.Hostname,
+		Timezone: cfg.Timezone,
+		Users:    []user{u},
+		Packages: config.Packages(),
+		NTP:      ntp{Enabled: true, NTPClient: "chrony"},
+	}
+	if cfg.Keymap != "" {
+		ud.Keyboard = &keyboard{Layout: cfg.Keymap}
+	}
+
+	seed := &Seed{Unmapped: unmapped(cfg)}
+	var err error
+	if seed.UserData, err = marshal("#cloud-config", ud); err != nil {
+		return nil, err
+	}
+	md := metaData{InstanceID: "iid-" + cfg.Hostname, LocalHostname: cfg.Hostname}
+	if seed.MetaData, err = marshal("", md); err != nil {
+		return nil, err
+	}
+	if seed.NetworkConfig, err = marshal("", network(cfg)); err != nil {
+		return nil, err
+	}
+	return seed, nil
+}
+
+// network returns the network-config v2 for the interface of cfg
+func network(cfg *config.Config) networkConfig {
+	eth := ethernet{DHCP4: true}
+	if cfg.Address != "" {
+		eth = ethernet{Addresses: []string{cfg.Address}}
+		if cfg.Gateway != "" {
+			to := "0.0.0.0/0"
+			if gw, err := netip.ParseAddr(cfg.Gateway); err == nil && gw.Is6() {
+				to = "::/0"
+			}
+			eth.Routes = []route{{To: to, Via: cfg.Gateway}}
+		}
+	}
+	if len(cfg.DNS) > 0 {
+		eth.Nameservers = &nameservers{Addresses: cfg.DNS}
+	}
+	return networkConfig{Version: 2, Ethernets: map[string]ethernet{cfg.NetworkIface: eth}}
+}
+
+// adminGroups returns groups with wheel added, as setup-user -a does
+func adminGroups(groups []string) []string {
+	for _, g := range groups {
+		if g == "wheel" {
+			return groups
+		}
+	}
+	return append(append([]string{}, groups...), "wheel")
+}
+
+// readKeys returns the public keys in an SSH key file, skipping comments
+// and blank lines
+func readKeys(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key file: %w", err)
+	}
+	var keys []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			keys = append(keys, line)
+		}
+	}
+	return keys, nil
+}
+
+// unmapped returns the yaml names of the fields of cfg that are set but not
+// part of the seed
+func unmapped(cfg *config.Config) []string {
+	var names []string
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		if !mapped[name] && !v.Field(i).IsZero() {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// marshal encodes v as YAML with a two space indent, after a header line
+// if one is given
+func marshal(header string, v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if header != "" {
+		buf.WriteString(header + "\n")
+	}
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to encode cloud-init data: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode cloud-init data: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,180 @@
+package cloudinit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRender(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "keys.pub")
+	keys := "# admin keys\nssh-ed25519 AAAAC3NzaC1lZDI1NTE5 admin@example.com\n\nssh-rsa AAAAB3NzaC1yc2E backup@example.com\n"
+	if err := os.WriteFile(keyPath, []byte(keys), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.New()
+	cfg.Hostname = "vm-build"
+	cfg.Timezone = "Europe/Berlin"
+	cfg.SSHKey = keyPath
+
+	seed, err := Render(cfg)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	if !strings.HasPrefix(string(seed.UserData), "#cloud-config\n") {
+		t.Errorf("user-data does not start with #cloud-config:\n%s", seed.UserData)
+	}
+	var ud map[string]any
+	if err := yaml.Unmarshal(seed.UserData, &ud); err != nil {
+		t.Fatalf("user-data is not YAML: %v", err)
+	}
+	if ud["hostname"] != "vm-build" || ud["timezone"] != "Europe/Berlin" {
+		t.Errorf("user-data = %v", ud)
+	}
+	if got := ud["keyboard"]; !reflect.DeepEqual(got, map[string]any{"layout": "us"}) {
+		t.Errorf("keyboard = %v", got)
+	}
+	if got := ud["ntp"]; !reflect.DeepEqual(got, map[string]any{"enabled": true, "ntp_client": "chrony"}) {
+		t.Errorf("ntp = %v", got)
+	}
+	if got := ud["packages"]; !reflect.DeepEqual(got, []any{"chrony", "doas", "openssh"}) {
+		t.Errorf("packages = %v", got)
+	}
+
+	users := ud["users"].([]any)
+	if len(users) != 1 {
+		t.Fatalf("users = %v, want one user", users)
+	}
+	u := users[0].(map[string]any)
+	if u["name"] != "alpine" || u["lock_passwd"] != false {
+		t.Errorf("user = %v", u)
+	}
+	if got := u["groups"]; !reflect.DeepEqual(got, []any{"audio", "video", "netdev", "wheel"}) {
+		t.Errorf("groups = %v, want wheel added", got)
+	}
+	if hash, _ := u["hashed_passwd"].(string); !strings.HasPrefix(hash, "$6$") || strings.Contains(string(seed.UserData), "changeme") {
+		t.Errorf("password is not hashed: %q", hash)
+	}
+	wantKeys := []any{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5 admin@example.com", "ssh-rsa AAAAB3NzaC1yc2E backup@example.com"}
+	if got := u["ssh_authorized_keys"]; !reflect.DeepEqual(got, wantKeys) {
+		t.Errorf("ssh_authorized_keys = %v", got)
+	}
+
+	wantMeta := "instance-id: iid-vm-build\nlocal-hostname: vm-build\n"
+	if string(seed.MetaData) != wantMeta {
+		t.Errorf("meta-data = %q, want %q", seed.MetaData, wantMeta)
+	}
+	wantNetwork := "version: 2\nethernets:\n  eth0:\n    dhcp4: true\n"
+	if string(seed.NetworkConfig) != wantNetwork {
+		t.Errorf("network-config = %q, want %q", seed.NetworkConfig, wantNetwork)
+	}
+
+	if !reflect.DeepEqual(seed.Unmapped, []string{"disk"}) {
+		t.Errorf("Unmapped = %v, want [disk]", seed.Unmapped)
+	}
+
+	var names []string
+	for _, f := range seed.Files() {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, " ") != "meta-data user-data network-config" {
+		t.Errorf("Files() = %v", names)
+	}
+}
+
+func TestRender_Network(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		gateway string
+		dns     []string
+		want    string
+	}{
+		{
+			name:    "static",
+			address: "10.20.0.50/24",
+			gateway: "10.20.0.1",
+			want:    "version: 2\nethernets:\n  wlan0:\n    addresses:\n      - 10.20.0.50/24\n    routes:\n      - to: 0.0.0.0/0\n        via: 10.20.0.1\n",
+		},
+		{
+			name:    "static without gateway",
+			address: "10.20.0.50/24",
+			want:    "version: 2\nethernets:\n  wlan0:\n    addresses:\n      - 10.20.0.50/24\n",
+		},
+		{
+			name:    "static with nameservers",
+			address: "10.20.0.50/24",
+			gateway: "10.20.0.1",
+			dns:     []string{"10.20.0.1", "9.9.9.9"},
+			want:    "version: 2\nethernets:\n  wlan0:\n    addresses:\n      - 10.20.0.50/24\n    routes:\n      - to: 0.0.0.0/0\n        via: 10.20.0.1\n    nameservers:\n      addresses:\n        - 10.20.0.1\n        - 9.9.9.9\n",
+		},
+		{
+			name: "DHCP with nameservers",
+			dns:  []string{"9.9.9.9"},
+			want: "version: 2\nethernets:\n  wlan0:\n    dhcp4: true\n    nameservers:\n      addresses:\n        - 9.9.9.9\n",
+		},
+		{
+			name:    "IPv6",
+			address: "2001:db8::50/64",
+			gateway: "2001:db8::1",
+			want:    "version: 2\nethernets:\n  wlan0:\n    addresses:\n      - 2001:db8::50/64\n    routes:\n      - to: ::/0\n        via: 2001:db8::1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.New()
+			cfg.NetworkIface = "wlan0"
+			cfg.Address = tt.address
+			cfg.Gateway = tt.gateway
+			cfg.DNS = tt.dns
+			seed, err := Render(cfg)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if string(seed.NetworkConfig) != tt.want {
+				t.Errorf("network-config =\n%s\nwant\n%s", seed.NetworkConfig, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender_Unmapped(t *testing.T) {
+	cfg := config.New()
+	cfg.DiskDevice = ""
+	cfg.Password = ""
+	cfg.Groups = []string{"wheel"}
+	cfg.Pi.EnableUART = true
+
+	seed, err := Render(cfg)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if !reflect.DeepEqual(seed.Unmapped, []string{"pi"}) {
+		t.Errorf("Unmapped = %v, want [pi]", seed.Unmapped)
+	}
+	var ud struct {
+		Users []map[string]any `yaml:"users"`
+	}
+	if err := yaml.Unmarshal(seed.UserData, &ud); err != nil {
+		t.Fatal(err)
+	}
+	u := ud.Users[0]
+	if u["lock_passwd"] != true || u["hashed_passwd"] != nil {
+		t.Errorf("user without a password = %v, want it locked", u)
+	}
+	if !reflect.DeepEqual(u["groups"], []any{"wheel"}) {
+		t.Errorf("groups = %v, want wheel once", u["groups"])
+	}
+
+	cfg.SSHKey = filepath.Join(t.TempDir(), "missing.pub")
+	if _, err := Render(cfg); err == nil || !strings.Contains(err.Error(), "failed to read SSH key file") {
+		t.Errorf("Render() error = %v, want the missing key reported", err)
+	}
+}
@@ -1,22 +1,107 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
-// Config holds the Alpine Linux installation configuration
+// Config holds the Alpine Linux installation configuration. Fields holding
+// credentials are tagged secret:"true" so they can be masked for display.
 type Config struct {
-	Hostname     string
-	Username     string
-	Password     string
-	Timezone     string
-	Keymap       string
-	NetworkIface string
-	DiskDevice   string
-	Groups       []string
-	SSHKey       string
+	Hostname     string   `yaml:"hostname"`
+	Username     string   `yaml:"username"`
+	Password     string   `yaml:"password" secret:"true"`
+	Timezone     string   `yaml:"timezone"`
+	Keymap       string   `yaml:"keymap"`
+	NetworkIface string   `yaml:"interface"`
+	DiskDevice   string   `yaml:"disk"`
+	Groups       []string `yaml:"groups"`
+	SSHKey       string   `yaml:"ssh_key,omitempty"`
+
+	// Address is the static address of NetworkIface in CIDR notation, for
+	// example 10.20.0.50/24. The interface uses DHCP when it is empty.
+	Address string `yaml:"address,omitempty"`
+	Gateway string `yaml:"gateway,omitempty"`
+	// DNS lists the nameservers setup-dns writes to resolv.conf. A static
+	// address needs them, as setup-dns asks for them otherwise.
+	DNS []string `yaml:"dns,omitempty"`
+
+	// Pi holds the Raspberry Pi boot settings written to the boot media. It
+	// is not part of the answer file.
+	Pi PiConfig `yaml:"pi,omitempty" template:"-"`
+
+	// VM holds the virtual machine settings used to build images. It is not
+	// part of the answer file.
+	VM VMConfig `yaml:"vm,omitempty" template:"-"`
+}
+
+// File is the layout of a config file: the settings of the host and the
+// policy for the paths generated files are written to. The policy belongs to
+// whoever runs the tool, so it is kept out of Config and cannot be set by
+// inventory defaults or hosts.
+type File struct {
+	Config `yaml:",inline"`
+	// Output controls where generated files may be written
+	Output OutputPolicy `yaml:"output,omitempty"`
+}
+
+// OutputPolicy decides which paths generated files may be written to. A path
+// is checked against the most specific root containing it, with allowed roots
+// winning ties, so an allowed root can open up part of a denied one. When
+// AllowedRoots is empty every path outside the denied roots is allowed.
+type OutputPolicy struct {
+	AllowedRoots []string `yaml:"allowed_roots,omitempty"`
+	DeniedRoots  []string `yaml:"denied_roots,omitempty"`
+	// FollowSymlinks allows the output path itself to be a symbolic link, in
+	// which case the link target is checked and written. Symbolic links in
+	// the parent directories are always resolved before checking.
+	FollowSymlinks bool `yaml:"follow_symlinks,omitempty"`
+}
+
+// PiConfig holds Raspberry Pi firmware and kernel settings
+type PiConfig struct {
+	// EnableUART turns on the serial console UART
+	EnableUART bool `yaml:"enable_uart,omitempty"`
+	// GPUMem is the memory in megabytes reserved for the GPU, 0 keeps the
+	// firmware default
+	GPUMem     int      `yaml:"gpu_mem,omitempty"`
+	DTOverlays []string `yaml:"dtoverlays,omitempty"`
+	DTParams   []string `yaml:"dtparams,omitempty"`
+	// Cmdline holds kernel parameters added to cmdline.txt
+	Cmdline []string `yaml:"cmdline,omitempty"`
+}
+
+// VMConfig holds the settings of the virtual machine an image is built in.
+// Zero values leave the choice to the image builder.
+type VMConfig struct {
+	// DiskSize is the size of the disk, a number of bytes with an optional
+	// K, M, G or T suffix, for example 8G
+	DiskSize string `yaml:"disk_size,omitempty"`
+	// Memory is the memory of the machine in megabytes
+	Memory int `yaml:"memory,omitempty"`
+	CPUs   int `yaml:"cpus,omitempty"`
+}
+
+// DefaultOutputPolicy denies the system directories, root's home and /var,
+// and allows everything else
+func DefaultOutputPolicy() OutputPolicy {
+	return OutputPolicy{
+		DeniedRoots: []string{"/bin", "/boot", "/dev", "/etc", "/lib", "/proc", "/root", "/sbin", "/sys", "/usr", "/var"},
+	}
+}
+
+// Packages returns the packages the answer file installs on every host
+// besides the base system: chrony for NTPOPTS, doas for the admin user and
+// openssh for SSHDOPTS
+func Packages() []string {
+	return []string{"chrony", "doas", "openssh"}
 }
 
 // New creates a new Config with default values
@@ -33,28 +118,289 @@ func New() *Config {
 	}
 }
 
+// Clone returns a deep copy of the configuration
+func (c *Config) Clone() *Config {
+	clone := *c
+	clone.Groups = cloneStrings(c.Groups)
+	clone.DNS = cloneStrings(c.DNS)
+	clone.Pi.DTOverlays = cloneStrings(c.Pi.DTOverlays)
+	clone.Pi.DTParams = cloneStrings(c.Pi.DTParams)
+	clone.Pi.Cmdline = cloneStrings(c.Pi.Cmdline)
+	return &clone
+}
+
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
+
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
-	if c.Hostname == "" {
+	for _, err := range []error{
+		ValidateHostname(c.Hostname),
+		ValidateUsername(c.Username),
+		ValidatePassword(c.Password),
+		ValidateAddress(c.Address),
+		ValidateGateway(c.Gateway, c.Address),
+		ValidateDNS(c.DNS, c.Address),
+		ValidateDiskDevice(c.DiskDevice),
+		ValidateSSHKey(c.SSHKey),
+		ValidatePi(c.Pi),
+		ValidateVM(c.VM),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hostnameLabel matches one dot-separated label of an RFC 1123 hostname
+var hostnameLabel = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// ValidateHostname checks that hostname follows RFC 1123: dot-separated
+// labels of up to 63 letters, digits and hyphens that do not start or end
+// with a hyphen, and at most 253 characters in total
+func ValidateHostname(hostname string) error {
+	if hostname == "" {
 		return fmt.Errorf("hostname cannot be empty")
 	}
-	if c.Username == "" {
+	if len(hostname) > 253 {
+		return fmt.Errorf("hostname %q is longer than 253 characters", hostname)
+	}
+	for _, label := range strings.Split(hostname, ".") {
+		if !hostnameLabel.MatchString(label) {
+			return fmt.Errorf("invalid hostname %q: labels must be 1 to 63 letters, digits or hyphens and cannot start or end with a hyphen", hostname)
+		}
+	}
+	return nil
+}
+
+// ValidateUsername checks a username with the rules used by Validate
+func ValidateUsername(username string) error {
+	if username == "" {
 		return fmt.Errorf("username cannot be empty")
 	}
-	if c.Password == "" {
+	return nil
+}
+
+// ValidatePassword checks a password with the rules used by Validate
+func ValidatePassword(password string) error {
+	if password == "" {
 		return fmt.Errorf("password cannot be empty")
 	}
-	if c.DiskDevice == "" {
-		return fmt.Errorf("disk device cannot be empty")
+	return nil
+}
+
+// ValidateAddress checks that address, if set, is a host address in CIDR
+// notation
+func ValidateAddress(address string) error {
+	if address == "" {
+		return nil
 	}
-	if c.SSHKey != "" {
-		keyData, err := os.ReadFile(c.SSHKey)
-		if err != nil {
-			return fmt.Errorf("failed to read SSH key file: %w", err)
+	prefix, err := netip.ParsePrefix(address)
+	if err != nil {
+		return fmt.Errorf("invalid address %q, want an address in CIDR notation such as 10.20.0.50/24", address)
+	}
+	if prefix.Addr().Is4() && prefix.Bits() < 31 {
+		masked := prefix.Masked()
+		if prefix.Addr() == masked.Addr() {
+			return fmt.Errorf("address %s is the network address of %s", prefix.Addr(), masked)
+		}
+		if prefix.Addr() == lastAddr(masked) {
+			return fmt.Errorf("address %s is the broadcast address of %s", prefix.Addr(), masked)
+		}
+	}
+	return nil
+}
+
+// ValidateGateway checks that gateway, if set, is an address in the subnet
+// of address
+func ValidateGateway(gateway, address string) error {
+	if gateway == "" {
+		return nil
+	}
+	gw, err := netip.ParseAddr(gateway)
+	if err != nil {
+		return fmt.Errorf("invalid gateway %q", gateway)
+	}
+	if address == "" {
+		return fmt.Errorf("gateway %s needs a static address", gw)
+	}
+	prefix, err := netip.ParsePrefix(address)
+	if err != nil {
+		// reported by ValidateAddress
+		return nil
+	}
+	if !prefix.Masked().Contains(gw) {
+		return fmt.Errorf("gateway %s is not in the subnet %s of address %s", gw, prefix.Masked(), prefix.Addr())
+	}
+	if gw == prefix.Addr() {
+		return fmt.Errorf("gateway %s is the address of the host itself", gw)
+	}
+	return nil
+}
+
+// ValidateDNS checks that every nameserver is an IP address and that a static
+// address has nameservers
+func ValidateDNS(nameservers []string, address string) error {
+	for _, ns := range nameservers {
+		if _, err := netip.ParseAddr(ns); err != nil {
+			return fmt.Errorf("invalid nameserver %q, want an IP address", ns)
 		}
-		if !strings.HasPrefix(string(keyData), "ssh-") {
+	}
+	if address != "" && len(nameservers) == 0 {
+		return fmt.Errorf("static address %s needs dns nameservers, setup-dns asks for them otherwise", address)
+	}
+	return nil
+}
+
+// lastAddr returns the last address of a masked prefix
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// ValidateDiskDevice checks a disk device with the rules used by Validate
+func ValidateDiskDevice(device string) error {
+	if device == "" {
+		return fmt.Errorf("disk device cannot be empty")
+	}
+	return nil
+}
+
+// ValidateSSHKey checks that path, if set, is a readable SSH public key
+func ValidateSSHKey(path string) error {
+	if path == "" {
+		return nil
+	}
+	keyData, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read SSH key file: %w", err)
+	}
+	if !strings.HasPrefix(string(keyData), "ssh-") {
+		return fmt.Errorf("invalid SSH public key format")
+	}
+	return nil
+}
+
+// ValidateSSHKeyFormat checks an SSH key setting without reading any file, for
+// settings that name a file on another machine: an inline key has to be a
+// public key, anything else an absolute path
+func ValidateSSHKeyFormat(key string) error {
+	if key == "" {
+		return nil
+	}
+	if strings.ContainsAny(key, " \t") {
+		if !strings.HasPrefix(key, "ssh-") {
 			return fmt.Errorf("invalid SSH public key format")
 		}
+		return nil
+	}
+	if !filepath.IsAbs(key) {
+		return fmt.Errorf("SSH key %q is neither a public key nor an absolute path", key)
+	}
+	return nil
+}
+
+// ValidatePi checks that the Raspberry Pi settings can be written to the
+// boot media: a gpu_mem the firmware accepts, and overlays, parameters and
+// kernel parameters that are single words
+func ValidatePi(pi PiConfig) error {
+	if pi.GPUMem != 0 && (pi.GPUMem < 16 || pi.GPUMem > 944) {
+		return fmt.Errorf("pi gpu_mem must be between 16 and 944, got %d", pi.GPUMem)
+	}
+	for _, list := range []struct {
+		name   string
+		values []string
+	}{
+		{"dtoverlay", pi.DTOverlays},
+		{"dtparam", pi.DTParams},
+		{"kernel parameter", pi.Cmdline},
+	} {
+		for _, v := range list.values {
+			if v == "" || strings.ContainsAny(v, " \t\r\n") {
+				return fmt.Errorf("invalid pi %s %q, it must be a single word", list.name, v)
+			}
+		}
+	}
+	return nil
+}
+
+// diskSize matches a disk size with an optional unit suffix
+var diskSize = regexp.MustCompile(`^[1-9][0-9]*[KMGT]?$`)
+
+// ValidateVM checks the virtual machine settings: a disk size image builders
+// understand and no negative memory or CPU count
+func ValidateVM(vm VMConfig) error {
+	if vm.DiskSize != "" && !diskSize.MatchString(vm.DiskSize) {
+		return fmt.Errorf("invalid vm disk_size %q, it must be a number with an optional K, M, G or T suffix", vm.DiskSize)
+	}
+	if vm.Memory < 0 {
+		return fmt.Errorf("vm memory cannot be negative, got %d", vm.Memory)
+	}
+	if vm.CPUs < 0 {
+		return fmt.Errorf("vm cpus cannot be negative, got %d", vm.CPUs)
+	}
+	return nil
+}
+
+// Load reads the host settings of a YAML config file. Fields missing from the
+// file keep the values from New.
+func Load(path string) (*Config, error) {
+	f, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &f.Config, nil
+}
+
+// LoadFile reads a YAML config file with its output policy. Fields missing
+// from the file keep the values from New and DefaultOutputPolicy.
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	f := &File{Config: *New(), Output: DefaultOutputPolicy()}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(f); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Marshal encodes the configuration as a YAML config file
+func (c *Config) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Save writes the configuration to path as YAML. The file is only readable
+// by the owner because it contains the user password.
+func (c *Config) Save(path string) error {
+	data, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
 	}
 	return nil
 }
@@ -86,6 +86,117 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid static address",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+				Address:    "10.20.0.50/24",
+				Gateway:    "10.20.0.1",
+				DNS:        []string{"10.20.0.1", "2001:db8::53"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "address without prefix length",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+				Address:    "10.20.0.50",
+			},
+			wantErr:     true,
+			errContains: "want an address in CIDR notation",
+		},
+		{
+			name: "network address",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+				Address:    "10.20.0.0/24",
+			},
+			wantErr:     true,
+			errContains: "network address of 10.20.0.0/24",
+		},
+		{
+			name: "broadcast address",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+				Address:    "10.20.1.255/23",
+			},
+			wantErr:     true,
+			errContains: "broadcast address of 10.20.0.0/23",
+		},
+		{
+			name: "gateway outside the subnet",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+				Address:    "10.20.0.50/24",
+				Gateway:    "10.20.1.1",
+			},
+			wantErr:     true,
+			errContains: "not in the subnet 10.20.0.0/24",
+		},
+		{
+			name: "gateway is the host",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+				Address:    "fd00::50/64",
+				Gateway:    "fd00::50",
+			},
+			wantErr:     true,
+			errContains: "address of the host itself",
+		},
+		{
+			name: "gateway without address",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+				Gateway:    "10.20.0.1",
+			},
+			wantErr:     true,
+			errContains: "needs a static address",
+		},
+		{
+			name: "static address without nameservers",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+				Address:    "10.20.0.50/24",
+			},
+			wantErr:     true,
+			errContains: "needs dns nameservers",
+		},
+		{
+			name: "nameserver that is not an address",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+				DNS:        []string{"dns.example.com"},
+			},
+			wantErr:     true,
+			errContains: `invalid nameserver "dns.example.com"`,
+		},
 		{
 			name: "empty hostname",
 			config: &Config{
@@ -96,6 +207,135 @@ func TestConfig_Validate(t *testing.T) {
 			wantErr:     true,
 			errContains: "hostname cannot be empty",
 		},
+		{
+			name: "fully qualified hostname",
+			config: &Config{
+				Hostname:   "node-01.rack4.example.com",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+			},
+			wantErr: false,
+		},
+		{
+			name: "hostname ending with a hyphen",
+			config: &Config{
+				Hostname:   "edge-",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+			},
+			wantErr:     true,
+			errContains: `invalid hostname "edge-"`,
+		},
+		{
+			name: "hostname with an unexpanded pattern",
+			config: &Config{
+				Hostname:   "edge-{{seq 3}}",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+			},
+			wantErr:     true,
+			errContains: "labels must be 1 to 63 letters, digits or hyphens",
+		},
+		{
+			name: "hostname with an empty label",
+			config: &Config{
+				Hostname:   "node..example.com",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+			},
+			wantErr:     true,
+			errContains: "invalid hostname",
+		},
+		{
+			name: "hostname label too long",
+			config: &Config{
+				Hostname:   strings.Repeat("a", 64),
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+			},
+			wantErr:     true,
+			errContains: "invalid hostname",
+		},
+		{
+			name: "valid pi settings",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+				Pi: PiConfig{
+					EnableUART: true,
+					GPUMem:     16,
+					DTOverlays: []string{"disable-bt", "i2c-rtc,ds3231"},
+					Cmdline:    []string{"console=serial0,115200"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "pi gpu_mem out of range",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+				Pi:         PiConfig{GPUMem: 8},
+			},
+			wantErr:     true,
+			errContains: "gpu_mem must be between 16 and 944",
+		},
+		{
+			name: "pi kernel parameter with a space",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/sda",
+				Pi:         PiConfig{Cmdline: []string{"quiet splash"}},
+			},
+			wantErr:     true,
+			errContains: `invalid pi kernel parameter "quiet splash"`,
+		},
+		{
+			name: "vm settings",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/vda",
+				VM:         VMConfig{DiskSize: "8G", Memory: 1024, CPUs: 2},
+			},
+			wantErr: false,
+		},
+		{
+			name: "vm disk size with a unit word",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/vda",
+				VM:         VMConfig{DiskSize: "8GB"},
+			},
+			wantErr:     true,
+			errContains: `invalid vm disk_size "8GB"`,
+		},
+		{
+			name: "negative vm memory",
+			config: &Config{
+				Hostname:   "test-host",
+				Username:   "testuser",
+				Password:   "testpass",
+				DiskDevice: "/dev/vda",
+				VM:         VMConfig{Memory: -1},
+			},
+			wantErr:     true,
+			errContains: "vm memory cannot be negative",
+		},
 		{
 			name: "empty username",
 			config: &Config{
@@ -221,6 +461,28 @@ func TestConfig_Validate(t *testing.T) {
 	}
 }
 
+func TestValidateSSHKeyFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "empty", key: ""},
+		{name: "path that does not exist here", key: "/nonexistent/.ssh/id_ed25519.pub"},
+		{name: "inline key", key: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5 user@host"},
+		{name: "relative path", key: "id_ed25519.pub", wantErr: true},
+		{name: "inline text that is no key", key: "not a key", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateSSHKeyFormat(tt.key); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSSHKeyFormat(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestConfig_ValidateWithPermissions(t *testing.T) {
 	// Skip this test if running as root since root can bypass permissions
 	if os.Getuid() == 0 {
@@ -375,3 +637,163 @@ func TestConfig_DefaultValues(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_SaveAndLoad(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "alpine-hero.yaml")
+
+	cfg := &Config{
+		Hostname:     "test-host",
+		Username:     "testuser",
+		Password:     "test@pass!123",
+		Timezone:     "Europe/London",
+		Keymap:       "uk",
+		NetworkIface: "wlan0",
+		DiskDevice:   "/dev/sda",
+		Groups:       []string{"wheel", "docker"},
+		SSHKey:       "/home/testuser/.ssh/id_ed25519.pub",
+	}
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected file permissions 0600, got %v", info.Mode().Perm())
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("Load() = %+v, want %+v", loaded, cfg)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name        string
+		content     string
+		want        *Config
+		wantErr     bool
+		errContains string
+	}{
+		{
+			name:    "partial file keeps defaults",
+			content: "hostname: pi-kitchen\ngroups: [wheel]\n",
+			want: func() *Config {
+				cfg := New()
+				cfg.Hostname = "pi-kitchen"
+				cfg.Groups = []string{"wheel"}
+				return cfg
+			}(),
+		},
+		{
+			name:        "unknown field",
+			content:     "hostnme: typo\n",
+			wantErr:     true,
+			errContains: "field hostnme not found",
+		},
+		{
+			name:        "invalid yaml",
+			content:     "hostname: [unterminated\n",
+			wantErr:     true,
+			errContains: "failed to parse config file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("Load() error = %v, want error containing %q", err, tt.errContains)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		want    OutputPolicy
+	}{
+		{
+			name:    "default policy",
+			content: "hostname: pi-kitchen\n",
+			want:    DefaultOutputPolicy(),
+		},
+		{
+			name:    "output policy",
+			content: "hostname: pi-kitchen\noutput:\n  allowed_roots: [/srv/pxe, /media]\n  denied_roots: []\n  follow_symlinks: true\n",
+			want: OutputPolicy{
+				AllowedRoots:   []string{"/srv/pxe", "/media"},
+				DeniedRoots:    []string{},
+				FollowSymlinks: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadFile(path)
+			if err != nil {
+				t.Fatalf("LoadFile() error = %v", err)
+			}
+			if got.Hostname != "pi-kitchen" || got.Username != New().Username {
+				t.Errorf("LoadFile() config = %+v, want the file over the defaults", got.Config)
+			}
+			if !reflect.DeepEqual(got.Output, tt.want) {
+				t.Errorf("LoadFile() output = %+v, want %+v", got.Output, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Clone(t *testing.T) {
+	cfg := New()
+	cfg.DNS = []string{"10.20.0.1"}
+	cfg.Pi = PiConfig{DTOverlays: []string{"disable-bt"}, DTParams: []string{"audio=on"}, Cmdline: []string{"quiet"}}
+
+	clone := cfg.Clone()
+	if !reflect.DeepEqual(clone, cfg) {
+		t.Fatalf("Clone() = %+v, want %+v", clone, cfg)
+	}
+
+	clone.Groups[0] = "changed"
+	clone.DNS[0] = "changed"
+	clone.Pi.DTOverlays[0] = "changed"
+	clone.Pi.DTParams[0] = "changed"
+	clone.Pi.Cmdline[0] = "changed"
+	if cfg.Groups[0] == "changed" || cfg.DNS[0] == "changed" ||
+		cfg.Pi.DTOverlays[0] == "changed" || cfg.Pi.DTParams[0] == "changed" || cfg.Pi.Cmdline[0] == "changed" {
+		t.Errorf("Clone() shares slices with the original: %+v", cfg)
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import "reflect"
+
+// Mask replaces the value of secret fields in configurations meant for
+// display
+const Mask = "********"
+
+// Masked returns a copy of the configuration with every string field tagged
+// secret:"true" replaced by Mask, including fields of nested structs and
+// slices. Empty secrets stay empty so a missing password is still visible.
+func (c *Config) Masked() *Config {
+	masked := reflect.New(reflect.TypeOf(*c))
+	masked.Elem().Set(maskValue(reflect.ValueOf(*c), false))
+	return masked.Interface().(*Config)
+}
+
+// maskValue returns a copy of v with secret strings masked. Values that
+// contain nothing to mask are shared with v.
+func maskValue(v reflect.Value, secret bool) reflect.Value {
+	switch v.Kind() {
+	case reflect.String:
+		if secret && v.Len() > 0 {
+			return reflect.ValueOf(Mask).Convert(v.Type())
+		}
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			out.Field(i).Set(maskValue(v.Field(i), f.Tag.Get("secret") == "true"))
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(maskValue(v.Index(i), secret))
+		}
+		return out
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(maskValue(v.Elem(), secret))
+		return out
+	}
+	return v
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfig_Masked(t *testing.T) {
+	cfg := New()
+	cfg.Password = "hunter2"
+
+	masked := cfg.Masked()
+	if masked.Password != Mask {
+		t.Errorf("Masked().Password = %q, want %q", masked.Password, Mask)
+	}
+	if cfg.Password != "hunter2" {
+		t.Errorf("Masked() modified the original password to %q", cfg.Password)
+	}
+
+	masked.Password = cfg.Password
+	if !reflect.DeepEqual(masked, cfg) {
+		t.Errorf("Masked() changed non-secret fields: %+v, want %+v", masked, cfg)
+	}
+
+	masked.Groups[0] = "changed"
+	if cfg.Groups[0] == "changed" {
+		t.Error("Masked() shares the groups slice with the original")
+	}
+
+	cfg.Password = ""
+	if got := cfg.Masked().Password; got != "" {
+		t.Errorf("Masked().Password = %q for an empty password, want it empty", got)
+	}
+}
+
+func TestMaskValue_Nested(t *testing.T) {
+	type network struct {
+		SSID string
+		PSK  string `secret:"true"`
+	}
+	type settings struct {
+		Networks []network
+		Proxy    *struct {
+			URL      string
+			Password string `secret:"true"`
+		}
+		Keys []string `secret:"true"`
+	}
+
+	in := settings{
+		Networks: []network{{SSID: "home", PSK: "wifi-secret"}, {SSID: "open"}},
+		Keys:     []string{"a", "b"},
+	}
+	in.Proxy = &struct {
+		URL      string
+		Password string `secret:"true"`
+	}{URL: "http://proxy", Password: "proxy-secret"}
+
+	out := maskValue(reflect.ValueOf(in), false).Interface().(settings)
+
+	if out.Networks[0].PSK != Mask || out.Networks[0].SSID != "home" {
+		t.Errorf("Networks[0] = %+v, want the PSK masked", out.Networks[0])
+	}
+	if out.Networks[1].PSK != "" {
+		t.Errorf("Networks[1].PSK = %q, want the empty PSK kept", out.Networks[1].PSK)
+	}
+	if out.Proxy.Password != Mask || out.Proxy.URL != "http://proxy" {
+		t.Errorf("Proxy = %+v, want the password masked", out.Proxy)
+	}
+	if !reflect.DeepEqual(out.Keys, []string{Mask, Mask}) {
+		t.Errorf("Keys = %v, want every element masked", out.Keys)
+	}
+	if in.Networks[0].PSK != "wifi-secret" || in.Proxy.Password != "proxy-secret" || in.Keys[0] != "a" {
+		t.Error("maskValue() modified its input")
+	}
+}
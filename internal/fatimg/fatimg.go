@@ -0,0 +1,515 @@
+package fatimg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// DefaultLabel is the volume label used when none is given
+const DefaultLabel = "ALPINEHERO"
+
+// Layout of the images this package writes. One sector per cluster keeps
+// small images small; the size is dominated by the minimum cluster count.
+const (
+	sectorSize      = 512
+	sectorsPerClus  = 1
+	clusterSize     = sectorSize * sectorsPerClus
+	reservedSectors = 32
+	numFATs         = 2
+	fsInfoSector    = 1
+	backupBoot      = 6
+	rootCluster     = 2
+	mediaType       = 0xF8
+	entrySize       = 32
+	// minClusters is the smallest cluster count of a FAT32 file system;
+	// with fewer clusters it is FAT12 or FAT16 by definition
+	minClusters = 65525
+	endOfChain  = 0x0FFFFFFF
+)
+
+// Directory entry attributes
+const (
+	attrVolumeID  = 0x08
+	attrDirectory = 0x10
+	attrArchive   = 0x20
+	attrLongName  = 0x0F
+)
+
+// File is a file to store in the image. Path is slash separated and relative
+// to the root of the file system; parent directories are created as needed.
+type File struct {
+	Path string
+	Data []byte
+}
+
+// Options configure the image written by Write
+type Options struct {
+	// Label is the volume label, DefaultLabel if empty
+	Label string
+	// Size is the size of the image in bytes, a multiple of 512. Zero makes
+	// the smallest image that holds the files, rounded up to a whole MiB.
+	Size int64
+	// ModTime is the timestamp of every file and directory
+	ModTime time.Time
+}
+
+// node is a file or directory of the image being built
+type node struct {
+	name     string
+	dir      bool
+	data     []byte
+	children []*node
+	short    [11]byte
+	long     bool
+	cluster  uint32
+	clusters uint32
+}
+
+// size returns the bytes a node occupies in the data area
+func (n *node) size() int {
+	if !n.dir {
+		return len(n.data)
+	}
+	entries := 0
+	if n.name == "" {
+		entries++ // volume label
+	} else {
+		entries += 2 // . and ..
+	}
+	for _, c := range n.children {
+		entries++
+		if c.long {
+			entries += (len(utf16.Encode([]rune(c.name))) + 12) / 13
+		}
+	}
+	return entries * entrySize
+}
+
+// Target is what Write builds an image in, such as an *os.File. It is
+// truncated to nothing and then to the image size first, so the regions
+// Write leaves alone read as zeros and take no space on file systems with
+// sparse files.
+type Target interface {
+	io.WriterAt
+	Truncate(size int64) error
+}
+
+// Write writes a FAT32 image holding files to w. Long file names are stored
+// as VFAT entries next to generated 8.3 names. Only the boot sectors, the
+// used part of the FATs and the clusters of the files and directories are
+// written, so the size of the image does not matter.
+func Write(w Target, files []File, opts Options) error {
+	label := opts.Label
+	if label == "" {
+		label = DefaultLabel
+	}
+	if err := ValidateLabel(label); err != nil {
+		return err
+	}
+
+	root, err := buildTree(files)
+	if err != nil {
+		return err
+	}
+
+	// allocate clusters contiguously, root directory first
+	next := uint32(rootCluster)
+	var walk func(n *node)
+	walk = func(n *node) {
+		n.clusters = uint32((n.size() + clusterSize - 1) / clusterSize)
+		if n.dir && n.clusters == 0 {
+			n.clusters = 1
+		}
+		if n.clusters > 0 {
+			n.cluster = next
+			next += n.clusters
+		}
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	walk(root)
+	used := next - rootCluster
+
+	size := opts.Size
+	if size == 0 {
+		clusters := max(used, minClusters)
+		fatSectors := (clusters + 2) * 4 / sectorSize
+		if (clusters+2)*4%sectorSize != 0 {
+			fatSectors++
+		}
+		need := int64(reservedSectors+numFATs*fatSectors+clusters*sectorsPerClus) * sectorSize
+		size = (need + 1<<20 - 1) &^ (1<<20 - 1)
+	}
+	if size%sectorSize != 0 {
+		return fmt.Errorf("image size %d is not a multiple of %d bytes", size, sectorSize)
+	}
+	totalSectors := uint32(size / sectorSize)
+	if int64(totalSectors)*sectorSize != size {
+		return fmt.Errorf("image size %d is too large", size)
+	}
+
+	// the FAT is sized for every sector being a cluster, which is a little
+	// more than needed and leaves the count below exact
+	fatSectors := (totalSectors/sectorsPerClus + 2 + sectorSize/4 - 1) / (sectorSize / 4)
+	dataStart := reservedSectors + numFATs*fatSectors
+	if dataStart >= totalSectors {
+		return fmt.Errorf("image size %d is too small for FAT32", size)
+	}
+	clusters := (totalSectors - dataStart) / sectorsPerClus
+	if clusters < minClusters {
+		return fmt.Errorf("image size %d is too small for FAT32, it needs at least %d clusters", size, minClusters)
+	}
+	if used > clusters {
+		return fmt.Errorf("files do not fit in an image of %d bytes", size)
+	}
+
+	for _, n := range []int64{0, size} {
+		if err := w.Truncate(n); err != nil {
+			return fmt.Errorf("failed to write image: %w", err)
+		}
+	}
+	var writeErr error
+	writeAt := func(data []byte, off int64) {
+		if writeErr == nil && len(data) > 0 {
+			_, writeErr = w.WriteAt(data, off)
+		}
+	}
+
+	modTime := opts.ModTime
+	volumeID := uint32(modTime.Unix())
+
+	// the boot sector and FS information sector, followed by their backup
+	head := make([]byte, 2*sectorSize)
+	boot := head[:sectorSize]
+	copy(boot[0:], []byte{0xEB, 0x58, 0x90})
+	copy(boot[3:11], "MSWIN4.1")
+	binary.LittleEndian.PutUint16(boot[11:], sectorSize)
+	boot[13] = sectorsPerClus
+	binary.LittleEndian.PutUint16(boot[14:], reservedSectors)
+	boot[16] = numFATs
+	boot[21] = mediaType
+	binary.LittleEndian.PutUint16(boot[24:], 32) // sectors per track
+	binary.LittleEndian.PutUint16(boot[26:], 64) // heads
+	binary.LittleEndian.PutUint32(boot[32:], totalSectors)
+	binary.LittleEndian.PutUint32(boot[36:], fatSectors)
+	binary.LittleEndian.PutUint32(boot[44:], rootCluster)
+	binary.LittleEndian.PutUint16(boot[48:], fsInfoSector)
+	binary.LittleEndian.PutUint16(boot[50:], backupBoot)
+	boot[64] = 0x80 // drive number
+	boot[66] = 0x29 // extended boot signature
+	binary.LittleEndian.PutUint32(boot[67:], volumeID)
+	copy(boot[71:82], padName(label))
+	copy(boot[82:90], "FAT32   ")
+	boot[510], boot[511] = 0x55, 0xAA
+
+	info := head[fsInfoSector*sectorSize : (fsInfoSector+1)*sectorSize]
+	binary.LittleEndian.PutUint32(info[0:], 0x41615252)
+	binary.LittleEndian.PutUint32(info[484:], 0x61417272)
+	binary.LittleEndian.PutUint32(info[488:], clusters-used)
+	binary.LittleEndian.PutUint32(info[492:], next)
+	binary.LittleEndian.PutUint32(info[508:], 0xAA550000)
+
+	writeAt(head, 0)
+	writeAt(head, backupBoot*sectorSize)
+
+	// entries past the last used cluster are free, which the zeros of the
+	// truncated image already say
+	fat := make([]byte, next*4)
+	binary.LittleEndian.PutUint32(fat[0:], 0x0FFFFF00|mediaType)
+	binary.LittleEndian.PutUint32(fat[4:], endOfChain)
+
+	clusterOffset := func(c uint32) int64 {
+		return int64(dataStart+(c-rootCluster)*sectorsPerClus) * sectorSize
+	}
+	stamp := dosTime(modTime)
+	var write func(n, parent *node)
+	write = func(n, parent *node) {
+		for i := uint32(0); i < n.clusters; i++ {
+			c := n.cluster + i
+			link := uint32(endOfChain)
+			if i+1 < n.clusters {
+				link = c + 1
+			}
+			binary.LittleEndian.PutUint32(fat[c*4:], link)
+		}
+		if !n.dir {
+			if n.clusters > 0 {
+				writeAt(n.data, clusterOffset(n.cluster))
+			}
+			return
+		}
+
+		var entries []byte
+		if parent == nil {
+			entries = append(entries, dirEntry(padName(label), attrVolumeID, 0, 0, stamp)...)
+		} else {
+			// .. of a top level directory points at the root as cluster 0
+			parentCluster := parent.cluster
+			if parent.name == "" {
+				parentCluster = 0
+			}
+			entries = append(entries, dirEntry(padName("."), attrDirectory, n.cluster, 0, stamp)...)
+			entries = append(entries, dirEntry(padName(".."), attrDirectory, parentCluster, 0, stamp)...)
+		}
+		for _, c := range n.children {
+			if c.long {
+				entries = append(entries, longEntries(c.name, c.short)...)
+			}
+			attr := byte(attrArchive)
+			if c.dir {
+				attr = attrDirectory
+			}
+			entries = append(entries, dirEntry(c.short[:], attr, c.cluster, uint32(len(c.data)), stamp)...)
+		}
+		writeAt(entries, clusterOffset(n.cluster))
+
+		for _, c := range n.children {
+			write(c, n)
+		}
+	}
+	write(root, nil)
+
+	for i := uint32(0); i < numFATs; i++ {
+		writeAt(fat, int64(reservedSectors+i*fatSectors)*sectorSize)
+	}
+
+	if writeErr != nil {
+		return fmt.Errorf("failed to write image: %w", writeErr)
+	}
+	return nil
+}
+
+// buildTree turns files into a directory tree with short names assigned.
+// Entries are sorted by name so the image does not depend on input order.
+func buildTree(files []File) (*node, error) {
+	root := &node{dir: true}
+	for _, f := range files {
+		parts := strings.Split(path.Clean(f.Path), "/")
+		if path.IsAbs(f.Path) || parts[0] == ".." {
+			return nil, fmt.Errorf("invalid file path %q, it must be relative to the root of the image", f.Path)
+		}
+		dir := root
+		for i, part := range parts {
+			if err := validateName(part); err != nil {
+				return nil, fmt.Errorf("invalid file path %q: %w", f.Path, err)
+			}
+			var child *node
+			for _, c := range dir.children {
+				if strings.EqualFold(c.name, part) {
+					child = c
+				}
+			}
+			last := i == len(parts)-1
+			switch {
+			case child == nil && last:
+				dir.children = append(dir.children, &node{name: part, data: f.Data})
+			case child == nil:
+				child = &node{name: part, dir: true}
+				dir.children = append(dir.children, child)
+			case last || !child.dir:
+				return nil, fmt.Errorf("duplicate file path %q", f.Path)
+			}
+			dir = child
+		}
+	}
+
+	var assign func(n *node)
+	assign = func(n *node) {
+		sort.Slice(n.children, func(i, j int) bool { return n.children[i].name < n.children[j].name })
+		taken := make(map[[11]byte]bool)
+		for _, c := range n.children {
+			c.short, c.long = shortName(c.name, taken)
+			taken[c.short] = true
+			assign(c)
+		}
+	}
+	assign(root)
+	return root, nil
+}
+
+// ValidateLabel checks that label can be used as a volume label: at most 11
+// characters that are valid in a short file name
+func ValidateLabel(label string) error {
+	if label == "" || len(label) > 11 {
+		return fmt.Errorf("invalid volume label %q, it must be 1 to 11 characters", label)
+	}
+	for _, r := range label {
+		if r != ' ' && !shortChar(r) {
+			return fmt.Errorf("invalid volume label %q, it may only contain letters, digits, spaces and %s", label, shortSpecials)
+		}
+	}
+	return nil
+}
+
+// validateName checks a single component of a file path
+func validateName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("empty or relative name")
+	}
+	if len(utf16.Encode([]rune(name))) > 255 {
+		return fmt.Errorf("name %q is longer than 255 characters", name)
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return fmt.Errorf("name %q ends with a dot or space", name)
+	}
+	for _, r := range name {
+		if r < 0x20 || strings.ContainsRune(`"*/:<>?\|`, r) {
+			return fmt.Errorf("name %q contains %q", name, r)
+		}
+	}
+	return nil
+}
+
+// shortSpecials are the punctuation characters allowed in short names
+const shortSpecials = "$%'-_@~`!(){}^#&"
+
+// shortChar reports whether r may appear in a short name
+func shortChar(r rune) bool {
+	return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune(shortSpecials, r)
+}
+
+// shortName returns the 8.3 name stored for name and whether a long name
+// entry is needed. Names that are already valid upper case 8.3 names are
+// stored as they are, others get the upper case form if it is free or a
+// numeric tail like PI-KIT~1.GZ.
+func shortName(name string, taken map[[11]byte]bool) ([11]byte, bool) {
+	base, ext := name, ""
+	if i := strings.LastIndex(name, "."); i > 0 {
+		base, ext = name[:i], name[i+1:]
+	}
+	clean := func(s string, keepLength bool) string {
+		var b strings.Builder
+		for _, r := range strings.ToUpper(s) {
+			switch {
+			case r == ' ' || r == '.':
+				if keepLength {
+					b.WriteByte('_')
+				}
+			case r < 0x80 && shortChar(r):
+				b.WriteRune(r)
+			default:
+				b.WriteByte('_')
+			}
+		}
+		return b.String()
+	}
+
+	upperBase, upperExt := clean(base, true), clean(ext, true)
+	exact := upperBase == strings.ToUpper(base) && upperExt == strings.ToUpper(ext) &&
+		!strings.Contains(base, ".") && base != "" &&
+		len(upperBase) <= 8 && len(upperExt) <= 3
+	if exact {
+		short := [11]byte(padName(upperBase + strings.Repeat(" ", 8-len(upperBase)) + upperExt))
+		if !taken[short] {
+			return short, name != upperBase+dotExt(upperExt)
+		}
+	}
+
+	basis, extBasis := clean(base, false), clean(ext, false)
+	if len(extBasis) > 3 {
+		extBasis = extBasis[:3]
+	}
+	for n := 1; ; n++ {
+		tail := fmt.Sprintf("~%d", n)
+		b := basis
+		if len(b) > 8-len(tail) {
+			b = b[:8-len(tail)]
+		}
+		b += tail
+		short := [11]byte(padName(b + strings.Repeat(" ", 8-len(b)) + extBasis))
+		if !taken[short] {
+			return short, true
+		}
+	}
+}
+
+// dotExt returns ext with a leading dot, or nothing if ext is empty
+func dotExt(ext string) string {
+	if ext == "" {
+		return ""
+	}
+	return "." + ext
+}
+
+// padName pads s with spaces to the 11 bytes of a directory entry name
+func padName(s string) []byte {
+	return []byte(s + strings.Repeat(" ", 11-len(s)))
+}
+
+// dirEntry returns a short directory entry
+func dirEntry(name []byte, attr byte, cluster, size uint32, stamp [2]uint16) []byte {
+	e := make([]byte, entrySize)
+	copy(e[0:11], name)
+	e[11] = attr
+	binary.LittleEndian.PutUint16(e[14:], stamp[1])
+	binary.LittleEndian.PutUint16(e[16:], stamp[0])
+	binary.LittleEndian.PutUint16(e[18:], stamp[0])
+	binary.LittleEndian.PutUint16(e[20:], uint16(cluster>>16))
+	binary.LittleEndian.PutUint16(e[22:], stamp[1])
+	binary.LittleEndian.PutUint16(e[24:], stamp[0])
+	binary.LittleEndian.PutUint16(e[26:], uint16(cluster))
+	binary.LittleEndian.PutUint32(e[28:], size)
+	return e
+}
+
+// longEntries returns the VFAT entries that store name for a short name,
+// last part first as they appear on disk
+func longEntries(name string, short [11]byte) []byte {
+	chars := utf16.Encode([]rune(name))
+	count := (len(chars) + 12) / 13
+	if len(chars)%13 != 0 {
+		chars = append(chars, 0)
+		for len(chars)%13 != 0 {
+			chars = append(chars, 0xFFFF)
+		}
+	}
+	sum := checksum(short)
+
+	var out []byte
+	for i := count; i >= 1; i-- {
+		e := make([]byte, entrySize)
+		e[0] = byte(i)
+		if i == count {
+			e[0] |= 0x40
+		}
+		e[11] = attrLongName
+		e[13] = sum
+		part := chars[(i-1)*13 : i*13]
+		for j, off := range longOffsets {
+			binary.LittleEndian.PutUint16(e[off:], part[j])
+		}
+		out = append(out, e...)
+	}
+	return out
+}
+
+// longOffsets are the positions of the 13 characters of a long name entry
+var longOffsets = [13]int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30}
+
+// checksum returns the checksum of a short name that ties long name entries
+// to it
+func checksum(short [11]byte) byte {
+	var sum byte
+	for _, c := range short {
+		sum = (sum&1)<<7 + sum>>1 + c
+	}
+	return sum
+}
+
+// dosTime returns t as a DOS date and time. Times before 1980 cannot be
+// represented and become the start of 1980.
+func dosTime(t time.Time) [2]uint16 {
+	if t.Year() < 1980 {
+		return [2]uint16{1<<5 | 1, 0}
+	}
+	date := uint16(t.Year()-1980)<<9 | uint16(t.Month())<<5 | uint16(t.Day())
+	clock := uint16(t.Hour())<<11 | uint16(t.Minute())<<5 | uint16(t.Second()/2)
+	return [2]uint16{date, clock}
+}
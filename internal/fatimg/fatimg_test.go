@@ -0,0 +1,275 @@
+package fatimg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	big := make([]byte, 100*1024+7)
+	rand.New(rand.NewSource(1)).Read(big)
+	files := []File{
+		{Path: "answers.txt", Data: []byte("HOSTNAMEOPTS=\"-n pi-kitchen\"\n")},
+		{Path: "pi-kitchen.apkovl.tar.gz", Data: big},
+		{Path: "README", Data: []byte("upper case 8.3 name")},
+		{Path: "extra/scripts/setup.sh", Data: []byte("#!/bin/sh\n")},
+		{Path: "extra/empty", Data: nil},
+		{Path: "café menu.txt", Data: []byte("unicode and spaces")},
+		{Path: "a-very-long-file-name-that-needs-several-entries.conf", Data: []byte("long")},
+		{Path: "a-very-long-file-name-that-needs-another-short-name.conf", Data: []byte("longer")},
+	}
+
+	var buf memImage
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := Write(&buf, files, Options{Label: "CIDATA", ModTime: modTime}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	data := buf.data
+	if len(data)%(1<<20) != 0 || len(data) > 34<<20 {
+		t.Errorf("image size = %d, want the smallest whole MiB", len(data))
+	}
+
+	// a FAT32 file system as the Microsoft specification determines it
+	boot := data[:512]
+	totalSectors := binary.LittleEndian.Uint32(boot[32:])
+	fatSectors := binary.LittleEndian.Uint32(boot[36:])
+	clusters := (totalSectors - 32 - 2*fatSectors) / uint32(boot[13])
+	if clusters < 65525 || binary.LittleEndian.Uint16(boot[22:]) != 0 || string(boot[82:90]) != "FAT32   " {
+		t.Errorf("image is not FAT32: %d clusters, type %q", clusters, boot[82:90])
+	}
+	if fatSectors*128 < clusters+2 {
+		t.Errorf("FAT of %d sectors cannot hold %d clusters", fatSectors, clusters)
+	}
+	if !bytes.Equal(data[6*512:8*512], data[:2*512]) {
+		t.Error("backup boot sector differs")
+	}
+
+	img, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if img.Label != "CIDATA" {
+		t.Errorf("Label = %q, want CIDATA", img.Label)
+	}
+	sortFiles(files)
+	sortFiles(img.Files)
+	if len(img.Files) != len(files) {
+		t.Fatalf("Read() returned %d files, want %d", len(img.Files), len(files))
+	}
+	for i := range files {
+		if img.Files[i].Path != files[i].Path || !bytes.Equal(img.Files[i].Data, files[i].Data) {
+			t.Errorf("file %d = %s (%d bytes), want %s (%d bytes)", i, img.Files[i].Path, len(img.Files[i].Data), files[i].Path, len(files[i].Data))
+		}
+	}
+
+	// the same input in any order gives the same image
+	var again memImage
+	reversed := make([]File, len(files))
+	for i, f := range files {
+		reversed[len(files)-1-i] = f
+	}
+	if err := Write(&again, reversed, Options{Label: "CIDATA", ModTime: modTime}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again.data) {
+		t.Error("Write() is not reproducible")
+	}
+}
+
+// memImage is an in-memory Target that counts the bytes written to it
+type memImage struct {
+	data    []byte
+	written int64
+}
+
+func (m *memImage) Truncate(size int64) error {
+	m.data = append(m.data, make([]byte, max(0, size-int64(len(m.data))))...)[:size]
+	return nil
+}
+
+func (m *memImage) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > int64(len(m.data)) {
+		return 0, fmt.Errorf("write of %d bytes at %d is outside the image", len(p), off)
+	}
+	m.written += int64(len(p))
+	return copy(m.data[off:], p), nil
+}
+
+func TestWrite_File(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "seed.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	// leftovers of an earlier image are cut off
+	if _, err := f.Write(bytes.Repeat([]byte{0xFF}, 40<<20)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Write(f, []File{{Path: "answers.txt", Data: []byte("x")}}, Options{Size: 34 << 20}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if info, err := f.Stat(); err != nil || info.Size() != 34<<20 {
+		t.Fatalf("image file = %v, %v, want 34 MiB", info, err)
+	}
+	img, err := Read(f)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(img.Files) != 1 || string(img.Files[0].Data) != "x" {
+		t.Errorf("Read() = %+v", img)
+	}
+	tail := make([]byte, 512)
+	if _, err := f.ReadAt(tail, 34<<20-512); err != nil || !bytes.Equal(tail, make([]byte, 512)) {
+		t.Errorf("last sector = %x, %v, want zeros", tail, err)
+	}
+}
+
+func sortFiles(files []File) {
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+}
+
+func TestWrite_Size(t *testing.T) {
+	var buf memImage
+	if err := Write(&buf, []File{{Path: "answers.txt", Data: []byte("x")}}, Options{Size: 64 << 20}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if len(buf.data) != 64<<20 {
+		t.Errorf("image size = %d, want 64 MiB", len(buf.data))
+	}
+	if buf.written > 64<<10 {
+		t.Errorf("Write() wrote %d bytes, want only the metadata and data regions", buf.written)
+	}
+	img, err := Read(bytes.NewReader(buf.data))
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if img.Label != DefaultLabel || len(img.Files) != 1 {
+		t.Errorf("Read() = %+v", img)
+	}
+
+	// files larger than the minimum size grow the image
+	buf = memImage{}
+	if err := Write(&buf, []File{{Path: "big", Data: make([]byte, 40<<20)}}, Options{}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if len(buf.data) < 41<<20 {
+		t.Errorf("image size = %d, want room for 40 MiB", len(buf.data))
+	}
+}
+
+func TestWrite_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []File
+		opts    Options
+		wantErr string
+	}{
+		{name: "long label", opts: Options{Label: "ALPINEHEROES"}, wantErr: "1 to 11 characters"},
+		{name: "invalid label", opts: Options{Label: "A/B"}, wantErr: "invalid volume label"},
+		{name: "absolute path", files: []File{{Path: "/etc/answers"}}, wantErr: "relative to the root"},
+		{name: "parent path", files: []File{{Path: "../answers"}}, wantErr: "relative to the root"},
+		{name: "invalid character", files: []File{{Path: "what?.txt"}}, wantErr: "contains '?'"},
+		{name: "trailing dot", files: []File{{Path: "answers."}}, wantErr: "ends with a dot"},
+		{name: "duplicate", files: []File{{Path: "answers.txt"}, {Path: "ANSWERS.TXT"}}, wantErr: "duplicate file path"},
+		{name: "file and directory", files: []File{{Path: "extra"}, {Path: "extra/file"}}, wantErr: "duplicate file path"},
+		{name: "unaligned size", opts: Options{Size: 64<<20 + 1}, wantErr: "not a multiple of 512"},
+		{name: "too small", opts: Options{Size: 16 << 20}, wantErr: "too small for FAT32"},
+		{name: "does not fit", files: []File{{Path: "big", Data: make([]byte, 40<<20)}}, opts: Options{Size: 40 << 20}, wantErr: "do not fit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf memImage
+			err := Write(&buf, tt.files, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Write() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShortName(t *testing.T) {
+	tests := []struct {
+		name     string
+		taken    []string
+		want     string
+		wantLong bool
+	}{
+		{name: "README", want: "README     "},
+		{name: "ANSWERS.TXT", want: "ANSWERS TXT"},
+		{name: "answers.txt", want: "ANSWERS TXT", wantLong: true},
+		{name: "answers.txt", taken: []string{"ANSWERS TXT"}, want: "ANSWER~1TXT", wantLong: true},
+		{name: "pi-kitchen.apkovl.tar.gz", want: "PI-KIT~1GZ ", wantLong: true},
+		{name: "user-data", want: "USER-D~1   ", wantLong: true},
+		{name: "café menu.txt", want: "CAF_ME~1TXT", wantLong: true},
+		{name: ".profile", want: "PROFIL~1   ", wantLong: true},
+		{name: "setup.conf", want: "SETUP~1 CON", wantLong: true},
+		{name: "a.b", taken: []string{"A       B  ", "A~1     B  "}, want: "A~2     B  ", wantLong: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taken := make(map[[11]byte]bool)
+			for _, s := range tt.taken {
+				taken[[11]byte([]byte(s))] = true
+			}
+			got, long := shortName(tt.name, taken)
+			if string(got[:]) != tt.want || long != tt.wantLong {
+				t.Errorf("shortName(%q) = %q, %v, want %q, %v", tt.name, got, long, tt.want, tt.wantLong)
+			}
+		})
+	}
+}
+
+func TestLongEntries(t *testing.T) {
+	short := [11]byte([]byte("PI-KIT~1GZ "))
+	entries := longEntries("pi-kitchen.apkovl.tar.gz", short)
+	if len(entries) != 2*32 {
+		t.Fatalf("longEntries() returned %d bytes, want two entries", len(entries))
+	}
+	if entries[0] != 0x42 || entries[32] != 0x01 {
+		t.Errorf("sequence numbers = %#x %#x, want 0x42 0x01", entries[0], entries[32])
+	}
+	if entries[13] != checksum(short) || entries[11] != 0x0F {
+		t.Errorf("entry attributes = %#x, checksum = %#x", entries[11], entries[13])
+	}
+	got := longString(readLong(entries))
+	if got != "pi-kitchen.apkovl.tar.gz" {
+		t.Errorf("long name = %q", got)
+	}
+}
+
+// readLong collects the characters of long name entries in name order
+func readLong(entries []byte) []uint16 {
+	n := len(entries) / 32
+	chars := make([]uint16, 13*n)
+	for k := 0; k < n; k++ {
+		e := entries[k*32:]
+		i := int(e[0]&0x3F) - 1
+		for j, o := range longOffsets {
+			chars[i*13+j] = binary.LittleEndian.Uint16(e[o:])
+		}
+	}
+	return chars
+}
+
+func TestDosTime(t *testing.T) {
+	got := dosTime(time.Date(2024, 5, 1, 12, 30, 45, 0, time.UTC))
+	want := [2]uint16{44<<9 | 5<<5 | 1, 12<<11 | 30<<5 | 22}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dosTime() = %v, want %v", got, want)
+	}
+	if got := dosTime(time.Unix(0, 0).UTC()); got != [2]uint16{1<<5 | 1, 0} {
+		t.Errorf("dosTime(1970) = %v, want 1980-01-01", got)
+	}
+}
@@ -0,0 +1,174 @@
+package fatimg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Image is the content of a FAT32 file system read by Read
+type Image struct {
+	Label string
+	// Files holds every regular file, directories are only part of the paths
+	Files []File
+}
+
+// volume is an open FAT32 file system
+type volume struct {
+	r           io.ReaderAt
+	clusterSize int64
+	dataStart   int64
+	fat         []uint32
+	// seen holds the directories read so far, to stop at loops
+	seen map[uint32]bool
+}
+
+// Read reads the files of a FAT32 file system, such as an image written by
+// Write. Long names are used where present, short names otherwise.
+func Read(r io.ReaderAt) (*Image, error) {
+	boot := make([]byte, sectorSize)
+	if _, err := r.ReadAt(boot, 0); err != nil {
+		return nil, fmt.Errorf("failed to read boot sector: %w", err)
+	}
+	bytesPerSector := int64(binary.LittleEndian.Uint16(boot[11:]))
+	sectorsPerCluster := int64(boot[13])
+	reserved := int64(binary.LittleEndian.Uint16(boot[14:]))
+	fats := int64(boot[16])
+	fatSize := int64(binary.LittleEndian.Uint32(boot[36:]))
+	if boot[510] != 0x55 || boot[511] != 0xAA || binary.LittleEndian.Uint16(boot[22:]) != 0 ||
+		bytesPerSector < sectorSize || sectorsPerCluster == 0 || fats == 0 || fatSize == 0 {
+		return nil, fmt.Errorf("not a FAT32 file system")
+	}
+
+	raw := make([]byte, fatSize*bytesPerSector)
+	if _, err := r.ReadAt(raw, reserved*bytesPerSector); err != nil {
+		return nil, fmt.Errorf("failed to read FAT: %w", err)
+	}
+	v := &volume{
+		r:           r,
+		clusterSize: sectorsPerCluster * bytesPerSector,
+		dataStart:   (reserved + fats*fatSize) * bytesPerSector,
+		fat:         make([]uint32, len(raw)/4),
+		seen:        make(map[uint32]bool),
+	}
+	for i := range v.fat {
+		v.fat[i] = binary.LittleEndian.Uint32(raw[i*4:]) & 0x0FFFFFFF
+	}
+
+	img := &Image{Label: strings.TrimRight(string(boot[71:82]), " ")}
+	if err := v.readDir(img, binary.LittleEndian.Uint32(boot[44:]), ""); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// chain returns the data of the cluster chain starting at cluster
+func (v *volume) chain(cluster uint32) ([]byte, error) {
+	var data []byte
+	for c, n := cluster, 0; c >= 2 && c < 0x0FFFFFF8; c, n = v.fat[c], n+1 {
+		// a chain longer than the FAT loops
+		if int(c) >= len(v.fat) || n >= len(v.fat) {
+			return nil, fmt.Errorf("invalid cluster chain at cluster %d", cluster)
+		}
+		buf := make([]byte, v.clusterSize)
+		if _, err := v.r.ReadAt(buf, v.dataStart+int64(c-2)*v.clusterSize); err != nil {
+			return nil, fmt.Errorf("failed to read cluster %d: %w", c, err)
+		}
+		data = append(data, buf...)
+	}
+	return data, nil
+}
+
+// readDir adds the files below the directory at cluster to img
+func (v *volume) readDir(img *Image, cluster uint32, prefix string) error {
+	if v.seen[cluster] {
+		return fmt.Errorf("directory %s loops", strings.TrimSuffix(prefix, "/"))
+	}
+	v.seen[cluster] = true
+	data, err := v.chain(cluster)
+	if err != nil {
+		return err
+	}
+
+	var long []uint16
+	var sum byte
+	for off := 0; off+entrySize <= len(data); off += entrySize {
+		e := data[off : off+entrySize]
+		attr := e[11]
+		switch {
+		case e[0] == 0x00:
+			return nil
+		case e[0] == 0xE5:
+			long = nil
+			continue
+		case attr == attrLongName:
+			if e[0]&0x40 != 0 {
+				long = make([]uint16, 13*int(e[0]&0x3F))
+				sum = e[13]
+			}
+			i := int(e[0]&0x3F) - 1
+			if long == nil || i < 0 || (i+1)*13 > len(long) || e[13] != sum {
+				long = nil
+				continue
+			}
+			for j, o := range longOffsets {
+				long[i*13+j] = binary.LittleEndian.Uint16(e[o:])
+			}
+			continue
+		case attr&attrVolumeID != 0:
+			if prefix == "" {
+				img.Label = strings.TrimRight(string(e[:11]), " ")
+			}
+			long = nil
+			continue
+		}
+
+		var short [11]byte
+		copy(short[:], e[:11])
+		name := shortString(short)
+		if long != nil && checksum(short) == sum {
+			name = longString(long)
+		}
+		long = nil
+		if name == "." || name == ".." {
+			continue
+		}
+
+		first := uint32(binary.LittleEndian.Uint16(e[20:]))<<16 | uint32(binary.LittleEndian.Uint16(e[26:]))
+		if attr&attrDirectory != 0 {
+			if err := v.readDir(img, first, prefix+name+"/"); err != nil {
+				return err
+			}
+			continue
+		}
+		content, err := v.chain(first)
+		if err != nil {
+			return err
+		}
+		size := binary.LittleEndian.Uint32(e[28:])
+		if int64(size) > int64(len(content)) {
+			return fmt.Errorf("%s%s is larger than its clusters", prefix, name)
+		}
+		img.Files = append(img.Files, File{Path: prefix + name, Data: content[:size]})
+	}
+	return nil
+}
+
+// shortString formats an 8.3 directory entry name as NAME.EXT
+func shortString(short [11]byte) string {
+	base := strings.TrimRight(string(short[:8]), " ")
+	return base + dotExt(strings.TrimRight(string(short[8:]), " "))
+}
+
+// longString decodes a long name up to its terminator
+func longString(chars []uint16) string {
+	for i, c := range chars {
+		if c == 0 {
+			chars = chars[:i]
+			break
+		}
+	}
+	return string(utf16.Decode(chars))
+}
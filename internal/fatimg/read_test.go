@@ -0,0 +1,60 @@
+package fatimg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRead_Errors(t *testing.T) {
+	var buf memImage
+	if err := Write(&buf, []File{{Path: "answers.txt", Data: []byte("x")}}, Options{ModTime: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.data
+
+	tests := []struct {
+		name    string
+		corrupt func(img []byte) []byte
+		wantErr string
+	}{
+		{name: "empty", corrupt: func([]byte) []byte { return nil }, wantErr: "failed to read boot sector"},
+		{name: "zeros", corrupt: func(img []byte) []byte { return make([]byte, len(img)) }, wantErr: "not a FAT32 file system"},
+		{
+			name: "FAT16",
+			corrupt: func(img []byte) []byte {
+				binary.LittleEndian.PutUint16(img[22:], 256)
+				return img
+			},
+			wantErr: "not a FAT32 file system",
+		},
+		{
+			name: "truncated",
+			corrupt: func(img []byte) []byte {
+				return img[:4096]
+			},
+			wantErr: "failed to read FAT",
+		},
+		{
+			name: "cluster chain loop",
+			corrupt: func(img []byte) []byte {
+				// the FAT starts after 32 reserved sectors, cluster 3 is the file
+				binary.LittleEndian.PutUint32(img[32*512+3*4:], 3)
+				return img
+			},
+			wantErr: "invalid cluster chain",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := tt.corrupt(bytes.Clone(valid))
+			_, err := Read(bytes.NewReader(img))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Read() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
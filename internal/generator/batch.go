@@ -0,0 +1,83 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+// Job is one answer file of a batch
+type Job struct {
+	Config *config.Config
+	Output string
+}
+
+// Result is the outcome of a Job. Err is the context error for jobs that
+// were not started because the batch was cancelled.
+type Result struct {
+	Job Job
+	Err error
+}
+
+// Batch generates the answer file of every job with a pool of at most
+// workers goroutines, or one per CPU if workers is not positive. The template
+// is compiled once from opts and shared by every job. Results, and anything
+// the jobs write to the stdout and stderr streams, come out in job order
+// regardless of which job finishes first. Cancelling ctx stops jobs from
+// being started; jobs already running finish. The error is only set if the
+// template cannot be compiled. A WithRenderer renderer is shared instead of
+// the template and must be safe for concurrent use.
+func Batch(ctx context.Context, jobs []Job, workers int, opts ...Option) ([]Result, error) {
+	base := New(nil, "", opts...)
+	var shared []Option
+	if base.renderer == nil {
+		tmpl, err := base.compile()
+		if err != nil {
+			return nil, err
+		}
+		shared = append(shared, WithCompiled(tmpl))
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	results := make([]Result, len(jobs))
+	stdout := make([]bytes.Buffer, len(jobs))
+	stderr := make([]bytes.Buffer, len(jobs))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				jobOpts := append(append(append([]Option{}, opts...), shared...), WithStreams(&stdout[i], &stderr[i]))
+				results[i].Err = New(jobs[i].Config, jobs[i].Output, jobOpts...).Generate()
+			}
+		}()
+	}
+
+	for i, job := range jobs {
+		results[i].Job = job
+		if ctx.Err() == nil {
+			select {
+			case next <- i:
+				continue
+			case <-ctx.Done():
+			}
+		}
+		results[i].Err = ctx.Err()
+	}
+	close(next)
+	wg.Wait()
+
+	for i := range jobs {
+		_, _ = stdout[i].WriteTo(base.stdout)
+		_, _ = stderr[i].WriteTo(base.stderr)
+	}
+	return results, nil
+}
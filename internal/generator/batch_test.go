@@ -0,0 +1,193 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+// hostJobs returns n jobs writing to dir, with hostnames host-000, host-001...
+func hostJobs(dir string, n int) []Job {
+	jobs := make([]Job, n)
+	for i := range jobs {
+		cfg := config.New()
+		cfg.Hostname = fmt.Sprintf("host-%03d", i)
+		jobs[i] = Job{Config: cfg, Output: filepath.Join(dir, cfg.Hostname+".txt")}
+	}
+	return jobs
+}
+
+func TestBatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	jobs := hostJobs(tmpDir, 50)
+	// an existing file makes one job fail without stopping the others
+	if err := os.WriteFile(jobs[7].Output, []byte("OLD=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	results, err := Batch(context.Background(), jobs, 4, WithStreams(io.Discard, &stderr))
+	if err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+	if len(results) != len(jobs) {
+		t.Fatalf("Batch() returned %d results, want %d", len(results), len(jobs))
+	}
+
+	for i, r := range results {
+		if r.Job != jobs[i] {
+			t.Errorf("result %d is for %s, want %s", i, r.Job.Output, jobs[i].Output)
+		}
+		if i == 7 {
+			if r.Err == nil || !strings.Contains(r.Err.Error(), "already exists") {
+				t.Errorf("result 7 error = %v, want the existing file reported", r.Err)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("result %d error = %v", i, r.Err)
+		}
+		data, err := os.ReadFile(r.Job.Output)
+		if err != nil || !strings.Contains(string(data), `HOSTNAMEOPTS="-n `+r.Job.Config.Hostname+`"`) {
+			t.Errorf("answer file of %s not written correctly: %v", r.Job.Config.Hostname, err)
+		}
+	}
+
+	// status messages come out in job order
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	if len(lines) != len(jobs)-1 {
+		t.Fatalf("got %d status lines, want %d", len(lines), len(jobs)-1)
+	}
+	for i, line := range lines {
+		j := i
+		if i >= 7 {
+			j++
+		}
+		if !strings.HasSuffix(line, jobs[j].Output) {
+			t.Errorf("status line %d = %q, want it for %s", i, line, jobs[j].Output)
+		}
+	}
+}
+
+func TestBatch_Stdout(t *testing.T) {
+	jobs := hostJobs(t.TempDir(), 20)
+	for i := range jobs {
+		jobs[i].Output = Stdout
+	}
+
+	var stdout bytes.Buffer
+	results, err := Batch(context.Background(), jobs, 0, WithStreams(&stdout, io.Discard))
+	if err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+	for i, r := range results {
+		if r.Err != nil {
+			t.Errorf("result %d error = %v", i, r.Err)
+		}
+	}
+
+	// every answer file is printed whole and in job order
+	parts := strings.SplitAfter(stdout.String(), "HOSTNAMEOPTS=")
+	if len(parts) != len(jobs)+1 {
+		t.Fatalf("got %d answer files, want %d", len(parts)-1, len(jobs))
+	}
+	for i, job := range jobs {
+		if !strings.HasPrefix(parts[i+1], `"-n `+job.Config.Hostname+`"`) {
+			t.Errorf("answer file %d is not for %s", i, job.Config.Hostname)
+		}
+	}
+}
+
+func TestBatch_Cancelled(t *testing.T) {
+	tmpDir := t.TempDir()
+	jobs := hostJobs(tmpDir, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := Batch(ctx, jobs, 2, WithStreams(io.Discard, io.Discard))
+	if err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+	for i, r := range results {
+		if r.Job != jobs[i] || !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("result %d = %+v, want the job skipped with context.Canceled", i, r)
+		}
+		if _, err := os.Stat(r.Job.Output); !os.IsNotExist(err) {
+			t.Errorf("cancelled job wrote %s", r.Job.Output)
+		}
+	}
+}
+
+func TestBatch_TemplateError(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmplPath := filepath.Join(tmpDir, "bad.tmpl")
+	if err := os.WriteFile(tmplPath, []byte("{{ .Hostname "), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Batch(context.Background(), hostJobs(tmpDir, 3), 2, WithTemplate(tmplPath))
+	if err == nil || results != nil {
+		t.Errorf("Batch() = %v, %v, want a template error and no results", results, err)
+	}
+}
+
+// BenchmarkGenerate renders one host per iteration with New().Generate(),
+// which parses the template every time
+func BenchmarkGenerate(b *testing.B) {
+	cfg := config.New()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := New(cfg, Stdout, WithStreams(io.Discard, io.Discard)).Generate(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkTemplate_Execute renders one host per iteration with a template
+// compiled once
+func BenchmarkTemplate_Execute(b *testing.B) {
+	cfg := config.New()
+	tmpl, err := Compile()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tmpl.Execute(io.Discard, cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkBatch writes a fleet of answer files and reports the cost per host
+func BenchmarkBatch(b *testing.B) {
+	for _, hosts := range []int{100, 1000} {
+		b.Run(fmt.Sprintf("hosts=%d", hosts), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				jobs := hostJobs(b.TempDir(), hosts)
+				b.StartTimer()
+				results, err := Batch(context.Background(), jobs, 0, WithStreams(io.Discard, io.Discard))
+				if err != nil {
+					b.Fatal(err)
+				}
+				for _, r := range results {
+					if r.Err != nil {
+						b.Fatal(r.Err)
+					}
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*hosts), "ns/host")
+		})
+	}
+}
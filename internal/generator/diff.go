@@ -0,0 +1,261 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// previousSecret stands in for a secret of the existing file that differs
+// from the configured one
+const previousSecret = "(previous secret)"
+
+// secretKeys start the lines that hold a secret in the formats the generator
+// writes: the answer file, the env and the JSON output
+var secretKeys = []string{"PWUSER=", "export ALPINE_PASSWORD=", `"password": `}
+
+// maskSecretLines returns old with its secrets replaced, so it can be diffed
+// against masked, the rendering of the masked configuration. A line that
+// holds a secret is recognised by the text before the secret in rendered, or
+// by one of secretKeys whether or not rendered has secrets. It becomes the
+// masked line if the secret is unchanged and shows previousSecret otherwise,
+// so a changed password is still visible in the diff. Secrets spanning
+// several lines cannot be recognised and are an error.
+func maskSecretLines(old, rendered, masked string) (string, error) {
+	renderedLines := splitLines(rendered)
+	maskedLines := splitLines(masked)
+	if len(renderedLines) != len(maskedLines) {
+		return "", fmt.Errorf("a secret spans several lines, so the diff cannot be shown without revealing it")
+	}
+
+	type secretLine struct{ rendered, masked, prefix, suffix string }
+	var secrets []secretLine
+	for i, line := range renderedLines {
+		m := maskedLines[i]
+		if line == m {
+			continue
+		}
+		prefix := 0
+		for prefix < len(line) && prefix < len(m) && line[prefix] == m[prefix] {
+			prefix++
+		}
+		// the mask may share leading characters with the secret
+		for prefix > 0 && !strings.HasPrefix(m[prefix:], config.Mask) {
+			prefix--
+		}
+		suffix := 0
+		for suffix < len(line)-prefix && suffix < len(m)-prefix && line[len(line)-1-suffix] == m[len(m)-1-suffix] {
+			suffix++
+		}
+		for suffix > 0 && !strings.HasSuffix(m[:len(m)-suffix], config.Mask) {
+			suffix--
+		}
+		secrets = append(secrets, secretLine{line, m, m[:prefix], m[len(m)-suffix:]})
+	}
+
+	lines := splitLines(old)
+	for i, line := range lines {
+		masked := false
+		for _, s := range secrets {
+			if line == s.rendered {
+				lines[i] = s.masked
+				masked = true
+				break
+			}
+			if s.prefix != "" && strings.HasPrefix(line, s.prefix) {
+				lines[i] = s.prefix + previousSecret + s.suffix
+				masked = true
+				break
+			}
+		}
+		if !masked {
+			prefix, suffix, ok, closed := splitSecretKey(line)
+			if ok && !closed {
+				return "", fmt.Errorf("a secret of the existing file spans several lines, so the diff cannot be shown without revealing it")
+			}
+			if ok {
+				lines[i] = prefix + previousSecret + suffix
+				masked = true
+			}
+		}
+		if masked && !strings.HasSuffix(line, "\n") {
+			lines[i] = strings.TrimSuffix(lines[i], "\n")
+		}
+	}
+	return strings.Join(lines, ""), nil
+}
+
+// splitSecretKey returns the text before and after the secret of a line that
+// starts with one of secretKeys, keeping the quotes around the secret. ok is
+// false for any other line, and closed is false if the quoted secret goes on
+// past the end of the line.
+func splitSecretKey(line string) (prefix, suffix string, ok, closed bool) {
+	body := strings.TrimLeft(line, " \t")
+	indent := line[:len(line)-len(body)]
+	for _, key := range secretKeys {
+		value, found := strings.CutPrefix(body, key)
+		if !found {
+			continue
+		}
+		value, newline := strings.CutSuffix(value, "\n")
+		end := ""
+		if newline {
+			end = "\n"
+		}
+		if v, comma := strings.CutSuffix(value, ","); comma {
+			value, end = v, ","+end
+		}
+		if value == "" || (value[0] != '"' && value[0] != '\'') {
+			return indent + key, end, true, !strings.HasSuffix(value, `\`)
+		}
+		q := value[:1]
+		closed = len(value) >= 2 && strings.HasSuffix(value, q) && (q == "'" || !escaped(value[:len(value)-1]))
+		return indent + key + q, q + end, true, closed
+	}
+	return "", "", false, false
+}
+
+// escaped reports whether s ends in an odd number of backslashes, which
+// escape the character after it
+func escaped(s string) bool {
+	n := 0
+	for n < len(s) && s[len(s)-1-n] == '\\' {
+		n++
+	}
+	return n%2 == 1
+}
+
+// unifiedDiff returns the changes from a to b in unified diff format, or an
+// empty string if they are equal
+func unifiedDiff(oldName, newName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	oldLines := splitLines(a)
+	newLines := splitLines(b)
+	ops := diffLines(oldLines, newLines)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+
+	for start := 0; start < len(ops); {
+		// find the next change and the run of ops belonging to its hunk
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		first := max(start-diffContext, 0)
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContext {
+				break
+			}
+			end = next
+		}
+		last := min(end+diffContext, len(ops))
+
+		oldStart, newStart := ops[first].oldLine, ops[first].newLine
+		var oldCount, newCount int
+		for _, op := range ops[first:last] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, op := range ops[first:last] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.text)
+			if !strings.HasSuffix(op.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = last
+	}
+	return out.String()
+}
+
+// diffOp is one line of a diff. oldLine and newLine are the zero-based
+// positions the line would have in each file.
+type diffOp struct {
+	kind    byte
+	text    string
+	oldLine int
+	newLine int
+}
+
+// diffLines computes a minimal line diff using the longest common
+// subsequence, which is fast enough for answer-file sized inputs
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{kind: ' ', text: a[i], oldLine: i, newLine: j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{kind: '-', text: a[i], oldLine: i, newLine: j})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', text: b[j], oldLine: i, newLine: j})
+			j++
+		}
+	}
+	return ops
+}
+
+// hunkRange formats the start and length of a hunk, where an empty range
+// starts at the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits s after each newline, keeping the newlines
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
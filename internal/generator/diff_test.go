@@ -0,0 +1,130 @@
+package generator
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "equal",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+			want: "",
+		},
+		{
+			name: "new file",
+			a:    "",
+			b:    "a\nb\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "changed line with context",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			b:    "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: "--- old\n+++ new\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "separate hunks",
+			a:    "a\n1\n2\n3\n4\n5\n6\n7\nb\n",
+			b:    "A\n1\n2\n3\n4\n5\n6\n7\nB\n",
+			want: "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-b\n+B\n",
+		},
+		{
+			name: "missing final newline",
+			a:    "a\n",
+			b:    "a\nb",
+			want: "--- old\n+++ new\n@@ -1 +1,2 @@\n a\n+b\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("old", "new", tt.a, tt.b); got != tt.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaskSecretLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		old      string
+		rendered string
+		masked   string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "unchanged secret",
+			old:      "A=\"1\"\nPW=\"s3cret\"\n",
+			rendered: "A=\"2\"\nPW=\"s3cret\"\n",
+			masked:   "A=\"2\"\nPW=\"********\"\n",
+			want:     "A=\"1\"\nPW=\"********\"\n",
+		},
+		{
+			name:     "changed secret",
+			old:      "PW=\"old\"\nA=\"1\"",
+			rendered: "PW=\"new\"\nA=\"1\"\n",
+			masked:   "PW=\"********\"\nA=\"1\"\n",
+			want:     "PW=\"(previous secret)\"\nA=\"1\"",
+		},
+		{
+			name:     "secret starting like the mask",
+			old:      "PW=\"old\"\n",
+			rendered: "PW=\"*new*\"\n",
+			masked:   "PW=\"********\"\n",
+			want:     "PW=\"(previous secret)\"\n",
+		},
+		{
+			name:     "no secrets",
+			old:      "A=\"1\"\n",
+			rendered: "A=\"2\"\n",
+			masked:   "A=\"2\"\n",
+			want:     "A=\"1\"\n",
+		},
+		{
+			name:     "secret only in the old file",
+			old:      "A=\"1\"\nPWUSER=\"old \\\" pass\"\n",
+			rendered: "A=\"2\"\n",
+			masked:   "A=\"2\"\n",
+			want:     "A=\"1\"\nPWUSER=\"(previous secret)\"\n",
+		},
+		{
+			name:     "JSON and env secrets only in the old file",
+			old:      "{\n  \"password\": \"old\",\n}\nexport ALPINE_PASSWORD='it'\\''s'",
+			rendered: "{\n}\n",
+			masked:   "{\n}\n",
+			want:     "{\n  \"password\": \"(previous secret)\",\n}\nexport ALPINE_PASSWORD='(previous secret)'",
+		},
+		{
+			name:     "multi-line secret only in the old file",
+			old:      "PWUSER=\"two\nlines\"\n",
+			rendered: "A=\"1\"\n",
+			masked:   "A=\"1\"\n",
+			wantErr:  true,
+		},
+		{
+			name:     "multi-line secret",
+			old:      "PW=\"old\"\n",
+			rendered: "PW=\"two\nlines\"\n",
+			masked:   "PW=\"********\"\n",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := maskSecretLines(tt.old, tt.rendered, tt.masked)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("maskSecretLines() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("maskSecretLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/btassone/alpine-hero/internal/passwd"
+)
+
+// funcs are the functions available to answer file templates. Functions
+// taking the piped value put it last so they can be used in pipelines, e.g.
+// {{ .Timezone | default "UTC" | shellEscape }}.
+//
+//	shellEscape VALUE    escape VALUE for use inside double quotes
+//	quote VALUE          wrap VALUE in single quotes as one shell word
+//	join SEP LIST        join the elements of LIST with SEP
+//	default DEF VALUE    VALUE, or DEF if VALUE is empty
+//	indent N TEXT        prefix every line of TEXT with N spaces
+//	upper VALUE          VALUE in upper case
+//	lower VALUE          VALUE in lower case
+//	env NAME             value of environment variable NAME
+//	toJSON VALUE         VALUE encoded as JSON
+//	hashPassword VALUE   SHA-512 crypt(3) hash of VALUE with a random salt
+var funcs = template.FuncMap{
+	"shellEscape":  shellEscape,
+	"quote":        Quote,
+	"join":         join,
+	"default":      defaultValue,
+	"indent":       indent,
+	"upper":        strings.ToUpper,
+	"lower":        strings.ToLower,
+	"env":          os.Getenv,
+	"toJSON":       toJSON,
+	"hashPassword": passwd.Hash,
+}
+
+func join(sep string, list []string) string {
+	return strings.Join(list, sep)
+}
+
+func defaultValue(def, value string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+func indent(n int, text string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(text, "\n", "\n"+pad)
+}
+
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,115 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+func renderTemplate(t *testing.T, tmpl string, opts ...Option) (string, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "answers.tmpl")
+	if err := os.WriteFile(path, []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.New()
+	cfg.Timezone = ""
+	cfg.SSHKey = ""
+
+	var buf strings.Builder
+	err := New(cfg, "", append([]Option{WithTemplate(path)}, opts...)...).Render(&buf)
+	return buf.String(), err
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	t.Setenv("ALPINE_HERO_SITE", "lab")
+
+	tests := []struct {
+		name string
+		tmpl string
+		want string
+	}{
+		{name: "join", tmpl: `{{ join ":" .Groups }}`, want: "audio:video:netdev"},
+		{name: "default for empty value", tmpl: `{{ .Timezone | default "UTC" }}`, want: "UTC"},
+		{name: "default keeps value", tmpl: `{{ .Keymap | default "uk" }}`, want: "us"},
+		{name: "indent", tmpl: `{{ indent 4 "a\nb" }}`, want: "    a\n    b"},
+		{name: "quote", tmpl: `{{ quote "it's" }}`, want: `'it'\''s'`},
+		{name: "upper", tmpl: `{{ upper .Hostname }}`, want: "ALPINEHOST"},
+		{name: "lower", tmpl: `{{ lower "MiXeD" }}`, want: "mixed"},
+		{name: "env", tmpl: `{{ env "ALPINE_HERO_SITE" }}`, want: "lab"},
+		{name: "toJSON", tmpl: `{{ toJSON .Groups }}`, want: `["audio","video","netdev"]`},
+		{name: "pipeline", tmpl: `{{ .Timezone | default "Europe/London" | shellEscape }}`, want: "Europe/London"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderTemplate(t, tt.tmpl)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateFuncs_HashPassword(t *testing.T) {
+	got, err := renderTemplate(t, `{{ hashPassword .Password }}`)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if !strings.HasPrefix(got, "$6$") || strings.Contains(got, "changeme") {
+		t.Errorf("hashPassword = %q, want a SHA-512 crypt hash", got)
+	}
+}
+
+func TestGenerator_Partials(t *testing.T) {
+	partials := t.TempDir()
+	extras := `{{ define "site-extras" }}SITE="{{ shellEscape .Hostname }}-extra"{{ end }}`
+	if err := os.WriteFile(filepath.Join(partials, "extras.tmpl"), []byte(extras), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(partials, "ignored.txt"), []byte(`{{ .Broken`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := renderTemplate(t, `HOSTNAME="{{ .Hostname }}"
+{{ template "site-extras" . }}`, WithPartials(partials))
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if got != "HOSTNAME=\"alpinehost\"\nSITE=\"alpinehost-extra\"" {
+		t.Errorf("Render() = %q", got)
+	}
+
+	if _, err := renderTemplate(t, `{{ template "site-extras" . }}`); err == nil {
+		t.Error("Render() without partials should fail for an undefined template")
+	}
+	if _, err := renderTemplate(t, `x`, WithPartials(filepath.Join(partials, "missing"))); err == nil {
+		t.Error("Render() should fail for a missing partials directory")
+	}
+}
+
+func TestGenerator_MissingKeys(t *testing.T) {
+	if _, err := renderTemplate(t, `{{ .Hostnme }}`); err == nil || !strings.Contains(err.Error(), "Hostnme") {
+		t.Errorf("Render() error = %v, want error naming the unknown field", err)
+	}
+
+	g := New(config.New(), "")
+	tmpl, err := g.loadTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err = tmpl.New("map").Parse(`{{ .missing }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpl.Execute(&strings.Builder{}, map[string]string{}); err == nil {
+		t.Error("Execute() should fail for a missing map key with missingkey=error")
+	}
+}
@@ -1,149 +1,645 @@
 package generator
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/templates"
 )
 
-// Generator handles the generation of Alpine Linux answer files
+// Generator handles the generation of Alpine Linux answer files. Its template
+// is parsed on first use and reused by later calls. A Generator is not safe
+// for concurrent use; share a compiled Template between generators instead.
 type Generator struct {
-	config *config.Config
-	output string
+	config   *config.Config
+	output   string
+	template string
+	partials string
+	stdout   io.Writer
+	stderr   io.Writer
+	force    bool
+	backup   bool
+	diff     bool
+	dryRun   bool
+	mkdir    bool
+	policy   config.OutputPolicy
+	compiled *Template
+	renderer Renderer
+}
+
+// now returns the time used to name backups
+var now = time.Now
+
+// Stdout is the output path that makes Generate write the answer file to
+// standard output instead of a file
+const Stdout = "-"
+
+// Option configures optional Generator behaviour
+type Option func(*Generator)
+
+// WithTemplate renders the template file at path instead of the built-in
+// one. It takes precedence over TEMPLATE_DIR.
+func WithTemplate(path string) Option {
+	return func(g *Generator) {
+		g.template = path
+	}
+}
+
+// WithPartials loads every *.tmpl file in dir alongside the answer file
+// template, so templates it defines can be used with
+// {{ template "name" . }}
+func WithPartials(dir string) Option {
+	return func(g *Generator) {
+		g.partials = dir
+	}
+}
+
+// WithStreams sets where Generate writes the answer file when the output
+// path is Stdout, and where it writes status messages. They default to
+// os.Stdout and os.Stderr.
+func WithStreams(stdout, stderr io.Writer) Option {
+	return func(g *Generator) {
+		g.stdout = stdout
+		g.stderr = stderr
+	}
+}
+
+// WithForce allows Generate to replace an existing output file
+func WithForce(force bool) Option {
+	return func(g *Generator) {
+		g.force = force
+	}
+}
+
+// WithBackup makes Generate keep the file it replaces as
+// "<output>.<timestamp>.bak"
+func WithBackup(backup bool) Option {
+	return func(g *Generator) {
+		g.backup = backup
+	}
+}
+
+// WithDiff makes Generate write a unified diff between the existing output
+// file and the new answer file to the stdout writer instead of writing it.
+// Secrets are masked on both sides of the diff.
+func WithDiff(diff bool) Option {
+	return func(g *Generator) {
+		g.diff = diff
+	}
+}
+
+// WithDryRun makes Generate run every check a real run does but write the
+// answer file to the stdout writer, with secret config fields masked, instead
+// of to the output path
+func WithDryRun(dryRun bool) Option {
+	return func(g *Generator) {
+		g.dryRun = dryRun
+	}
+}
+
+// WithCreateDirs makes Generate create missing parent directories of the
+// output path before writing it
+func WithCreateDirs(create bool) Option {
+	return func(g *Generator) {
+		g.mkdir = create
+	}
+}
+
+// WithOutputPolicy checks the output path against policy instead of
+// config.DefaultOutputPolicy
+func WithOutputPolicy(policy config.OutputPolicy) Option {
+	return func(g *Generator) {
+		g.policy = policy
+	}
 }
 
 // New creates a new Generator instance
-func New(cfg *config.Config, output string) *Generator {
-	return &Generator{
+func New(cfg *config.Config, output string, opts ...Option) *Generator {
+	g := &Generator{
 		config: cfg,
 		output: output,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		policy: config.DefaultOutputPolicy(),
+	}
+	for _, opt := range opts {
+		opt(g)
 	}
+	return g
 }
 
-// Generate creates the answer file based on the configuration
+// Generate creates the answer file based on the configuration. An output
+// path of Stdout streams the answer file to the stdout writer so it can be
+// piped into other tools; status messages always go to the stderr writer.
 func (g *Generator) Generate() error {
-	tmplPath := filepath.Join(getTemplateDir(), "answers.tmpl")
-
-	t, err := template.ParseFiles(tmplPath)
+	r, err := g.loadRenderer()
 	if err != nil {
-		return fmt.Errorf("failed to parse template: %w", err)
+		return err
 	}
 
-	if err := validateOutputPath(g.output); err != nil {
-		return err
+	if g.output == Stdout {
+		if g.dryRun {
+			return g.dryRunRender(r)
+		}
+		return r.Render(g.stdout, g.config)
 	}
 
-	f, err := os.Create(g.output)
+	path, err := resolveOutputPath(g.output, g.policy, g.mkdir)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return err
 	}
-	if err := f.Chmod(0600); err != nil {
-		_ = f.Close()
-		return fmt.Errorf("failed to set file permissions: %w", err)
+
+	// Render fully before touching the output so a template error cannot
+	// leave a truncated file behind
+	var buf bytes.Buffer
+	if err := r.Render(&buf, g.config); err != nil {
+		return err
+	}
+
+	existing, err := os.ReadFile(path)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read existing output file: %w", err)
 	}
-	defer func(f *os.File) {
-		err := f.Close()
+
+	if g.diff {
+		oldName := g.output
+		if !exists {
+			oldName = os.DevNull
+		}
+		// diff the masked rendering, so secrets are not printed
+		var masked bytes.Buffer
+		if err := r.Render(&masked, g.config.Masked()); err != nil {
+			return err
+		}
+		old, err := maskSecretLines(string(existing), buf.String(), masked.String())
 		if err != nil {
-			fmt.Printf("failed to close output file: %v\n", err)
+			return err
 		}
-	}(f)
+		_, err = io.WriteString(g.stdout, unifiedDiff(oldName, g.output, old, masked.String()))
+		return err
+	}
 
-	if err := t.Execute(f, g.config); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+	if exists && !g.force {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", g.output)
+	}
+	if g.dryRun {
+		if err := g.dryRunRender(r); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(g.stderr, "Dry run: %s was not written\n", g.output)
+		return nil
+	}
+	if err := g.replace(path, exists, writeData(buf.Bytes())); err != nil {
+		return err
 	}
 
-	fmt.Printf("Successfully generated answers file: %s\n", g.output)
+	if g.renderer != nil {
+		_, _ = fmt.Fprintf(g.stderr, "Successfully wrote %s\n", g.output)
+		return nil
+	}
+	_, _ = fmt.Fprintf(g.stderr, "Successfully generated answers file: %s\n", g.output)
 	return nil
 }
 
-func getTemplateDir() string {
-	if dir := os.Getenv("TEMPLATE_DIR"); dir != "" {
-		return dir
+// WriteFile writes data, such as an archive built around the answer file, to
+// the output path with the checks Generate applies: the output policy,
+// overwrite protection, backups and atomic replacement. An output path of
+// Stdout writes data to the stdout writer, and a dry run writes nothing.
+func (g *Generator) WriteFile(data []byte) error {
+	if g.output == Stdout {
+		if g.dryRun {
+			return nil
+		}
+		_, err := g.stdout.Write(data)
+		return err
 	}
-	return "templates"
+	return g.writeOutput(writeData(data))
 }
 
-// validateOutputPath ensures the output path is safe and valid
-func validateOutputPath(path string) error {
-	cleanPath := filepath.Clean(path)
-	absPath, err := filepath.Abs(cleanPath)
+// WriteWith is WriteFile for output built in place, such as a disk image too
+// large to hold in memory: write fills the new file and may write it at any
+// offset. An output path of Stdout gives write a temporary file that is
+// copied to the stdout writer afterwards.
+func (g *Generator) WriteWith(write func(f *os.File) error) error {
+	if g.output != Stdout {
+		return g.writeOutput(write)
+	}
+	if g.dryRun {
+		return nil
+	}
+	f, err := os.CreateTemp("", "alpine-hero-*")
 	if err != nil {
-		return fmt.Errorf("invalid path: %w", err)
+		return fmt.Errorf("failed to create temporary file: %w", err)
 	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+	if err := write(f); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read temporary file: %w", err)
+	}
+	_, err = io.Copy(g.stdout, f)
+	return err
+}
 
-	if strings.Contains(cleanPath, "..") {
-		normalizedPath := filepath.ToSlash(absPath) + "/"
-		if strings.Contains(normalizedPath, "/etc/") ||
-			strings.Contains(normalizedPath, "/usr/") ||
-			strings.Contains(normalizedPath, "/boot/") ||
-			strings.Contains(normalizedPath, "/root/") ||
-			(strings.Contains(normalizedPath, "/var/") && !strings.Contains(normalizedPath, "/var/folders/")) {
-			return fmt.Errorf("invalid output path: output path not allowed: %s", path)
-		}
+// writeOutput writes the output path with write after the checks of
+// WriteFile
+func (g *Generator) writeOutput(write func(f *os.File) error) error {
+	path, err := resolveOutputPath(g.output, g.policy, g.mkdir)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(path)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read existing output file: %w", err)
+	}
+	if exists && !g.force {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", g.output)
+	}
+	if g.dryRun {
+		_, _ = fmt.Fprintf(g.stderr, "Dry run: %s was not written\n", g.output)
 		return nil
 	}
+	if err := g.replace(path, exists, write); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(g.stderr, "Successfully wrote %s\n", g.output)
+	return nil
+}
+
+// replace backs up the existing file at path if asked to, creates missing
+// directories if asked to and atomically replaces path with the file filled
+// by write
+func (g *Generator) replace(path string, exists bool, write func(f *os.File) error) error {
+	if exists && g.backup {
+		backupPath := fmt.Sprintf("%s.%s.bak", path, now().Format("20060102-150405"))
+		if err := copyFile(path, backupPath); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+		_, _ = fmt.Fprintf(g.stderr, "Saved previous version to %s\n", backupPath)
+	}
 
-	if !filepath.IsAbs(cleanPath) {
+	if g.mkdir {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+	return writeFileAtomic(path, write)
+}
+
+// writeData returns a write function for replace that writes data
+func writeData(data []byte) func(f *os.File) error {
+	return func(f *os.File) error {
+		if _, err := f.Write(data); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
 		return nil
 	}
+}
+
+// copyFile copies the file at src to a new file at dst readable only by the
+// owner, without reading it into memory
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// dryRunRender renders the real configuration to check it exactly as a real
+// run would, then writes the output with secrets masked to stdout
+func (g *Generator) dryRunRender(r Renderer) error {
+	if err := r.Render(io.Discard, g.config); err != nil {
+		return err
+	}
+	return r.Render(g.stdout, g.config.Masked())
+}
+
+// writeFileAtomic fills a temporary file in the same directory as path with
+// write, syncs it and renames it over path, so readers see either the old or
+// the new file and never a partial one
+func writeFileAtomic(path string, write func(f *os.File) error) (err error) {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if err := f.Chmod(0600); err != nil {
+		return fmt.Errorf("failed to set file permissions: %w", err)
+	}
+	if err := write(f); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync output file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close output file: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace output file: %w", err)
+	}
+
+	// make the rename itself durable; not every platform can sync a directory
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+	return nil
+}
+
+// Render renders the configuration and writes the answer file, or the
+// output of the WithRenderer renderer, to w instead of the output path
+func (g *Generator) Render(w io.Writer) error {
+	r, err := g.loadRenderer()
+	if err != nil {
+		return err
+	}
+	return r.Render(w, g.config)
+}
 
-	allowedPrefixes := []string{
-		"/tmp/",
-		os.TempDir(),
-		filepath.Join(os.Getenv("HOME"), "alpine-template"),
-		".",
+// Template is a parsed answer file template together with its partials.
+// Parsing is the expensive part of rendering, so a Template should be
+// compiled once and shared; it is safe for concurrent use.
+type Template struct {
+	tmpl *template.Template
+}
+
+// Compile parses the template selected by opts: the WithTemplate file, the
+// answers.tmpl file in TEMPLATE_DIR, or the built-in template, together with
+// any WithPartials
+func Compile(opts ...Option) (*Template, error) {
+	return New(nil, "", opts...).compile()
+}
+
+// Execute renders the answer file for cfg to w
+func (t *Template) Execute(w io.Writer, cfg *config.Config) error {
+	if err := t.tmpl.Execute(w, cfg); err != nil {
+		return fmt.Errorf("failed to execute template: %w", err)
 	}
+	return nil
+}
 
-	if tempDir := os.Getenv("TMPDIR"); tempDir != "" {
-		allowedPrefixes = append(allowedPrefixes, tempDir)
+// Render renders the answer file for cfg to w, making a Template the
+// Renderer of the answers format
+func (t *Template) Render(w io.Writer, cfg *config.Config) error {
+	return t.Execute(w, cfg)
+}
+
+// WithCompiled makes the generator use an already compiled template instead
+// of parsing one, which makes WithTemplate and WithPartials irrelevant
+func WithCompiled(t *Template) Option {
+	return func(g *Generator) {
+		g.compiled = t
 	}
+}
 
-	isAllowed := false
-	for _, prefix := range allowedPrefixes {
-		absPrefix, err := filepath.Abs(prefix)
+// compile returns the generator's template, parsing it on first use
+func (g *Generator) compile() (*Template, error) {
+	if g.compiled == nil {
+		t, err := g.parseTemplate()
 		if err != nil {
-			continue
+			return nil, err
 		}
+		g.compiled = &Template{tmpl: t}
+	}
+	return g.compiled, nil
+}
 
-		if strings.HasPrefix(absPath, absPrefix) {
-			isAllowed = true
-			break
+// loadRenderer returns the WithRenderer renderer, or the generator's template
+func (g *Generator) loadRenderer() (Renderer, error) {
+	if g.renderer != nil {
+		return g.renderer, nil
+	}
+	return g.compile()
+}
+
+// loadTemplate returns the parsed text/template of the generator
+func (g *Generator) loadTemplate() (*template.Template, error) {
+	t, err := g.compile()
+	if err != nil {
+		return nil, err
+	}
+	return t.tmpl, nil
+}
+
+// parseTemplate parses the template set with WithTemplate, the answers.tmpl
+// file in TEMPLATE_DIR, or the built-in template, in that order, followed by
+// any partials
+func (g *Generator) parseTemplate() (*template.Template, error) {
+	tmplPath := g.template
+	if tmplPath == "" {
+		if dir := getTemplateDir(); dir != "" {
+			tmplPath = filepath.Join(dir, "answers.tmpl")
 		}
 	}
 
-	if !isAllowed {
-		tempPatterns := []string{
-			"/var/folders/",
-			"/tmp/",
+	name := "answers.tmpl"
+	if tmplPath != "" {
+		name = filepath.Base(tmplPath)
+	}
+	t := template.New(name).Funcs(funcs).Option("missingkey=error")
+
+	var err error
+	if tmplPath == "" {
+		_, err = t.Parse(templates.Answers)
+	} else {
+		_, err = t.ParseFiles(tmplPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	if g.partials != "" {
+		if info, err := os.Stat(g.partials); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("partials directory %s is not a directory", g.partials)
+		}
+		pattern := filepath.Join(g.partials, "*.tmpl")
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid partials directory: %w", err)
 		}
-		for _, pattern := range tempPatterns {
-			if strings.HasPrefix(absPath, pattern) {
-				isAllowed = true
-				break
+		if len(matches) > 0 {
+			if _, err := t.ParseFiles(matches...); err != nil {
+				return nil, fmt.Errorf("failed to parse partials: %w", err)
 			}
 		}
 	}
+	return t, nil
+}
 
-	if !isAllowed {
-		return fmt.Errorf("invalid output path: output path not allowed: %s", path)
+func getTemplateDir() string {
+	return os.Getenv("TEMPLATE_DIR")
+}
+
+// validateOutputPath resolves symbolic links in path and checks the result
+// against policy. It returns the path that should be written, which is the
+// link target when path is a followed symbolic link.
+func validateOutputPath(path string, policy config.OutputPolicy) (string, error) {
+	return resolveOutputPath(path, policy, false)
+}
+
+// resolveOutputPath is validateOutputPath, optionally allowing parent
+// directories that do not exist yet. Those are checked as if they were
+// created inside their nearest existing ancestor.
+func resolveOutputPath(path string, policy config.OutputPolicy, allowMissing bool) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %w", err)
 	}
 
 	parentDir := filepath.Dir(absPath)
-	info, err := os.Stat(parentDir)
+	existing, missing := parentDir, ""
+	for {
+		info, err := os.Stat(existing)
+		if err == nil {
+			if !info.IsDir() {
+				return "", fmt.Errorf("parent path is not a directory: %s", existing)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("cannot access parent directory: %w", err)
+		}
+		if !allowMissing || existing == filepath.Dir(existing) {
+			return "", fmt.Errorf("parent directory does not exist: %s", parentDir)
+		}
+		missing = filepath.Join(filepath.Base(existing), missing)
+		existing = filepath.Dir(existing)
+	}
+
+	resolvedParent, err := filepath.EvalSymlinks(existing)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("parent directory does not exist: %s", parentDir)
+		return "", fmt.Errorf("cannot resolve parent directory: %w", err)
+	}
+	target := filepath.Join(resolvedParent, missing, filepath.Base(absPath))
+
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if !policy.FollowSymlinks {
+			return "", fmt.Errorf("output path %s is a symbolic link and output.follow_symlinks is disabled", path)
+		}
+		if target, err = resolveLink(target); err != nil {
+			return "", fmt.Errorf("cannot resolve symbolic link %s: %w", path, err)
 		}
-		return fmt.Errorf("cannot access parent directory: %w", err)
 	}
 
-	if !info.IsDir() {
-		return fmt.Errorf("parent path is not a directory: %s", parentDir)
+	allowed, _ := matchRoot(target, policy.AllowedRoots)
+	denied, deniedBy := matchRoot(target, policy.DeniedRoots)
+	// the working and temporary directories open up a denied root containing
+	// them, such as /root for root's working directory or /var for the macOS
+	// temporary directory, but not one at or below them
+	working, _ := matchRoot(target, workingRoots())
+	switch {
+	case denied > allowed && denied >= working:
+		return "", fmt.Errorf("output path %s is not allowed: %s is under denied root %s (output.denied_roots)", path, target, deniedBy)
+	case len(policy.AllowedRoots) > 0 && allowed < 0:
+		return "", fmt.Errorf("output path %s is not allowed: %s is not under any allowed root (output.allowed_roots: %s)",
+			path, target, strings.Join(policy.AllowedRoots, ", "))
 	}
+	return target, nil
+}
 
-	return nil
+// workingRoots returns the current working directory and the temporary
+// directory
+func workingRoots() []string {
+	roots := []string{os.TempDir()}
+	if wd, err := os.Getwd(); err == nil {
+		roots = append(roots, wd)
+	}
+	return roots
+}
+
+// resolveLink returns the final target of the symbolic link at path. Unlike
+// filepath.EvalSymlinks the target does not have to exist yet, only its
+// directory does.
+func resolveLink(path string) (string, error) {
+	for i := 0; i < 40; i++ {
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) || (err == nil && info.Mode()&os.ModeSymlink == 0) {
+			return path, nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		link, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(path), link)
+		}
+		dir, err := filepath.EvalSymlinks(filepath.Dir(link))
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(dir, filepath.Base(link))
+	}
+	return "", fmt.Errorf("too many levels of symbolic links")
+}
+
+// matchRoot returns the length of the longest root in roots containing path,
+// or -1 if none does, together with that root. Roots are resolved the same
+// way as the path so symbolic links cannot be used to bypass them.
+func matchRoot(path string, roots []string) (int, string) {
+	best, bestRoot := -1, ""
+	for _, root := range roots {
+		resolved, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		if r, err := filepath.EvalSymlinks(resolved); err == nil {
+			resolved = r
+		}
+		if !withinRoot(path, resolved) {
+			continue
+		}
+		if len(resolved) > best {
+			best, bestRoot = len(resolved), root
+		}
+	}
+	return best, bestRoot
+}
+
+// withinRoot reports whether path is root or lies below it
+func withinRoot(path, root string) bool {
+	if path == root {
+		return true
+	}
+	if !strings.HasSuffix(root, string(filepath.Separator)) {
+		root += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, root)
 }
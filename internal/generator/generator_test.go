@@ -1,10 +1,16 @@
 package generator
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/btassone/alpine-hero/internal/config"
 )
@@ -137,15 +143,39 @@ func TestValidateOutputPath(t *testing.T) {
 		t.Fatalf("Failed to create test file: %v", err)
 	}
 
+	// Create a symlinked directory and a symlinked output file
+	linkDir := filepath.Join(tmpDir, "linkdir")
+	if err := os.Symlink(subDir, linkDir); err != nil {
+		t.Fatal(err)
+	}
+	linkTarget := filepath.Join(subDir, "target.txt")
+	linkFile := filepath.Join(tmpDir, "link.txt")
+	if err := os.Symlink(linkTarget, linkFile); err != nil {
+		t.Fatal(err)
+	}
+
+	resolvedTmp, err := filepath.EvalSymlinks(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolvedSub := filepath.Join(resolvedTmp, "subdir")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	tests := []struct {
 		name        string
 		path        string
+		policy      *config.OutputPolicy
+		want        string
 		wantErr     bool
 		errContains string
 	}{
 		{
 			name:    "valid path in temp directory",
 			path:    filepath.Join(tmpDir, "valid.txt"),
+			want:    filepath.Join(resolvedTmp, "valid.txt"),
 			wantErr: false,
 		},
 		{
@@ -165,11 +195,98 @@ func TestValidateOutputPath(t *testing.T) {
 			path:    "output.txt",
 			wantErr: false,
 		},
+		{
+			name:        "default policy denies system directories",
+			path:        "/etc/answers.txt",
+			wantErr:     true,
+			errContains: "is under denied root /etc (output.denied_roots)",
+		},
+		{
+			name:        "default policy denies root's home",
+			path:        "/root/answers.txt",
+			wantErr:     true,
+			errContains: "is under denied root /root (output.denied_roots)",
+		},
+		{
+			name:        "default policy denies /var",
+			path:        "/var/lib/answers.txt",
+			wantErr:     true,
+			errContains: "is under denied root /var (output.denied_roots)",
+		},
+		{
+			name:   "working directory inside a denied root",
+			path:   "output.txt",
+			policy: &config.OutputPolicy{DeniedRoots: []string{filepath.Dir(wd)}},
+		},
+		{
+			name:        "temporary directory itself denied",
+			path:        filepath.Join(tmpDir, "valid.txt"),
+			policy:      &config.OutputPolicy{DeniedRoots: []string{os.TempDir()}},
+			wantErr:     true,
+			errContains: "denied root " + os.TempDir(),
+		},
+		{
+			name:        "relative path escaping into a denied root",
+			path:        filepath.Join(tmpDir, "..", "..", "..", "..", "..", "..", "..", "..", "etc", "answers.txt"),
+			wantErr:     true,
+			errContains: "denied root /etc",
+		},
+		{
+			name:        "outside the allowed roots",
+			path:        filepath.Join(tmpDir, "valid.txt"),
+			policy:      &config.OutputPolicy{AllowedRoots: []string{"/srv/pxe", "/media"}},
+			wantErr:     true,
+			errContains: "is not under any allowed root (output.allowed_roots: /srv/pxe, /media)",
+		},
+		{
+			name:   "allowed root inside a denied root",
+			path:   filepath.Join(subDir, "file.txt"),
+			policy: &config.OutputPolicy{AllowedRoots: []string{subDir}, DeniedRoots: []string{tmpDir}},
+			want:   filepath.Join(resolvedSub, "file.txt"),
+		},
+		{
+			name:        "denied root outside the allowed subdirectory",
+			path:        filepath.Join(tmpDir, "file.txt"),
+			policy:      &config.OutputPolicy{AllowedRoots: []string{subDir}, DeniedRoots: []string{tmpDir}},
+			wantErr:     true,
+			errContains: "denied root " + tmpDir,
+		},
+		{
+			name:        "symlinked parent is resolved before checking",
+			path:        filepath.Join(linkDir, "file.txt"),
+			policy:      &config.OutputPolicy{DeniedRoots: []string{subDir}},
+			wantErr:     true,
+			errContains: "denied root " + subDir,
+		},
+		{
+			name:        "symlinked output without follow_symlinks",
+			path:        linkFile,
+			policy:      &config.OutputPolicy{},
+			wantErr:     true,
+			errContains: "is a symbolic link and output.follow_symlinks is disabled",
+		},
+		{
+			name:   "symlinked output with follow_symlinks",
+			path:   linkFile,
+			policy: &config.OutputPolicy{FollowSymlinks: true},
+			want:   filepath.Join(resolvedSub, "target.txt"),
+		},
+		{
+			name:        "followed symlink into a denied root",
+			path:        linkFile,
+			policy:      &config.OutputPolicy{FollowSymlinks: true, DeniedRoots: []string{subDir}},
+			wantErr:     true,
+			errContains: "denied root " + subDir,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateOutputPath(tt.path)
+			policy := config.DefaultOutputPolicy()
+			if tt.policy != nil {
+				policy = *tt.policy
+			}
+			got, err := validateOutputPath(tt.path, policy)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("validateOutputPath() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -179,6 +296,9 @@ func TestValidateOutputPath(t *testing.T) {
 					t.Errorf("validateOutputPath() error = %v, want error containing %q", err, tt.errContains)
 				}
 			}
+			if tt.want != "" && got != tt.want {
+				t.Errorf("validateOutputPath() = %q, want %q", got, tt.want)
+			}
 		})
 	}
 }
@@ -323,7 +443,7 @@ USEROPTS="-a -u -g {{ range $i, $g := .Groups }}{{if $i}},{{end}}{{$g}}{{end}} {
 			}
 
 			// Create generator and generate file
-			gen := New(tt.config, outputPath)
+			gen := New(tt.config, outputPath, WithForce(true))
 			err := gen.Generate()
 
 			// Check error conditions
@@ -501,3 +621,544 @@ func TestGenerator_OutputFilePermissions(t *testing.T) {
 		t.Errorf("Expected file permissions 0600, got %v", info.Mode().Perm())
 	}
 }
+
+func TestGenerator_Render(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		groups   []string
+		dns      []string
+		contains string
+	}{
+		{
+			name:     "with groups",
+			groups:   []string{"audio", "video"},
+			contains: `USEROPTS="-a -u -g audio,video testuser"`,
+		},
+		{
+			name:     "without groups",
+			contains: `USEROPTS="-a -u testuser"`,
+		},
+		{
+			name:     "with nameservers",
+			dns:      []string{"10.20.0.1", "2001:db8::53"},
+			contains: "\"\nDNSOPTS=\"10.20.0.1 2001:db8::53\"\nTIMEZONEOPTS=",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.New()
+			cfg.Username = "testuser"
+			cfg.Groups = tt.groups
+			cfg.DNS = tt.dns
+
+			var buf strings.Builder
+			if err := New(cfg, "").Render(&buf); err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if !strings.Contains(buf.String(), tt.contains) {
+				t.Errorf("Render() output missing %q\ngot:\n%s", tt.contains, buf.String())
+			}
+		})
+	}
+}
+
+func TestTemplate_Execute(t *testing.T) {
+	tmpl, err := Compile()
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	// a compiled template is shared by concurrent renders
+	outputs := make([]strings.Builder, 20)
+	var wg sync.WaitGroup
+	for i := range outputs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cfg := config.New()
+			cfg.Hostname = fmt.Sprintf("host-%d", i)
+			if err := tmpl.Execute(&outputs[i], cfg); err != nil {
+				t.Errorf("Execute() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range outputs {
+		if want := fmt.Sprintf(`HOSTNAMEOPTS="-n host-%d"`, i); !strings.Contains(outputs[i].String(), want) {
+			t.Errorf("render %d missing %q", i, want)
+		}
+	}
+
+	// Generate uses the compiled template instead of parsing its own
+	var stdout bytes.Buffer
+	err = New(config.New(), Stdout, WithCompiled(tmpl), WithTemplate("/nonexistent.tmpl"), WithStreams(&stdout, io.Discard)).Generate()
+	if err != nil || !strings.Contains(stdout.String(), "HOSTNAMEOPTS=") {
+		t.Errorf("Generate() with a compiled template error = %v", err)
+	}
+}
+
+func TestGenerator_GenerateStdout(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := config.New()
+
+	var stdout, stderr bytes.Buffer
+	if err := New(cfg, Stdout, WithStreams(&stdout, &stderr)).Generate(); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !strings.Contains(stdout.String(), `HOSTNAMEOPTS="-n alpinehost"`) {
+		t.Errorf("stdout = %q, want the answer file", stdout.String())
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("stderr = %q, want nothing", stderr.String())
+	}
+	if _, err := os.Stat(Stdout); !os.IsNotExist(err) {
+		t.Errorf("a file named %q was created", Stdout)
+	}
+
+	stdout.Reset()
+	output := filepath.Join(tmpDir, "answers.txt")
+	if err := New(cfg, output, WithStreams(&stdout, &stderr)).Generate(); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("stdout = %q, want nothing when writing a file", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "Successfully generated answers file: "+output) {
+		t.Errorf("stderr = %q, want the status message", stderr.String())
+	}
+}
+
+func TestGenerator_Overwrite(t *testing.T) {
+	tmpDir := t.TempDir()
+	output := filepath.Join(tmpDir, "answers.txt")
+	if err := os.WriteFile(output, []byte("OLD=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	now = func() time.Time { return time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		name        string
+		opts        []Option
+		errContains string
+		wantOld     bool
+		wantBackup  bool
+	}{
+		{
+			name:        "refuses to overwrite",
+			errContains: "already exists, use --force",
+			wantOld:     true,
+		},
+		{
+			name:       "force with backup",
+			opts:       []Option{WithForce(true), WithBackup(true)},
+			wantBackup: true,
+		},
+		{
+			name: "force",
+			opts: []Option{WithForce(true)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(output, []byte("OLD=1\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			backup := output + ".20240506-070809.bak"
+			_ = os.Remove(backup)
+
+			var stderr bytes.Buffer
+			opts := append([]Option{WithStreams(io.Discard, &stderr)}, tt.opts...)
+			err := New(config.New(), output, opts...).Generate()
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Fatalf("Generate() error = %v, want %q", err, tt.errContains)
+				}
+			} else if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			content, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(content) == "OLD=1\n"; got != tt.wantOld {
+				t.Errorf("output kept old content = %v, want %v", got, tt.wantOld)
+			}
+
+			old, err := os.ReadFile(backup)
+			if tt.wantBackup {
+				if err != nil || string(old) != "OLD=1\n" {
+					t.Errorf("backup = %q, %v, want the previous file", old, err)
+				}
+				if !strings.Contains(stderr.String(), backup) {
+					t.Errorf("stderr = %q, want the backup path", stderr.String())
+				}
+			} else if !os.IsNotExist(err) {
+				t.Errorf("unexpected backup file, err = %v", err)
+			}
+		})
+	}
+}
+
+func TestGenerator_AtomicWrite(t *testing.T) {
+	tmpDir := t.TempDir()
+	output := filepath.Join(tmpDir, "answers.txt")
+	if err := os.WriteFile(output, []byte("OLD=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := filepath.Join(tmpDir, "broken.tmpl")
+	if err := os.WriteFile(tmpl, []byte(`A="{{ .Hostname }}"{{ .Missing }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := New(config.New(), output, WithTemplate(tmpl), WithForce(true), WithStreams(io.Discard, io.Discard)).Generate()
+	if err == nil {
+		t.Fatal("Generate() error = nil, want a template error")
+	}
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "OLD=1\n" {
+		t.Errorf("output = %q, want it untouched after a template error", content)
+	}
+
+	if err := New(config.New(), output, WithForce(true), WithStreams(io.Discard, io.Discard)).Generate(); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Errorf("temporary file %s left behind", e.Name())
+		}
+	}
+	info, err := os.Stat(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("output mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestGenerator_Diff(t *testing.T) {
+	tmpDir := t.TempDir()
+	output := filepath.Join(tmpDir, "answers.txt")
+
+	var stdout bytes.Buffer
+	if err := New(config.New(), output, WithDiff(true), WithStreams(&stdout, io.Discard)).Generate(); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !strings.HasPrefix(stdout.String(), "--- "+os.DevNull+"\n+++ "+output+"\n") {
+		t.Errorf("diff against a missing file = %q, want it compared with %s", stdout.String(), os.DevNull)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Error("--diff wrote the output file")
+	}
+
+	if err := New(config.New(), output, WithStreams(io.Discard, io.Discard)).Generate(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.New()
+	cfg.Hostname = "newhost"
+
+	stdout.Reset()
+	if err := New(cfg, output, WithDiff(true), WithStreams(&stdout, io.Discard)).Generate(); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	for _, want := range []string{`-HOSTNAMEOPTS="-n alpinehost"`, `+HOSTNAMEOPTS="-n newhost"`} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("diff missing %q\ngot:\n%s", want, stdout.String())
+		}
+	}
+	if strings.Contains(stdout.String(), "PWUSER") || strings.Contains(stdout.String(), cfg.Password) {
+		t.Errorf("diff shows the unchanged password\ngot:\n%s", stdout.String())
+	}
+
+	cfg.Password = "n3w-s3cret"
+	stdout.Reset()
+	if err := New(cfg, output, WithDiff(true), WithStreams(&stdout, io.Discard)).Generate(); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	for _, want := range []string{`-PWUSER="(previous secret)"`, `+PWUSER="` + config.Mask + `"`} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("diff missing %q\ngot:\n%s", want, stdout.String())
+		}
+	}
+	if strings.Contains(stdout.String(), config.New().Password) || strings.Contains(stdout.String(), cfg.Password) {
+		t.Errorf("diff shows a password\ngot:\n%s", stdout.String())
+	}
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "newhost") {
+		t.Error("--diff overwrote the output file")
+	}
+}
+
+func TestGenerator_DryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	existing := filepath.Join(tmpDir, "existing.txt")
+	if err := os.WriteFile(existing, []byte("OLD=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		output      string
+		password    string
+		opts        []Option
+		errContains string
+	}{
+		{name: "new file", output: filepath.Join(tmpDir, "answers.txt"), password: "s3cret"},
+		{name: "stdout", output: Stdout, password: "s3cret"},
+		{name: "existing file with force", output: existing, password: "s3cret", opts: []Option{WithForce(true)}},
+		{
+			name:        "existing file without force",
+			output:      existing,
+			password:    "s3cret",
+			errContains: "already exists",
+		},
+		{
+			name:        "denied path",
+			output:      "/etc/answers.txt",
+			password:    "s3cret",
+			errContains: "denied root /etc",
+		},
+		{
+			name:        "value the real run rejects",
+			output:      filepath.Join(tmpDir, "answers.txt"),
+			password:    "bad\x00password",
+			errContains: "NUL byte",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.New()
+			cfg.Password = tt.password
+
+			var stdout, stderr bytes.Buffer
+			opts := append([]Option{WithDryRun(true), WithStreams(&stdout, &stderr)}, tt.opts...)
+			err := New(cfg, tt.output, opts...).Generate()
+
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("Generate() error = %v, want %q", err, tt.errContains)
+				}
+				if err != nil && strings.Contains(err.Error(), "password") {
+					t.Errorf("Generate() error = %v, want it to leave out the password", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			if !strings.Contains(stdout.String(), `PWUSER="`+config.Mask+`"`) {
+				t.Errorf("dry run output missing the masked password\ngot:\n%s", stdout.String())
+			}
+			if strings.Contains(stdout.String()+stderr.String(), tt.password) {
+				t.Error("dry run output contains the password")
+			}
+			if tt.output != Stdout {
+				content, err := os.ReadFile(tt.output)
+				if tt.output == existing {
+					if err != nil || string(content) != "OLD=1\n" {
+						t.Errorf("dry run modified %s", tt.output)
+					}
+				} else if !os.IsNotExist(err) {
+					t.Errorf("dry run wrote %s", tt.output)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerator_CreateDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+	output := filepath.Join(tmpDir, "out", "pi-kitchen", "answers.txt")
+
+	err := New(config.New(), output, WithStreams(io.Discard, io.Discard)).Generate()
+	if err == nil || !strings.Contains(err.Error(), "parent directory does not exist") {
+		t.Errorf("Generate() error = %v, want a missing parent directory", err)
+	}
+
+	var stdout bytes.Buffer
+	if err := New(config.New(), output, WithCreateDirs(true), WithDryRun(true), WithStreams(&stdout, io.Discard)).Generate(); err != nil {
+		t.Fatalf("Generate() dry run error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "out")); !os.IsNotExist(err) {
+		t.Error("dry run created the output directories")
+	}
+
+	if err := New(config.New(), output, WithCreateDirs(true), WithStreams(io.Discard, io.Discard)).Generate(); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("answer file was not written: %v", err)
+	}
+
+	policy := config.OutputPolicy{DeniedRoots: []string{filepath.Join(tmpDir, "denied")}}
+	err = New(config.New(), filepath.Join(tmpDir, "denied", "new", "answers.txt"), WithCreateDirs(true), WithOutputPolicy(policy), WithStreams(io.Discard, io.Discard)).Generate()
+	if err == nil || !strings.Contains(err.Error(), "denied root") {
+		t.Errorf("Generate() error = %v, want the policy applied to directories that do not exist yet", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "denied")); !os.IsNotExist(err) {
+		t.Error("directories were created under a denied root")
+	}
+}
+
+func TestGenerator_WriteFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	output := filepath.Join(tmpDir, "pi.apkovl.tar.gz")
+	data := []byte{0x1f, 0x8b, 0x00, 0xff}
+
+	if err := New(config.New(), output, WithStreams(io.Discard, io.Discard)).WriteFile(data); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if got, err := os.ReadFile(output); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("WriteFile() wrote %v, %v, want %v", got, err, data)
+	}
+
+	err := New(config.New(), output, WithStreams(io.Discard, io.Discard)).WriteFile([]byte("new"))
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("WriteFile() error = %v, want the existing file protected", err)
+	}
+
+	var stderr bytes.Buffer
+	if err := New(config.New(), output, WithDryRun(true), WithForce(true), WithStreams(io.Discard, &stderr)).WriteFile([]byte("new")); err != nil {
+		t.Fatalf("WriteFile() dry run error = %v", err)
+	}
+	if got, _ := os.ReadFile(output); !bytes.Equal(got, data) || !strings.Contains(stderr.String(), "Dry run") {
+		t.Errorf("dry run wrote the file or did not say so: %q", stderr.String())
+	}
+
+	now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+	if err := New(config.New(), output, WithForce(true), WithBackup(true), WithStreams(io.Discard, io.Discard)).WriteFile([]byte("new")); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if got, _ := os.ReadFile(output + ".20240501-120000.bak"); !bytes.Equal(got, data) {
+		t.Errorf("backup = %v, want %v", got, data)
+	}
+
+	var stdout bytes.Buffer
+	if err := New(config.New(), Stdout, WithStreams(&stdout, io.Discard)).WriteFile(data); err != nil || !bytes.Equal(stdout.Bytes(), data) {
+		t.Errorf("WriteFile() to stdout = %v, %v", stdout.Bytes(), err)
+	}
+
+	err = New(config.New(), "/etc/pi.apkovl.tar.gz", WithStreams(io.Discard, io.Discard)).WriteFile(data)
+	if err == nil || !strings.Contains(err.Error(), "denied root /etc") {
+		t.Errorf("WriteFile() error = %v, want the output policy applied", err)
+	}
+}
+
+func TestGenerator_WriteWith(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "seed.img")
+	sparse := func(f *os.File) error {
+		if err := f.Truncate(1 << 20); err != nil {
+			return err
+		}
+		_, err := f.WriteAt([]byte("end"), 1<<20-3)
+		return err
+	}
+
+	if err := New(config.New(), output, WithStreams(io.Discard, io.Discard)).WriteWith(sparse); err != nil {
+		t.Fatalf("WriteWith() error = %v", err)
+	}
+	if got, err := os.ReadFile(output); err != nil || len(got) != 1<<20 || string(got[len(got)-3:]) != "end" {
+		t.Fatalf("WriteWith() wrote %d bytes, %v", len(got), err)
+	}
+
+	err := New(config.New(), output, WithStreams(io.Discard, io.Discard)).WriteWith(sparse)
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("WriteWith() error = %v, want the existing file protected", err)
+	}
+
+	// a failed write leaves the existing file alone
+	failed := func(f *os.File) error { return errors.New("image too small") }
+	err = New(config.New(), output, WithForce(true), WithStreams(io.Discard, io.Discard)).WriteWith(failed)
+	if err == nil || err.Error() != "image too small" {
+		t.Errorf("WriteWith() error = %v, want the error of write", err)
+	}
+	if info, err := os.Stat(output); err != nil || info.Size() != 1<<20 {
+		t.Errorf("output after a failed write = %v, %v", info, err)
+	}
+
+	var stdout bytes.Buffer
+	if err := New(config.New(), Stdout, WithStreams(&stdout, io.Discard)).WriteWith(sparse); err != nil || stdout.Len() != 1<<20 {
+		t.Errorf("WriteWith() to stdout wrote %d bytes, %v", stdout.Len(), err)
+	}
+}
+
+func TestGenerator_TemplateSelection(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	envDir := filepath.Join(tmpDir, "env")
+	if err := os.Mkdir(envDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(envDir, "answers.tmpl"), []byte("FROM=env {{ .Hostname }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	flagTemplate := filepath.Join(tmpDir, "custom.tmpl")
+	if err := os.WriteFile(flagTemplate, []byte("FROM=flag {{ .Hostname }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		templateDir string
+		opts        []Option
+		want        string
+	}{
+		{
+			name: "built-in template",
+			want: `HOSTNAMEOPTS="-n test-host"`,
+		},
+		{
+			name:        "TEMPLATE_DIR overrides built-in template",
+			templateDir: envDir,
+			want:        "FROM=env test-host",
+		},
+		{
+			name:        "WithTemplate overrides TEMPLATE_DIR",
+			templateDir: envDir,
+			opts:        []Option{WithTemplate(flagTemplate)},
+			want:        "FROM=flag test-host",
+		},
+		{
+			name: "empty WithTemplate keeps built-in template",
+			opts: []Option{WithTemplate("")},
+			want: `HOSTNAMEOPTS="-n test-host"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEMPLATE_DIR", tt.templateDir)
+
+			cfg := config.New()
+			cfg.Hostname = "test-host"
+
+			var buf strings.Builder
+			if err := New(cfg, "", tt.opts...).Render(&buf); err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if !strings.Contains(buf.String(), tt.want) {
+				t.Errorf("Render() output missing %q\ngot:\n%s", tt.want, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package generator
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+// Severity tells whether a lint issue breaks rendering or is only suspicious
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a problem found by Lint. Location is "template:line:col" for
+// issues tied to a node and the template name otherwise.
+type Issue struct {
+	Location string
+	Severity Severity
+	Message  string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Location, i.Severity, i.Message)
+}
+
+// safeFuncs are the functions whose output can be written into an answer
+// file without further quoting
+var safeFuncs = map[string]bool{
+	"shellEscape": true,
+	"quote":       true,
+}
+
+// Lint statically checks the template the generator would render. Every
+// field reference is resolved against config.Config, following the dot
+// through range, with and template calls, and reported if it does not exist.
+// Config fields the template never uses and interpolations that are not
+// passed through shellEscape or quote are reported as warnings.
+func (g *Generator) Lint() ([]Issue, error) {
+	t, err := g.loadTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	root := reflect.TypeOf(config.Config{})
+	l := &linter{
+		tmpl:    t,
+		used:    make(map[string]bool),
+		visited: make(map[string]bool),
+	}
+	l.walkTemplate(t, typeRef{typ: root, field: true})
+
+	for _, path := range fieldPaths(root, "") {
+		if !l.isUsed(path) {
+			l.issues = append(l.issues, Issue{
+				Location: t.Name(),
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("config field %s is never used", path),
+			})
+		}
+	}
+	return l.issues, nil
+}
+
+// typeRef is the static type of a template value. typ is nil when the type
+// cannot be known, e.g. for the result of an interface{} function. path is
+// the dotted config field path the value was read from, if any.
+type typeRef struct {
+	typ   reflect.Type
+	path  string
+	field bool
+}
+
+type scope struct {
+	dot  typeRef
+	vars map[string]typeRef
+}
+
+func (s scope) with(dot typeRef) scope {
+	vars := make(map[string]typeRef, len(s.vars))
+	for k, v := range s.vars {
+		vars[k] = v
+	}
+	return scope{dot: dot, vars: vars}
+}
+
+type linter struct {
+	tmpl    *template.Template
+	tree    *parse.Tree
+	issues  []Issue
+	used    map[string]bool
+	visited map[string]bool
+}
+
+func (l *linter) report(node parse.Node, severity Severity, format string, args ...interface{}) {
+	location, _ := l.tree.ErrorContext(node)
+	l.issues = append(l.issues, Issue{
+		Location: location,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// walkTemplate checks a named template with dot set to data. Each template
+// is only checked once per data type.
+func (l *linter) walkTemplate(t *template.Template, data typeRef) {
+	key := t.Name() + "\x00" + typeName(data.typ)
+	if l.visited[key] || t.Tree == nil {
+		return
+	}
+	l.visited[key] = true
+
+	saved := l.tree
+	l.tree = t.Tree
+	l.walk(t.Tree.Root, scope{dot: data, vars: map[string]typeRef{"$": data}})
+	l.tree = saved
+}
+
+func (l *linter) walk(node parse.Node, s scope) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			l.walk(child, s)
+		}
+	case *parse.ActionNode:
+		l.pipe(n.Pipe, s)
+		if len(n.Pipe.Decl) == 0 && !l.safe(n.Pipe) {
+			l.report(n, SeverityWarning, "unquoted interpolation %s, pipe it through shellEscape or quote", n)
+		}
+	case *parse.IfNode:
+		inner := s.with(s.dot)
+		l.pipe(n.Pipe, inner)
+		l.walk(n.List, inner)
+		l.walk(n.ElseList, s.with(s.dot))
+	case *parse.WithNode:
+		inner := s.with(s.dot)
+		inner.dot = l.pipe(n.Pipe, inner)
+		l.walk(n.List, inner)
+		l.walk(n.ElseList, s.with(s.dot))
+	case *parse.RangeNode:
+		inner := s.with(s.dot)
+		decl := n.Pipe.Decl
+		n.Pipe.Decl = nil
+		ranged := l.pipe(n.Pipe, inner)
+		n.Pipe.Decl = decl
+
+		key, elem := rangeTypes(ranged)
+		inner.dot = elem
+		switch len(decl) {
+		case 1:
+			inner.vars[decl[0].Ident[0]] = elem
+		case 2:
+			inner.vars[decl[0].Ident[0]] = key
+			inner.vars[decl[1].Ident[0]] = elem
+		}
+		l.walk(n.List, inner)
+		l.walk(n.ElseList, s.with(s.dot))
+	case *parse.TemplateNode:
+		data := typeRef{}
+		if n.Pipe != nil {
+			data = l.pipe(n.Pipe, s.with(s.dot))
+		}
+		called := l.tmpl.Lookup(n.Name)
+		if called == nil {
+			l.report(n, SeverityError, "template %q is not defined", n.Name)
+			return
+		}
+		l.walkTemplate(called, data)
+	}
+}
+
+// pipe resolves every command of a pipeline, declares its variables in s and
+// returns the type of its result
+func (l *linter) pipe(p *parse.PipeNode, s scope) typeRef {
+	if p == nil {
+		return typeRef{}
+	}
+	var result typeRef
+	for _, cmd := range p.Cmds {
+		result = l.command(cmd, s)
+	}
+	for _, v := range p.Decl {
+		s.vars[v.Ident[0]] = result
+	}
+	return result
+}
+
+func (l *linter) command(cmd *parse.CommandNode, s scope) typeRef {
+	for _, arg := range cmd.Args[1:] {
+		l.arg(arg, s)
+	}
+	if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok {
+		fn, ok := l.funcType(ident.Ident)
+		if !ok || fn.NumOut() == 0 {
+			return typeRef{}
+		}
+		return typeRef{typ: fn.Out(0)}
+	}
+	return l.arg(cmd.Args[0], s)
+}
+
+func (l *linter) arg(node parse.Node, s scope) typeRef {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return s.dot
+	case *parse.FieldNode:
+		return l.fields(n, s.dot, n.Ident)
+	case *parse.VariableNode:
+		v, ok := s.vars[n.Ident[0]]
+		if !ok {
+			return typeRef{}
+		}
+		return l.fields(n, v, n.Ident[1:])
+	case *parse.ChainNode:
+		return l.fields(n, l.arg(n.Node, s), n.Field)
+	case *parse.PipeNode:
+		return l.pipe(n, s.with(s.dot))
+	case *parse.StringNode:
+		return typeRef{typ: reflect.TypeOf("")}
+	case *parse.BoolNode:
+		return typeRef{typ: reflect.TypeOf(true)}
+	}
+	return typeRef{}
+}
+
+// fields resolves a chain of field names starting at ref, reporting the first
+// one that does not exist
+func (l *linter) fields(node parse.Node, ref typeRef, names []string) typeRef {
+	for _, name := range names {
+		t := ref.typ
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t == nil || t.Kind() == reflect.Interface {
+			return typeRef{}
+		}
+
+		path := ""
+		if ref.field {
+			path = strings.TrimPrefix(ref.path+"."+name, ".")
+		}
+
+		switch {
+		case t.Kind() == reflect.Struct:
+			if f, ok := t.FieldByName(name); ok && f.IsExported() {
+				if ref.field {
+					l.used[path] = true
+				}
+				ref = typeRef{typ: f.Type, path: path, field: ref.field}
+				continue
+			}
+			if m, ok := reflect.PointerTo(t).MethodByName(name); ok {
+				ref = typeRef{}
+				if m.Type.NumOut() > 0 {
+					ref.typ = m.Type.Out(0)
+				}
+				continue
+			}
+			l.report(node, SeverityError, "unknown field %s in %s", name, typeName(t))
+			return typeRef{}
+		case t.Kind() == reflect.Map:
+			ref = typeRef{typ: t.Elem()}
+		default:
+			l.report(node, SeverityError, "cannot read field %s of %s", name, typeName(t))
+			return typeRef{}
+		}
+	}
+	return ref
+}
+
+func (l *linter) funcType(name string) (reflect.Type, bool) {
+	fn, ok := funcs[name]
+	if !ok {
+		return nil, false
+	}
+	return reflect.TypeOf(fn), true
+}
+
+// safe reports whether the output of an action is quoted for the shell or
+// is a literal constant
+func (l *linter) safe(p *parse.PipeNode) bool {
+	last := p.Cmds[len(p.Cmds)-1]
+	if ident, ok := last.Args[0].(*parse.IdentifierNode); ok {
+		return safeFuncs[ident.Ident]
+	}
+	if len(p.Cmds) == 1 && len(last.Args) == 1 {
+		switch last.Args[0].(type) {
+		case *parse.StringNode, *parse.NumberNode, *parse.BoolNode:
+			return true
+		}
+	}
+	return false
+}
+
+func (l *linter) isUsed(path string) bool {
+	for p := path; ; {
+		if l.used[p] {
+			return true
+		}
+		i := strings.LastIndex(p, ".")
+		if i < 0 {
+			return false
+		}
+		p = p[:i]
+	}
+}
+
+// rangeTypes returns the key and element types produced by ranging over ref
+func rangeTypes(ref typeRef) (typeRef, typeRef) {
+	t := ref.typ
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return typeRef{}, typeRef{}
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return typeRef{typ: reflect.TypeOf(0)}, typeRef{typ: t.Elem(), path: ref.path, field: ref.field}
+	case reflect.Map:
+		return typeRef{typ: t.Key()}, typeRef{typ: t.Elem()}
+	case reflect.Int:
+		return typeRef{typ: t}, typeRef{typ: t}
+	}
+	return typeRef{}, typeRef{}
+}
+
+// fieldPaths lists the dotted paths of every leaf field of a struct type,
+// descending into nested structs and slices of structs. Fields tagged
+// template:"-" are not meant for templates and are skipped.
+func fieldPaths(t reflect.Type, prefix string) []string {
+	var paths []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Tag.Get("template") == "-" {
+			continue
+		}
+		path := prefix + f.Name
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr || ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			paths = append(paths, fieldPaths(ft, path+".")...)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return "unknown"
+	}
+	return t.String()
+}
@@ -0,0 +1,171 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+// lintTemplate lints tmpl with the given partials and returns the issues
+// other than unused config fields
+func lintTemplate(t *testing.T, tmpl string, partials map[string]string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "answers.tmpl")
+	if err := os.WriteFile(path, []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	partialsDir := filepath.Join(dir, "partials")
+	if err := os.Mkdir(partialsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range partials {
+		if err := os.WriteFile(filepath.Join(partialsDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	issues, err := New(config.New(), "", WithTemplate(path), WithPartials(partialsDir)).Lint()
+	if err != nil {
+		t.Fatalf("Lint() error = %v", err)
+	}
+	var got []string
+	for _, issue := range issues {
+		if !strings.Contains(issue.Message, "is never used") {
+			got = append(got, issue.String())
+		}
+	}
+	return got
+}
+
+func TestLint_BuiltinTemplate(t *testing.T) {
+	issues, err := New(config.New(), "").Lint()
+	if err != nil {
+		t.Fatalf("Lint() error = %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("Lint() of the built-in template = %v, want no issues", issues)
+	}
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		tmpl     string
+		partials map[string]string
+		want     []string
+	}{
+		{
+			name: "escaped fields",
+			tmpl: `A="{{ shellEscape .Hostname }}"` + "\n" + `B={{ .Username | quote }}`,
+		},
+		{
+			name: "unknown field",
+			tmpl: "A=x\nB=\"{{ shellEscape .Hostnme }}\"",
+			want: []string{"answers.tmpl:2:18: error: unknown field Hostnme in config.Config"},
+		},
+		{
+			name: "field of a string",
+			tmpl: `{{ shellEscape .Hostname.Name }}`,
+			want: []string{"answers.tmpl:1:24: error: cannot read field Name of string"},
+		},
+		{
+			name: "unquoted interpolation",
+			tmpl: `A="{{ .Hostname }}"`,
+			want: []string{"answers.tmpl:1:6: warning: unquoted interpolation {{.Hostname}}, pipe it through shellEscape or quote"},
+		},
+		{
+			name: "function output not escaped",
+			tmpl: `{{ join "," .Groups }}`,
+			want: []string{`answers.tmpl:1:3: warning: unquoted interpolation {{join "," .Groups}}, pipe it through shellEscape or quote`},
+		},
+		{
+			name: "literals and declarations",
+			tmpl: `{{ "x" }}{{ 1 }}{{ $h := .Hostname }}{{ quote $h }}`,
+		},
+		{
+			name: "ranged elements",
+			tmpl: `{{ range $i, $g := .Groups }}{{ if $i }},{{ end }}{{ shellEscape $g }}{{ shellEscape $.Hostname }}{{ end }}`,
+		},
+		{
+			name: "ranged element has no fields",
+			tmpl: `{{ range .Groups }}{{ shellEscape .Name }}{{ end }}`,
+			want: []string{"answers.tmpl:1:34: error: cannot read field Name of string"},
+		},
+		{
+			name: "root variable inside range",
+			tmpl: `{{ range .Groups }}{{ shellEscape $.Hostnme }}{{ end }}`,
+			want: []string{"answers.tmpl:1:35: error: unknown field Hostnme in config.Config"},
+		},
+		{
+			name: "with block",
+			tmpl: `{{ with .SSHKey }}{{ shellEscape . }}{{ else }}{{ shellEscape .Keymapp }}{{ end }}`,
+			want: []string{"answers.tmpl:1:62: error: unknown field Keymapp in config.Config"},
+		},
+		{
+			name:     "partial",
+			tmpl:     `{{ template "extra" . }}`,
+			partials: map[string]string{"extra.tmpl": "{{ define \"extra\" }}\n{{ shellEscape .Hostnme }}{{ end }}"},
+			want:     []string{"extra.tmpl:2:15: error: unknown field Hostnme in config.Config"},
+		},
+		{
+			name:     "partial given a field",
+			tmpl:     `{{ template "extra" .Groups }}`,
+			partials: map[string]string{"extra.tmpl": `{{ define "extra" }}{{ range . }}{{ quote . }}{{ end }}{{ end }}`},
+		},
+		{
+			name: "method call",
+			tmpl: `{{ if .Validate }}invalid{{ end }}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lintTemplate(t, tt.tmpl, tt.partials)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLint_UnusedFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "answers.tmpl")
+	tmpl := `{{ shellEscape .Hostname }}{{ range .Groups }}{{ quote . }}{{ end }}{{ toJSON .Keymap }}`
+	if err := os.WriteFile(path, []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := New(config.New(), "", WithTemplate(path)).Lint()
+	if err != nil {
+		t.Fatalf("Lint() error = %v", err)
+	}
+
+	var unused []string
+	for _, issue := range issues {
+		if strings.HasSuffix(issue.Message, "is never used") {
+			if issue.Severity != SeverityWarning || issue.Location != "answers.tmpl" {
+				t.Errorf("unused field issue = %+v, want a warning for answers.tmpl", issue)
+			}
+			unused = append(unused, strings.Fields(issue.Message)[2])
+		}
+	}
+	want := []string{"Address", "DNS", "DiskDevice", "Gateway", "NetworkIface", "Password", "SSHKey", "Timezone", "Username"}
+	if !reflect.DeepEqual(unused, want) {
+		t.Errorf("unused fields = %v, want %v", unused, want)
+	}
+}
+
+func TestLint_ParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "answers.tmpl")
+	if err := os.WriteFile(path, []byte(`{{ .Hostname`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(config.New(), "", WithTemplate(path)).Lint(); err == nil {
+		t.Error("Lint() error = nil, want a parse error")
+	}
+}
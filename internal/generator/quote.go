@@ -0,0 +1,40 @@
+package generator
+
+import (
+	"errors"
+	"strings"
+)
+
+// errNUL is returned for values with a NUL byte. It leaves out the value,
+// which may be a password.
+var errNUL = errors.New("value contains a NUL byte, which cannot be represented in a shell variable")
+
+// shellEscaper backslash-escapes the characters that keep a special meaning
+// inside double quotes in POSIX sh
+var shellEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"$", `\$`,
+	"`", "\\`",
+)
+
+// shellEscape escapes s for use inside a double-quoted value of an answer
+// file, which setup-alpine sources with /bin/sh. The shell sees exactly s
+// after removing the quoting. NUL bytes cannot be stored in a shell variable
+// and are rejected.
+func shellEscape(s string) (string, error) {
+	if strings.ContainsRune(s, 0) {
+		return "", errNUL
+	}
+	return shellEscaper.Replace(s), nil
+}
+
+// Quote wraps s in single quotes for use as a complete shell word. Nothing
+// can be escaped within single quotes, so each single quote in s closes the
+// quoted string, adds an escaped quote and reopens it. NUL bytes are rejected.
+func Quote(s string) (string, error) {
+	if strings.ContainsRune(s, 0) {
+		return "", errNUL
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'", nil
+}
@@ -0,0 +1,109 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/verify"
+)
+
+func TestShellEscape(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain value", input: "changeme", want: "changeme"},
+		{name: "double quote", input: `pa"ss`, want: `pa\"ss`},
+		{name: "dollar", input: "$HOME", want: `\$HOME`},
+		{name: "backtick", input: "`id`", want: "\\`id\\`"},
+		{name: "backslash", input: `a\b`, want: `a\\b`},
+		{name: "backslash before newline", input: "a\\\nb", want: "a\\\\\nb"},
+		{name: "single quote is literal", input: "it's", want: "it's"},
+		{name: "NUL byte", input: "a\x00b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := shellEscape(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("shellEscape() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && strings.Contains(err.Error(), tt.input) {
+				t.Errorf("shellEscape() error = %v, want it to leave out the value", err)
+			}
+			if got != tt.want {
+				t.Errorf("shellEscape() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// FuzzGenerate_ShellQuoting sources the rendered answer file in /bin/sh and
+// checks that the shell sees exactly the configured values
+func FuzzGenerate_ShellQuoting(f *testing.F) {
+	if _, err := os.Stat(verify.Shell); err != nil {
+		f.Skipf("%s is not available", verify.Shell)
+	}
+
+	seeds := []string{
+		"changeme",
+		`pa"ss`,
+		"$(touch /tmp/pwned)",
+		"`id`",
+		`trailing\`,
+		"line\\\ncontinuation",
+		"$HOME ${PATH} $1 $$",
+		"it's 'quoted'",
+		"multi\nline\n",
+		"tab\tand\rcarriage",
+		"nul\x00byte",
+	}
+	for _, s := range seeds {
+		f.Add(s, "alpinehost")
+	}
+
+	f.Fuzz(func(t *testing.T, password, hostname string) {
+		cfg := config.New()
+		cfg.Password = password
+		cfg.Hostname = hostname
+
+		var buf bytes.Buffer
+		err := New(cfg, "").Render(&buf)
+		if strings.TrimSpace(hostname) == "" {
+			// without a hostname the answer file is invalid, whatever the quoting
+			return
+		}
+		if strings.ContainsRune(password+hostname, 0) {
+			if err == nil {
+				t.Fatal("Render() accepted a value containing a NUL byte")
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+
+		path := filepath.Join(t.TempDir(), "answers")
+		if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := verify.Source(context.Background(), path)
+		if err != nil {
+			t.Fatalf("Source() error = %v\n%s", err, buf.Bytes())
+		}
+		if mismatches := verify.Compare(verify.Expected(cfg), got); len(mismatches) > 0 {
+			t.Errorf("shell values differ from the configuration: %+v", mismatches)
+		}
+		if got["PWUSER"] != password {
+			t.Errorf("shell sees PWUSER = %q, want %q", got["PWUSER"], password)
+		}
+	})
+}
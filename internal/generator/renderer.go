@@ -0,0 +1,195 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+// Renderer renders a configuration in one output format. Renderers used
+// with Batch are shared between goroutines and must be safe for concurrent
+// use.
+type Renderer interface {
+	Render(w io.Writer, cfg *config.Config) error
+}
+
+// Format is an output format that can be selected by name
+type Format struct {
+	// Name selects the format, for example with --format
+	Name string
+	// File is the name of the format's file in a bundle directory
+	File string
+	// Description is a one line summary shown in help texts
+	Description string
+	// New returns the renderer for a run. It gets the options of the run,
+	// so template based formats can honour WithTemplate and WithPartials.
+	New func(opts ...Option) (Renderer, error)
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = make(map[string]Format)
+)
+
+func init() {
+	Register(Format{
+		Name:        "answers",
+		File:        "answers.txt",
+		Description: "setup-alpine answer file",
+		New:         func(opts ...Option) (Renderer, error) { return Compile(opts...) },
+	})
+	Register(Format{
+		Name:        "json",
+		File:        "config.json",
+		Description: "JSON object of the settings",
+		New:         func(...Option) (Renderer, error) { return jsonRenderer{}, nil },
+	})
+	Register(Format{
+		Name:        "env",
+		File:        "config.env",
+		Description: "shell script exporting ALPINE_* variables",
+		New:         func(...Option) (Renderer, error) { return envRenderer{}, nil },
+	})
+}
+
+// Register makes a format available by name. It is meant to be called from
+// the init function of the package providing the format, and panics if the
+// format is incomplete or its name is already taken.
+func Register(f Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if f.Name == "" || f.File == "" || f.New == nil {
+		panic("generator: Register of an incomplete format")
+	}
+	if _, dup := formats[f.Name]; dup {
+		panic("generator: Register called twice for format " + f.Name)
+	}
+	formats[f.Name] = f
+}
+
+// LookupFormat returns the format registered as name
+func LookupFormat(name string) (Format, error) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	f, ok := formats[name]
+	if !ok {
+		return Format{}, fmt.Errorf("unknown format %q, available formats: %s", name, strings.Join(formatNames(), ", "))
+	}
+	return f, nil
+}
+
+// Formats returns every registered format sorted by name
+func Formats() []Format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	var list []Format
+	for _, name := range formatNames() {
+		list = append(list, formats[name])
+	}
+	return list
+}
+
+// formatNames returns the sorted names of the registered formats. The caller
+// holds formatsMu.
+func formatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithRenderer makes the generator render its output with r instead of the
+// answer file template, which makes WithTemplate and WithPartials irrelevant
+func WithRenderer(r Renderer) Option {
+	return func(g *Generator) {
+		g.renderer = r
+	}
+}
+
+// setting is a config field that is part of the rendered output
+type setting struct {
+	name  string
+	value reflect.Value
+}
+
+// settings returns the fields of cfg that describe the host, named by their
+// yaml keys. Fields tagged template:"-" are left out like in the answer file.
+func settings(cfg *config.Config) []setting {
+	v := reflect.ValueOf(cfg).Elem()
+	var list []setting
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Tag.Get("template") == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		list = append(list, setting{name: name, value: v.Field(i)})
+	}
+	return list
+}
+
+// jsonRenderer renders the settings as an indented JSON object with the
+// keys of the config file, in the order of the config file
+type jsonRenderer struct{}
+
+func (jsonRenderer) Render(w io.Writer, cfg *config.Config) error {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, s := range settings(cfg) {
+		value := s.value.Interface()
+		if s.value.Kind() == reflect.Slice && s.value.IsNil() {
+			value = []string{}
+		}
+		key, _ := json.Marshal(s.name)
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", s.name, err)
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(w)
+	return err
+}
+
+// envRenderer renders the settings as a shell script of export statements
+// that can be sourced. Variables are named ALPINE_ followed by the upper
+// case config file key, and lists are separated by spaces.
+type envRenderer struct{}
+
+func (envRenderer) Render(w io.Writer, cfg *config.Config) error {
+	var buf bytes.Buffer
+	for _, s := range settings(cfg) {
+		value := fmt.Sprint(s.value.Interface())
+		if s.value.Kind() == reflect.Slice {
+			value = strings.Join(s.value.Interface().([]string), " ")
+		}
+		quoted, err := Quote(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", s.name, err)
+		}
+		fmt.Fprintf(&buf, "export ALPINE_%s=%s\n", strings.ToUpper(s.name), quoted)
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
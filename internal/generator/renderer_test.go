@@ -0,0 +1,202 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+func TestFormats(t *testing.T) {
+	var names []string
+	for _, f := range Formats() {
+		names = append(names, f.Name+"="+f.File)
+	}
+	if got := strings.Join(names, " "); !strings.Contains(got, "answers=answers.txt env=config.env json=config.json") {
+		t.Errorf("Formats() = %s", got)
+	}
+
+	if _, err := LookupFormat("yaml"); err == nil || !strings.Contains(err.Error(), `unknown format "yaml", available formats: answers, env, json`) {
+		t.Errorf("LookupFormat() error = %v", err)
+	}
+
+	f, err := LookupFormat("answers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	tmplPath := filepath.Join(dir, "custom.tmpl")
+	if err := os.WriteFile(tmplPath, []byte("HOST={{ .Hostname }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.New(WithTemplate(tmplPath))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if err := r.Render(&buf, config.New()); err != nil || buf.String() != "HOST=alpinehost\n" {
+		t.Errorf("answers format ignores WithTemplate: %q, %v", buf.String(), err)
+	}
+}
+
+// upperRenderer is a third party format used to test the registry
+type upperRenderer struct{}
+
+func (upperRenderer) Render(w io.Writer, cfg *config.Config) error {
+	_, err := fmt.Fprintln(w, strings.ToUpper(cfg.Hostname))
+	return err
+}
+
+func TestRegister(t *testing.T) {
+	Register(Format{
+		Name: "test-upper",
+		File: "upper.txt",
+		New:  func(...Option) (Renderer, error) { return upperRenderer{}, nil },
+	})
+	defer func() {
+		formatsMu.Lock()
+		delete(formats, "test-upper")
+		formatsMu.Unlock()
+	}()
+
+	f, err := LookupFormat("test-upper")
+	if err != nil {
+		t.Fatalf("LookupFormat() error = %v", err)
+	}
+	r, _ := f.New()
+	output := filepath.Join(t.TempDir(), f.File)
+	var stderr bytes.Buffer
+	if err := New(config.New(), output, WithRenderer(r), WithStreams(io.Discard, &stderr)).Generate(); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if data, _ := os.ReadFile(output); string(data) != "ALPINEHOST\n" {
+		t.Errorf("output = %q", data)
+	}
+	if !strings.Contains(stderr.String(), "Successfully wrote "+output) {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+
+	for _, bad := range []Format{
+		{Name: "test-upper", File: "x", New: f.New},
+		{Name: "test-incomplete"},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(%q) did not panic", bad.Name)
+				}
+			}()
+			Register(bad)
+		}()
+	}
+}
+
+func TestJSONRenderer(t *testing.T) {
+	cfg := config.New()
+	cfg.Address = "10.20.0.50/24"
+	cfg.Groups = nil
+
+	var buf bytes.Buffer
+	if err := (jsonRenderer{}).Render(&buf, cfg); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	want := `{
+  "hostname": "alpinehost",
+  "username": "alpine",
+  "password": "changeme",
+  "timezone": "UTC",
+  "keymap": "us",
+  "interface": "eth0",
+  "disk": "/dev/mmcblk0",
+  "groups": [],
+  "ssh_key": "",
+  "address": "10.20.0.50/24",
+  "gateway": "",
+  "dns": []
+}
+`
+	if buf.String() != want {
+		t.Errorf("Render() =\n%s\nwant\n%s", buf.String(), want)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Errorf("output is not JSON: %v", err)
+	}
+}
+
+func TestEnvRenderer(t *testing.T) {
+	cfg := config.New()
+	cfg.Password = `it's a "$ecret"`
+
+	var buf bytes.Buffer
+	if err := (envRenderer{}).Render(&buf, cfg); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	for _, line := range []string{
+		"export ALPINE_HOSTNAME='alpinehost'\n",
+		"export ALPINE_INTERFACE='eth0'\n",
+		"export ALPINE_GROUPS='audio video netdev'\n",
+		"export ALPINE_SSH_KEY=''\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Render() missing %q\n%s", line, buf.String())
+		}
+	}
+
+	// the shell sees exactly the configured values
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	script := buf.String() + `printf '%s\n' "$ALPINE_PASSWORD" "$ALPINE_DISK"`
+	out, err := exec.Command(sh, "-c", script).Output()
+	if err != nil {
+		t.Fatalf("sourcing the env file failed: %v", err)
+	}
+	if want := cfg.Password + "\n/dev/mmcblk0\n"; string(out) != want {
+		t.Errorf("sourced values = %q, want %q", out, want)
+	}
+
+	cfg.Hostname = "nul\x00"
+	err = (envRenderer{}).Render(io.Discard, cfg)
+	if err == nil || !strings.Contains(err.Error(), "hostname") || strings.Contains(err.Error(), "nul") {
+		t.Errorf("Render() error = %v, want the field named without its value", err)
+	}
+}
+
+func TestGenerator_WithRenderer(t *testing.T) {
+	f, err := LookupFormat("json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := f.New()
+
+	var stdout bytes.Buffer
+	if err := New(config.New(), Stdout, WithRenderer(r), WithDryRun(true), WithStreams(&stdout, io.Discard)).Generate(); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if strings.Contains(stdout.String(), "changeme") || !strings.Contains(stdout.String(), `"hostname": "alpinehost"`) {
+		t.Errorf("dry run output does not mask secrets:\n%s", stdout.String())
+	}
+
+	dir := t.TempDir()
+	jobs := hostJobs(dir, 3)
+	results, err := Batch(context.Background(), jobs, 2, WithRenderer(r), WithStreams(io.Discard, io.Discard), WithTemplate(filepath.Join(dir, "missing.tmpl")))
+	if err != nil {
+		t.Fatalf("Batch() error = %v, the template must not be compiled for a renderer", err)
+	}
+	for _, res := range results {
+		data, err := os.ReadFile(res.Job.Output)
+		if res.Err != nil || err != nil || !strings.Contains(string(data), `"hostname": "`+res.Job.Config.Hostname+`"`) {
+			t.Errorf("job %s: %v, %v\n%s", res.Job.Output, res.Err, err, data)
+		}
+	}
+}
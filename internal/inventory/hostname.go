@@ -0,0 +1,55 @@
+package inventory
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// hostVars are the variables every hostname pattern can use besides the
+// inventory vars
+var hostVars = []string{"Index", "Count", "Seq"}
+
+// hostnameData returns the data a hostname pattern is evaluated with. Index
+// counts the hosts of one entry from 1 to Count, Seq counts every host of the
+// inventory from 1.
+func hostnameData(vars map[string]any, index, count, seq int) map[string]any {
+	data := make(map[string]any, len(vars)+len(hostVars))
+	for k, v := range vars {
+		data[k] = v
+	}
+	data["Index"] = index
+	data["Count"] = count
+	data["Seq"] = seq
+	return data
+}
+
+// expandHostname evaluates a hostname pattern. Hostnames without template
+// actions are returned unchanged.
+func expandHostname(pattern string, data map[string]any) (string, error) {
+	if !strings.Contains(pattern, "{{") {
+		return pattern, nil
+	}
+	funcs := template.FuncMap{
+		"seq": func(width int) string { return pad(width, data["Seq"]) },
+		"pad": pad,
+	}
+	t, err := template.New("hostname").Option("missingkey=error").Funcs(funcs).Parse(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid hostname pattern: %w", err)
+	}
+	var buf strings.Builder
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("invalid hostname pattern: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// pad formats v with leading zeros up to width characters
+func pad(width int, v any) string {
+	s := fmt.Sprint(v)
+	if len(s) < width {
+		s = strings.Repeat("0", width-len(s)) + s
+	}
+	return s
+}
@@ -0,0 +1,41 @@
+package inventory
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandHostname(t *testing.T) {
+	data := hostnameData(map[string]any{"Rack": 4, "Site": "ams"}, 7, 50, 12)
+
+	tests := []struct {
+		pattern string
+		want    string
+		wantErr string
+	}{
+		{pattern: "pi-kitchen", want: "pi-kitchen"},
+		{pattern: "edge-{{seq 3}}", want: "edge-012"},
+		{pattern: "edge-{{seq 1}}", want: "edge-12"},
+		{pattern: "rack{{.Rack}}-node{{.Index}}", want: "rack4-node7"},
+		{pattern: "{{.Site}}-r{{pad 2 .Rack}}n{{pad 2 .Index}}", want: "ams-r04n07"},
+		{pattern: "node-{{.Index}}-of-{{.Count}}", want: "node-7-of-50"},
+		{pattern: "rack{{.Row}}", wantErr: `map has no entry for key "Row"`},
+		{pattern: "edge-{{seq}}", wantErr: "invalid hostname pattern"},
+		{pattern: "edge-{{seq 3", wantErr: "invalid hostname pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := expandHostname(tt.pattern, data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expandHostname() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("expandHostname() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
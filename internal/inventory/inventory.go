@@ -0,0 +1,426 @@
+package inventory
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/ipam"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultOutput is the output path pattern used when the inventory does not
+// set one
+const DefaultOutput = "out/{{.Hostname}}/answers.txt"
+
+// Inventory describes a fleet of hosts that share default settings
+type Inventory struct {
+	// Output is a text/template pattern evaluated with each host's
+	// config.Config to get the path of its answer file
+	Output string
+	Hosts  []Host
+	// Pool is the address pool of the network block, nil if the inventory
+	// has none
+	Pool *ipam.Pool
+	// LockFile records the addresses allocated from Pool
+	LockFile string
+	// DNS are the nameservers of the network block, given by Load to the
+	// hosts that set none and get an address from Pool or have one in its
+	// subnet
+	DNS []string
+
+	// lock holds the allocations made by AllocateAddresses and saved the
+	// ones last written to LockFile
+	lock, saved *ipam.Lock
+}
+
+// Host is one host of the inventory with the defaults applied
+type Host struct {
+	// Line is the line of the host entry in the inventory file
+	Line int
+	// Index is the number of the host among the hosts of an entry with a
+	// count, starting at 1
+	Index int
+	// MAC is the hardware address of the host in canonical form, empty if
+	// the entry does not give one
+	MAC    string
+	Config *config.Config
+}
+
+// Name identifies the host in messages
+func (h Host) Name() string {
+	if h.Config.Hostname == "" {
+		return fmt.Sprintf("host on line %d", h.Line)
+	}
+	return fmt.Sprintf("%s (line %d)", h.Config.Hostname, h.Line)
+}
+
+// file is the YAML layout of an inventory file. Defaults and hosts are kept
+// as nodes so each host can be decoded on top of the defaults.
+type file struct {
+	Output   string         `yaml:"output"`
+	Network  *network       `yaml:"network"`
+	Vars     map[string]any `yaml:"vars"`
+	Defaults yaml.Node      `yaml:"defaults"`
+	Hosts    []yaml.Node    `yaml:"hosts"`
+}
+
+// entry holds the keys of a host entry that are not config.Config fields
+type entry struct {
+	// Count is the number of identical hosts the entry stands for
+	Count int            `yaml:"count"`
+	Vars  map[string]any `yaml:"vars"`
+	// MAC identifies the host on the network, for example to serve its
+	// answer file
+	MAC string `yaml:"mac"`
+}
+
+// entryKeys are the keys split off a host entry into an entry
+var entryKeys = map[string]bool{"count": true, "vars": true, "mac": true}
+
+// network is the address pool hosts without an address are allocated from
+type network struct {
+	Subnet   string   `yaml:"subnet"`
+	Start    string   `yaml:"start"`
+	End      string   `yaml:"end"`
+	Gateway  string   `yaml:"gateway"`
+	DNS      []string `yaml:"dns"`
+	LockFile string   `yaml:"lock_file"`
+}
+
+// Load reads an inventory file. Every host starts from a copy of base, then
+// the defaults block and finally the host's own settings are applied, so
+// hosts only need to list what differs from the rest of the fleet. An entry
+// with a count stands for that many hosts, and hostnames may be patterns
+// using the inventory vars, the entry vars, .Index, .Count, .Seq and the
+// seq and pad functions.
+func Load(path string, base *config.Config) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory: %w", err)
+	}
+
+	var f file
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory %s: %w", path, err)
+	}
+	if len(f.Hosts) == 0 {
+		return nil, fmt.Errorf("inventory %s has no hosts", path)
+	}
+
+	defaults := base.Clone()
+	if err := decodeStrict(&f.Defaults, defaults); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory defaults: %w", err)
+	}
+
+	inv := &Inventory{Output: f.Output}
+	if inv.Output == "" {
+		inv.Output = DefaultOutput
+	}
+	if f.Network != nil {
+		if inv.Pool, err = ipam.ParsePool(f.Network.Subnet, f.Network.Start, f.Network.End, f.Network.Gateway); err != nil {
+			return nil, fmt.Errorf("invalid network in inventory %s: %w", path, err)
+		}
+		if err := config.ValidateDNS(f.Network.DNS, ""); err != nil {
+			return nil, fmt.Errorf("invalid network in inventory %s: %w", path, err)
+		}
+		inv.DNS = f.Network.DNS
+		inv.LockFile = f.Network.LockFile
+		if inv.LockFile == "" {
+			inv.LockFile = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".lock"
+		}
+		if !filepath.IsAbs(inv.LockFile) {
+			inv.LockFile = filepath.Join(filepath.Dir(path), inv.LockFile)
+		}
+	}
+	if err := checkVars(f.Vars); err != nil {
+		return nil, fmt.Errorf("invalid inventory vars: %w", err)
+	}
+
+	var errs []error
+	seq := 0
+	for i := range f.Hosts {
+		node := &f.Hosts[i]
+		e, rest, err := splitEntry(node)
+		if err == nil {
+			err = checkVars(e.Vars)
+		}
+		if err == nil && e.Count < 0 {
+			err = fmt.Errorf("count must be positive, got %d", e.Count)
+		}
+		var mac string
+		if err == nil && e.MAC != "" {
+			mac, err = parseMAC(e.MAC, e.Count)
+		}
+		cfg := defaults.Clone()
+		if err == nil {
+			err = decodeStrict(rest, cfg)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("host on line %d: %w", node.Line, err))
+			continue
+		}
+
+		if len(cfg.DNS) == 0 && inv.onNetwork(cfg.Address) {
+			cfg.DNS = append([]string(nil), inv.DNS...)
+		}
+
+		count := max(e.Count, 1)
+		vars := make(map[string]any, len(f.Vars)+len(e.Vars))
+		for k, v := range f.Vars {
+			vars[k] = v
+		}
+		for k, v := range e.Vars {
+			vars[k] = v
+		}
+		for index := 1; index <= count; index++ {
+			seq++
+			host := Host{Line: node.Line, Index: index, MAC: mac, Config: cfg.Clone()}
+			host.Config.Hostname, err = expandHostname(cfg.Hostname, hostnameData(vars, index, count, seq))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("host on line %d: %w", node.Line, err))
+				break
+			}
+			inv.Hosts = append(inv.Hosts, host)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return inv, nil
+}
+
+// onNetwork reports whether a host with address is on the network block: it
+// has no address and gets one from the pool, or an address in the subnet
+func (inv *Inventory) onNetwork(address string) bool {
+	if inv.Pool == nil {
+		return false
+	}
+	if address == "" {
+		return true
+	}
+	prefix, err := netip.ParsePrefix(address)
+	return err == nil && inv.Pool.Subnet.Contains(prefix.Addr())
+}
+
+// splitEntry separates the entry keys of a host node from its configuration
+func splitEntry(node *yaml.Node) (entry, *yaml.Node, error) {
+	var e entry
+	if node.Kind != yaml.MappingNode {
+		return e, node, nil
+	}
+	rest := *node
+	rest.Content = nil
+	keys := &yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if entryKeys[node.Content[i].Value] {
+			keys.Content = append(keys.Content, node.Content[i], node.Content[i+1])
+		} else {
+			rest.Content = append(rest.Content, node.Content[i], node.Content[i+1])
+		}
+	}
+	if err := keys.Decode(&e); err != nil {
+		return e, nil, err
+	}
+	return e, &rest, nil
+}
+
+// parseMAC returns the canonical form of an entry's hardware address, which
+// can only stand for a single host
+func parseMAC(s string, count int) (string, error) {
+	if count > 1 {
+		return "", fmt.Errorf("mac cannot be used with a count, every host has its own")
+	}
+	hw, err := net.ParseMAC(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid mac %q: %w", s, err)
+	}
+	return hw.String(), nil
+}
+
+// checkVars rejects inventory variables that hide the built-in ones
+func checkVars(vars map[string]any) error {
+	for _, name := range hostVars {
+		if _, ok := vars[name]; ok {
+			return fmt.Errorf("variable %s is reserved", name)
+		}
+	}
+	return nil
+}
+
+// decodeStrict decodes node into cfg, rejecting unknown fields. The output
+// key is rejected with an explanation, as it is easily mistaken for the
+// output path pattern or the output policy of a config file.
+func decodeStrict(node *yaml.Node, cfg *config.Config) error {
+	if node.Kind == 0 {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "output" {
+			return fmt.Errorf("line %d: output cannot be set per host, set the output path pattern at the top of the inventory and the output policy in the --config file", node.Content[i].Line)
+		}
+	}
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	return dec.Decode(cfg)
+}
+
+// OutputPath returns the answer file path for h
+func (inv *Inventory) OutputPath(h Host) (string, error) {
+	t, err := template.New("output").Option("missingkey=error").Parse(inv.Output)
+	if err != nil {
+		return "", fmt.Errorf("invalid output pattern: %w", err)
+	}
+	var buf strings.Builder
+	if err := t.Execute(&buf, h.Config); err != nil {
+		return "", fmt.Errorf("invalid output pattern: %w", err)
+	}
+	if buf.Len() == 0 {
+		return "", fmt.Errorf("output pattern %q gives an empty path", inv.Output)
+	}
+	return filepath.Clean(buf.String()), nil
+}
+
+// Validate checks every host and reports all problems together: invalid
+// host configurations, hostnames and addresses used more than once and hosts
+// whose answer files would end up at the same path, and hardware addresses
+// given to more than one host
+func (inv *Inventory) Validate() error {
+	var errs []error
+	hostnames := make(map[string][]Host)
+	addresses := make(map[string][]Host)
+	macs := make(map[string][]Host)
+	outputs := make(map[string][]Host)
+
+	for _, h := range inv.Hosts {
+		if err := h.Config.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h.Name(), err))
+		}
+		if h.Config.Hostname != "" {
+			hostnames[h.Config.Hostname] = append(hostnames[h.Config.Hostname], h)
+		}
+		if prefix, err := netip.ParsePrefix(h.Config.Address); err == nil {
+			addresses[prefix.Addr().String()] = append(addresses[prefix.Addr().String()], h)
+		}
+		if h.MAC != "" {
+			macs[h.MAC] = append(macs[h.MAC], h)
+		}
+		path, err := inv.OutputPath(h)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h.Name(), err))
+			continue
+		}
+		outputs[path] = append(outputs[path], h)
+	}
+
+	errs = append(errs, collisions("hostname", hostnames)...)
+	errs = append(errs, collisions("address", addresses)...)
+	errs = append(errs, collisions("mac", macs)...)
+	errs = append(errs, collisions("output path", outputs)...)
+	return errors.Join(errs...)
+}
+
+// collisions reports every value used by more than one host, sorted by
+// value. Hosts of the same entry are told apart by their index.
+func collisions(what string, used map[string][]Host) []error {
+	var values []string
+	for v, hosts := range used {
+		if len(hosts) > 1 {
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+
+	var errs []error
+	for _, v := range values {
+		lines := make(map[int]int)
+		for _, h := range used[v] {
+			lines[h.Line]++
+		}
+		refs := make([]string, len(used[v]))
+		for i, h := range used[v] {
+			refs[i] = fmt.Sprint(h.Line)
+			if lines[h.Line] > 1 {
+				refs[i] += fmt.Sprintf(" #%d", h.Index)
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s %s is used by the hosts on lines %s", what, v, strings.Join(refs, ", ")))
+	}
+	return errs
+}
+
+// AllocateAddresses gives every host without an address one from the
+// network pool, keeping the addresses recorded in the lock file. Allocated
+// hosts and hosts with an address in the subnet also get the pool gateway
+// unless they set their own, and allocated hosts need nameservers. The
+// allocations are kept until SaveLock writes them. It does nothing if the
+// inventory has no network block, and expects Validate to have passed.
+func (inv *Inventory) AllocateAddresses() error {
+	if inv.Pool == nil {
+		return nil
+	}
+	lock, err := ipam.LoadLock(inv.LockFile)
+	if err != nil {
+		return err
+	}
+	before := lock.Clone()
+
+	hosts := make([]ipam.Host, len(inv.Hosts))
+	for i, h := range inv.Hosts {
+		hosts[i].Name = h.Config.Hostname
+		if prefix, err := netip.ParsePrefix(h.Config.Address); err == nil {
+			hosts[i].Address = prefix.Addr()
+		}
+	}
+	addrs, err := inv.Pool.Allocate(hosts, lock)
+	if err != nil {
+		return fmt.Errorf("failed to allocate addresses: %w", err)
+	}
+
+	var errs []error
+	for i, h := range inv.Hosts {
+		if h.Config.Address == "" {
+			h.Config.Address = netip.PrefixFrom(addrs[i], inv.Pool.Subnet.Bits()).String()
+			if len(h.Config.DNS) == 0 {
+				errs = append(errs, fmt.Errorf("%s: static address %s needs dns nameservers, set dns in the network block", h.Name(), h.Config.Address))
+			}
+		}
+		if h.Config.Gateway == "" && inv.Pool.Gateway.IsValid() && inv.Pool.Subnet.Contains(addrs[i]) {
+			h.Config.Gateway = inv.Pool.Gateway.String()
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	inv.lock, inv.saved = lock, before
+	return nil
+}
+
+// SaveLock writes the allocations of AllocateAddresses to the lock file if
+// they changed. Callers save once the files of the hosts have been written,
+// so a failed run does not reserve addresses.
+func (inv *Inventory) SaveLock() error {
+	if inv.lock == nil || inv.lock.Equal(inv.saved) {
+		return nil
+	}
+	if err := inv.lock.Save(inv.LockFile); err != nil {
+		return err
+	}
+	inv.saved = inv.lock.Clone()
+	return nil
+}
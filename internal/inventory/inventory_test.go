@@ -0,0 +1,431 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+func writeInventory(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hosts.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeInventory(t, `output: build/{{.Hostname}}.txt
+defaults:
+  username: pi
+  timezone: Europe/London
+  groups: [audio, video]
+hosts:
+  - hostname: pi-kitchen
+  - hostname: pi-office
+    interface: wlan0
+    groups: [wheel]
+    mac: 52-54-00-AB-CD-EF
+`)
+	base := config.New()
+	base.Keymap = "uk"
+
+	inv, err := Load(path, base)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if inv.Output != "build/{{.Hostname}}.txt" {
+		t.Errorf("Output = %q", inv.Output)
+	}
+	if len(inv.Hosts) != 2 {
+		t.Fatalf("Load() returned %d hosts, want 2", len(inv.Hosts))
+	}
+
+	kitchen := base.Clone()
+	kitchen.Hostname = "pi-kitchen"
+	kitchen.Username = "pi"
+	kitchen.Timezone = "Europe/London"
+	kitchen.Groups = []string{"audio", "video"}
+
+	office := kitchen.Clone()
+	office.Hostname = "pi-office"
+	office.NetworkIface = "wlan0"
+	office.Groups = []string{"wheel"}
+
+	if inv.Hosts[0].Line != 7 || !reflect.DeepEqual(inv.Hosts[0].Config, kitchen) {
+		t.Errorf("Hosts[0] = line %d %+v, want line 7 %+v", inv.Hosts[0].Line, inv.Hosts[0].Config, kitchen)
+	}
+	if inv.Hosts[1].Line != 8 || !reflect.DeepEqual(inv.Hosts[1].Config, office) {
+		t.Errorf("Hosts[1] = line %d %+v, want line 8 %+v", inv.Hosts[1].Line, inv.Hosts[1].Config, office)
+	}
+	if inv.Hosts[0].MAC != "" || inv.Hosts[1].MAC != "52:54:00:ab:cd:ef" {
+		t.Errorf("MACs = %q, %q, want only pi-office's in canonical form", inv.Hosts[0].MAC, inv.Hosts[1].MAC)
+	}
+	if base.Username != "alpine" {
+		t.Error("Load() modified the base configuration")
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "no hosts",
+			content: "defaults:\n  username: pi\n",
+			want:    []string{"has no hosts"},
+		},
+		{
+			name:    "unknown top-level key",
+			content: "host:\n  - hostname: a\n",
+			want:    []string{"field host not found"},
+		},
+		{
+			name:    "unknown default field",
+			content: "defaults:\n  hostnme: a\nhosts:\n  - hostname: a\n",
+			want:    []string{"failed to parse inventory defaults", "field hostnme not found"},
+		},
+		{
+			name:    "output policy in defaults",
+			content: "defaults:\n  output:\n    denied_roots: []\nhosts:\n  - hostname: a\n",
+			want:    []string{"failed to parse inventory defaults", "line 2: output cannot be set per host"},
+		},
+		{
+			name:    "output in a host",
+			content: "hosts:\n  - hostname: a\n    output: a.txt\n",
+			want:    []string{"host on line 2", "output cannot be set per host"},
+		},
+		{
+			name:    "invalid network",
+			content: "network:\n  subnet: 10.20.0.0/24\n  start: .300\nhosts:\n  - hostname: a\n",
+			want:    []string{"invalid network in inventory", "invalid pool start"},
+		},
+		{
+			name:    "invalid network nameserver",
+			content: "network:\n  subnet: 10.20.0.0/24\n  dns: [router.lan]\nhosts:\n  - hostname: a\n",
+			want:    []string{"invalid network in inventory", `invalid nameserver "router.lan"`},
+		},
+		{
+			name:    "reserved variable",
+			content: "vars:\n  Index: 3\nhosts:\n  - hostname: a\n",
+			want:    []string{"invalid inventory vars: variable Index is reserved"},
+		},
+		{
+			name:    "bad entries",
+			content: "hosts:\n  - hostname: a\n    count: -1\n  - hostname: b{{.Rack}}\n    count: 3\n  - hostname: c\n    vars:\n      Seq: 1\n",
+			want: []string{
+				"host on line 2: count must be positive, got -1",
+				`host on line 4: invalid hostname pattern`,
+				"host on line 6: variable Seq is reserved",
+			},
+		},
+		{
+			name:    "bad macs",
+			content: "hosts:\n  - hostname: a\n    mac: 52:54:00\n  - hostname: b{{.Index}}\n    count: 2\n    mac: 52:54:00:00:00:01\n",
+			want: []string{
+				`host on line 2: invalid mac "52:54:00"`,
+				"host on line 4: mac cannot be used with a count",
+			},
+		},
+		{
+			name:    "every bad host is reported",
+			content: "hosts:\n  - hostnme: a\n  - hostname: b\n  - usernme: c\n",
+			want:    []string{"host on line 2", "host on line 4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeInventory(t, tt.content), config.New())
+			if err == nil {
+				t.Fatal("Load() error = nil")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load() error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestInventory_OutputPath(t *testing.T) {
+	cfg := config.New()
+	cfg.Hostname = "pi-kitchen"
+	h := Host{Line: 3, Config: cfg}
+
+	tests := []struct {
+		pattern string
+		want    string
+		wantErr string
+	}{
+		{pattern: DefaultOutput, want: filepath.Join("out", "pi-kitchen", "answers.txt")},
+		{pattern: "/srv/pxe/{{.Hostname}}/../{{.Username}}.txt", want: "/srv/pxe/alpine.txt"},
+		{pattern: "{{.Hostnme}}", wantErr: "invalid output pattern"},
+		{pattern: "{{.Hostname", wantErr: "invalid output pattern"},
+		{pattern: "{{.SSHKey}}", wantErr: "gives an empty path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			inv := &Inventory{Output: tt.pattern}
+			got, err := inv.OutputPath(h)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("OutputPath() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("OutputPath() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInventory_Validate(t *testing.T) {
+	path := writeInventory(t, `output: out/{{.Username}}.txt
+hosts:
+  - hostname: pi-a
+    username: a
+  - hostname: pi-a
+    username: b
+  - hostname: pi-c
+    username: a
+  - hostname: pi-d
+    username: d
+    password: ""
+  - hostname: pi-e
+    username: e
+  - hostname: pi-f
+    username: f
+    address: 10.0.0.5/24
+  - hostname: pi-g
+    username: g
+    address: 10.0.0.5/16
+`)
+	base := config.New()
+	base.DNS = []string{"10.0.0.1"}
+	inv, err := Load(path, base)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	err = inv.Validate()
+	if err == nil {
+		t.Fatal("Validate() error = nil")
+	}
+	want := []string{
+		"pi-d (line 9): password cannot be empty",
+		"hostname pi-a is used by the hosts on lines 3, 5",
+		"address 10.0.0.5 is used by the hosts on lines 14, 17",
+		"output path " + filepath.Join("out", "a.txt") + " is used by the hosts on lines 3, 7",
+	}
+	if got := strings.Split(err.Error(), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate() errors =\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	inv.Hosts = inv.Hosts[len(inv.Hosts)-1:]
+	if err := inv.Validate(); err != nil {
+		t.Errorf("Validate() of a single valid host error = %v", err)
+	}
+
+	inv, err = Load(writeInventory(t, "hosts:\n  - hostname: a\n    mac: 52:54:00:00:00:01\n  - hostname: b\n    mac: 52-54-00-00-00-01\n"), config.New())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := inv.Validate(); err == nil || err.Error() != "mac 52:54:00:00:00:01 is used by the hosts on lines 2, 4" {
+		t.Errorf("Validate() error = %v, want the shared mac reported", err)
+	}
+}
+
+func TestInventory_AllocateAddresses(t *testing.T) {
+	path := writeInventory(t, `network:
+  subnet: 10.20.0.0/24
+  start: .50
+  gateway: .1
+  dns: [10.20.0.1]
+hosts:
+  - hostname: pi-kitchen
+  - hostname: pi-office
+  - hostname: pi-garage
+    address: 10.20.0.10/24
+  - hostname: pi-remote
+    address: 192.168.5.10/24
+    gateway: 192.168.5.1
+    dns: [192.168.5.1]
+`)
+	lockFile := filepath.Join(filepath.Dir(path), "hosts.lock")
+	load := func() *Inventory {
+		t.Helper()
+		inv, err := Load(path, config.New())
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if err := inv.Validate(); err != nil {
+			t.Fatalf("Validate() error = %v", err)
+		}
+		return inv
+	}
+	addresses := func(inv *Inventory) []string {
+		var got []string
+		for _, h := range inv.Hosts {
+			got = append(got, h.Config.Hostname+" "+h.Config.Address+" via "+h.Config.Gateway+" dns "+strings.Join(h.Config.DNS, ","))
+		}
+		return got
+	}
+
+	inv := load()
+	if inv.LockFile != lockFile {
+		t.Errorf("LockFile = %q, want %q", inv.LockFile, lockFile)
+	}
+
+	// allocating does not write the lock file, SaveLock does
+	if err := inv.AllocateAddresses(); err != nil {
+		t.Fatalf("AllocateAddresses() error = %v", err)
+	}
+	want := []string{
+		"pi-kitchen 10.20.0.50/24 via 10.20.0.1 dns 10.20.0.1",
+		"pi-office 10.20.0.51/24 via 10.20.0.1 dns 10.20.0.1",
+		"pi-garage 10.20.0.10/24 via 10.20.0.1 dns 10.20.0.1",
+		"pi-remote 192.168.5.10/24 via 192.168.5.1 dns 192.168.5.1",
+	}
+	if got := addresses(inv); !reflect.DeepEqual(got, want) {
+		t.Errorf("addresses = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(lockFile); !os.IsNotExist(err) {
+		t.Error("AllocateAddresses() wrote the lock file")
+	}
+	if err := inv.SaveLock(); err != nil {
+		t.Fatalf("SaveLock() error = %v", err)
+	}
+	if _, err := os.Stat(lockFile); err != nil {
+		t.Fatalf("lock file not written: %v", err)
+	}
+
+	// a host added at the top does not move the others
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), "hosts:\n", "hosts:\n  - hostname: pi-attic\n", 1))
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	inv = load()
+	if err := inv.AllocateAddresses(); err != nil {
+		t.Fatalf("AllocateAddresses() error = %v", err)
+	}
+	want = append([]string{"pi-attic 10.20.0.52/24 via 10.20.0.1 dns 10.20.0.1"}, want...)
+	if got := addresses(inv); !reflect.DeepEqual(got, want) {
+		t.Errorf("addresses after adding a host = %v, want %v", got, want)
+	}
+	if err := inv.SaveLock(); err != nil {
+		t.Fatalf("SaveLock() error = %v", err)
+	}
+
+	// an explicit address taken from the lock file is a conflict
+	data = []byte(strings.Replace(string(data), "  - hostname: pi-garage\n    address: 10.20.0.10/24", "  - hostname: pi-garage\n    address: 10.20.0.51/24", 1))
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = load().AllocateAddresses()
+	if err == nil || !strings.Contains(err.Error(), "pi-garage: address 10.20.0.51 is allocated to pi-office in the lock file") {
+		t.Errorf("AllocateAddresses() error = %v, want a conflict with the lock file", err)
+	}
+
+	// allocated hosts need nameservers
+	data = []byte(strings.Replace(string(data), "  dns: [10.20.0.1]\n", "", 1))
+	data = []byte(strings.Replace(string(data), "    address: 10.20.0.51/24\n", "", 1))
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = load().AllocateAddresses()
+	if err == nil || !strings.Contains(err.Error(), "pi-attic (line 6): static address 10.20.0.52/24 needs dns nameservers, set dns in the network block") {
+		t.Errorf("AllocateAddresses() error = %v, want the missing nameservers reported", err)
+	}
+}
+
+func TestLoad_HostnamePatterns(t *testing.T) {
+	path := writeInventory(t, `vars:
+  Site: ams
+defaults:
+  hostname: edge-{{seq 3}}
+hosts:
+  - count: 3
+  - hostname: rack{{.Rack}}-node{{.Index}}
+    count: 2
+    vars:
+      Rack: 4
+  - hostname: "{{.Site}}-gw"
+    vars:
+      Site: fra
+  - hostname: spare
+`)
+	inv, err := Load(path, config.New())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	var got []string
+	for _, h := range inv.Hosts {
+		got = append(got, fmt.Sprintf("%s line %d #%d", h.Config.Hostname, h.Line, h.Index))
+	}
+	want := []string{
+		"edge-001 line 6 #1",
+		"edge-002 line 6 #2",
+		"edge-003 line 6 #3",
+		"rack4-node1 line 7 #1",
+		"rack4-node2 line 7 #2",
+		"fra-gw line 11 #1",
+		"spare line 14 #1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts = %v, want %v", got, want)
+	}
+
+	// hosts of one entry get their own copy of the configuration
+	inv.Hosts[0].Config.Groups[0] = "changed"
+	if inv.Hosts[1].Config.Groups[0] == "changed" {
+		t.Error("hosts of one entry share their groups")
+	}
+	if err := inv.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestInventory_ValidateExpandedHostnames(t *testing.T) {
+	path := writeInventory(t, `output: out/{{.Hostname}}-{{.Username}}.txt
+hosts:
+  - hostname: node
+    count: 2
+  - hostname: node-{{.Index}}-
+`)
+	inv, err := Load(path, config.New())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	err = inv.Validate()
+	if err == nil {
+		t.Fatal("Validate() error = nil")
+	}
+	want := []string{
+		`node-1- (line 5): invalid hostname "node-1-"`,
+		"hostname node is used by the hosts on lines 3 #1, 3 #2",
+		"output path " + filepath.Join("out", "node-alpine.txt") + " is used by the hosts on lines 3 #1, 3 #2",
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("Validate() error =\n%v\nwant it to contain %q", err, w)
+		}
+	}
+}
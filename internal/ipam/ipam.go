@@ -0,0 +1,208 @@
+package ipam
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Pool is a range of addresses in a subnet that hosts are allocated
+// addresses from
+type Pool struct {
+	Subnet netip.Prefix
+	Start  netip.Addr
+	End    netip.Addr
+	// Gateway is never allocated. It is the zero Addr if the subnet has no
+	// gateway.
+	Gateway netip.Addr
+}
+
+// ParsePool parses a pool definition. Start, end and gateway are full
+// addresses or, for IPv4, suffixes such as .50 that replace the trailing
+// octets of the subnet address. An empty start or end is the first or last
+// usable address of the subnet.
+func ParsePool(subnet, start, end, gateway string) (*Pool, error) {
+	prefix, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet %q, want a subnet in CIDR notation such as 10.20.0.0/24", subnet)
+	}
+	prefix = prefix.Masked()
+	first, last := usable(prefix)
+	if !first.IsValid() {
+		return nil, fmt.Errorf("subnet %s has no usable addresses", prefix)
+	}
+
+	p := &Pool{Subnet: prefix, Start: first, End: last}
+	if start != "" {
+		if p.Start, err = parseAddr(prefix, start); err != nil {
+			return nil, fmt.Errorf("invalid pool start: %w", err)
+		}
+	}
+	if end != "" {
+		if p.End, err = parseAddr(prefix, end); err != nil {
+			return nil, fmt.Errorf("invalid pool end: %w", err)
+		}
+	}
+	if gateway != "" {
+		if p.Gateway, err = parseAddr(prefix, gateway); err != nil {
+			return nil, fmt.Errorf("invalid gateway: %w", err)
+		}
+	}
+
+	if p.Start.Less(first) || last.Less(p.End) {
+		return nil, fmt.Errorf("pool %s is outside the usable addresses %s-%s of %s", p, first, last, prefix)
+	}
+	if p.End.Less(p.Start) {
+		return nil, fmt.Errorf("pool start %s is after its end %s", p.Start, p.End)
+	}
+	return p, nil
+}
+
+// String formats the pool as its first and last address
+func (p *Pool) String() string {
+	return p.Start.String() + "-" + p.End.String()
+}
+
+// Contains reports whether addr is in the range of the pool
+func (p *Pool) Contains(addr netip.Addr) bool {
+	return addr.IsValid() && !addr.Less(p.Start) && !p.End.Less(addr)
+}
+
+// Host is a host asking for an address
+type Host struct {
+	Name string
+	// Address is the address assigned to the host explicitly, which is
+	// used as it is. The zero Addr asks for an address from the pool.
+	Address netip.Addr
+}
+
+// Allocate returns the address of every host, in the order of hosts. Hosts
+// with an explicit address keep it. The others keep the address lock records
+// for them if it is still in the pool, and get the lowest free address
+// otherwise. The gateway and explicit addresses are never handed out.
+//
+// lock is updated to record the allocated addresses of exactly these hosts,
+// so hosts that are no longer listed release their address. All conflicts
+// are reported together, and lock is left unchanged if there are any.
+func (p *Pool) Allocate(hosts []Host, lock *Lock) ([]netip.Addr, error) {
+	var errs []error
+	addrs := make([]netip.Addr, len(hosts))
+	owner := make(map[netip.Addr]string)
+	if p.Gateway.IsValid() {
+		owner[p.Gateway] = "the gateway"
+	}
+
+	// explicit addresses first, so they win over the lock file
+	for i, h := range hosts {
+		if !h.Address.IsValid() {
+			continue
+		}
+		if other, ok := owner[h.Address]; ok {
+			errs = append(errs, fmt.Errorf("%s: address %s is already used by %s", h.Name, h.Address, other))
+			continue
+		}
+		owner[h.Address] = h.Name
+		addrs[i] = h.Address
+	}
+
+	// then the allocations recorded in the lock file. An address that has
+	// been given to another host explicitly is a conflict, one outside the
+	// pool or on the gateway after the pool changed is allocated again.
+	var pending []int
+	for i, h := range hosts {
+		if h.Address.IsValid() {
+			continue
+		}
+		addr, ok := lock.Allocations[h.Name]
+		if !ok || !p.Contains(addr) || addr == p.Gateway {
+			pending = append(pending, i)
+			continue
+		}
+		if other, taken := owner[addr]; taken {
+			errs = append(errs, fmt.Errorf("%s: address %s is allocated to %s in the lock file", other, addr, h.Name))
+			continue
+		}
+		owner[addr] = h.Name
+		addrs[i] = addr
+	}
+
+	// and finally the lowest free addresses for everything else
+	next := p.Start
+	for n, i := range pending {
+		for p.Contains(next) {
+			if _, taken := owner[next]; !taken {
+				break
+			}
+			next = next.Next()
+		}
+		if !p.Contains(next) {
+			errs = append(errs, fmt.Errorf("address pool %s is exhausted: %d of %d hosts did not get an address", p, len(pending)-n, len(hosts)))
+			break
+		}
+		owner[next] = hosts[i].Name
+		addrs[i] = next
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	allocations := make(map[string]netip.Addr)
+	for i, h := range hosts {
+		if !h.Address.IsValid() {
+			allocations[h.Name] = addrs[i]
+		}
+	}
+	lock.Allocations = allocations
+	return addrs, nil
+}
+
+// parseAddr parses an address in prefix, accepting IPv4 suffixes like .50
+func parseAddr(prefix netip.Prefix, s string) (netip.Addr, error) {
+	var addr netip.Addr
+	if strings.HasPrefix(s, ".") && prefix.Addr().Is4() {
+		octets := strings.Split(s[1:], ".")
+		b := prefix.Addr().As4()
+		if len(octets) > len(b) {
+			return addr, fmt.Errorf("invalid address %q", s)
+		}
+		for i, o := range octets {
+			n, err := strconv.ParseUint(o, 10, 8)
+			if err != nil {
+				return addr, fmt.Errorf("invalid address %q", s)
+			}
+			b[len(b)-len(octets)+i] = byte(n)
+		}
+		addr = netip.AddrFrom4(b)
+	} else {
+		var err error
+		if addr, err = netip.ParseAddr(s); err != nil {
+			return addr, fmt.Errorf("invalid address %q", s)
+		}
+	}
+	if !prefix.Contains(addr) {
+		return addr, fmt.Errorf("address %s is not in the subnet %s", addr, prefix)
+	}
+	return addr, nil
+}
+
+// usable returns the first and last address of prefix that can be assigned
+// to a host. The network and broadcast addresses of IPv4 subnets are left
+// out, except in /31 and /32 subnets which have none.
+func usable(prefix netip.Prefix) (netip.Addr, netip.Addr) {
+	first := prefix.Addr()
+	b := first.AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	last, _ := netip.AddrFromSlice(b)
+	if first.Is4() && prefix.Bits() < 31 {
+		first, last = first.Next(), last.Prev()
+	} else if first.Is6() && prefix.Bits() < 128 {
+		// the first address is the subnet-router anycast address
+		first = first.Next()
+	}
+	return first, last
+}
@@ -0,0 +1,178 @@
+package ipam
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePool(t *testing.T) {
+	tests := []struct {
+		name                        string
+		subnet, start, end, gateway string
+		want                        string
+		errContains                 string
+	}{
+		{name: "whole subnet", subnet: "10.20.0.0/24", want: "10.20.0.1-10.20.0.254"},
+		{name: "suffixes", subnet: "10.20.0.0/24", start: ".50", end: ".99", gateway: ".1", want: "10.20.0.50-10.20.0.99"},
+		{name: "multi octet suffix", subnet: "10.20.0.0/16", start: ".1.0", want: "10.20.1.0-10.20.255.254"},
+		{name: "full addresses", subnet: "10.20.0.7/24", start: "10.20.0.100", end: "10.20.0.110", want: "10.20.0.100-10.20.0.110"},
+		{name: "point to point", subnet: "10.20.0.0/31", want: "10.20.0.0-10.20.0.1"},
+		{name: "ipv6", subnet: "fd00::/120", start: "fd00::10", want: "fd00::10-fd00::ff"},
+		{name: "invalid subnet", subnet: "10.20.0.0", errContains: "CIDR notation"},
+		{name: "start outside subnet", subnet: "10.20.0.0/24", start: "10.20.1.5", errContains: "not in the subnet 10.20.0.0/24"},
+		{name: "invalid suffix", subnet: "10.20.0.0/24", start: ".256", errContains: `invalid address ".256"`},
+		{name: "network address", subnet: "10.20.0.0/24", start: ".0", errContains: "outside the usable addresses 10.20.0.1-10.20.0.254"},
+		{name: "reversed", subnet: "10.20.0.0/24", start: ".50", end: ".40", errContains: "start 10.20.0.50 is after its end 10.20.0.40"},
+		{name: "gateway outside subnet", subnet: "10.20.0.0/24", gateway: "10.30.0.1", errContains: "invalid gateway"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePool(tt.subnet, tt.start, tt.end, tt.gateway)
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("ParsePool() error = %v, want %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePool() error = %v", err)
+			}
+			if p.String() != tt.want {
+				t.Errorf("ParsePool() = %s, want %s", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestPool_Allocate(t *testing.T) {
+	addr := netip.MustParseAddr
+	lockOf := func(pairs ...string) *Lock {
+		lock := &Lock{Allocations: make(map[string]netip.Addr)}
+		for i := 0; i < len(pairs); i += 2 {
+			lock.Allocations[pairs[i]] = addr(pairs[i+1])
+		}
+		return lock
+	}
+
+	tests := []struct {
+		name        string
+		start, end  string
+		hosts       []Host
+		lock        *Lock
+		want        []string
+		wantLock    *Lock
+		errContains []string
+	}{
+		{
+			name:     "lowest free addresses in order",
+			hosts:    []Host{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+			lock:     lockOf(),
+			want:     []string{"10.20.0.50", "10.20.0.51", "10.20.0.52"},
+			wantLock: lockOf("a", "10.20.0.50", "b", "10.20.0.51", "c", "10.20.0.52"),
+		},
+		{
+			name:     "locked addresses are kept",
+			hosts:    []Host{{Name: "new"}, {Name: "a"}, {Name: "b"}},
+			lock:     lockOf("a", "10.20.0.51", "b", "10.20.0.50"),
+			want:     []string{"10.20.0.52", "10.20.0.51", "10.20.0.50"},
+			wantLock: lockOf("a", "10.20.0.51", "b", "10.20.0.50", "new", "10.20.0.52"),
+		},
+		{
+			name:     "removed hosts release their address",
+			hosts:    []Host{{Name: "b"}, {Name: "c"}},
+			lock:     lockOf("a", "10.20.0.50", "b", "10.20.0.51"),
+			want:     []string{"10.20.0.51", "10.20.0.50"},
+			wantLock: lockOf("b", "10.20.0.51", "c", "10.20.0.50"),
+		},
+		{
+			name:     "explicit addresses are skipped",
+			hosts:    []Host{{Name: "fixed", Address: addr("10.20.0.50")}, {Name: "a"}, {Name: "outside", Address: addr("192.168.1.5")}},
+			lock:     lockOf(),
+			want:     []string{"10.20.0.50", "10.20.0.51", "192.168.1.5"},
+			wantLock: lockOf("a", "10.20.0.51"),
+		},
+		{
+			name:     "locked address outside a shrunk pool is allocated again",
+			start:    ".60",
+			hosts:    []Host{{Name: "a"}},
+			lock:     lockOf("a", "10.20.0.50"),
+			want:     []string{"10.20.0.60"},
+			wantLock: lockOf("a", "10.20.0.60"),
+		},
+		{
+			name:        "explicit gateway",
+			hosts:       []Host{{Name: "router", Address: addr("10.20.0.1")}},
+			lock:        lockOf(),
+			errContains: []string{"router: address 10.20.0.1 is already used by the gateway"},
+		},
+		{
+			name:        "explicit duplicate",
+			hosts:       []Host{{Name: "a", Address: addr("10.20.0.9")}, {Name: "b", Address: addr("10.20.0.9")}},
+			lock:        lockOf(),
+			errContains: []string{"b: address 10.20.0.9 is already used by a"},
+		},
+		{
+			name:        "explicit address allocated in the lock file",
+			hosts:       []Host{{Name: "a"}, {Name: "fixed", Address: addr("10.20.0.50")}},
+			lock:        lockOf("a", "10.20.0.50"),
+			errContains: []string{"fixed: address 10.20.0.50 is allocated to a in the lock file"},
+		},
+		{
+			name:  "exhausted",
+			end:   ".51",
+			hosts: []Host{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d", Address: addr("10.20.0.1")}},
+			lock:  lockOf(),
+			errContains: []string{
+				"d: address 10.20.0.1 is already used by the gateway",
+				"address pool 10.20.0.50-10.20.0.51 is exhausted: 1 of 4 hosts did not get an address",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := tt.start
+			if start == "" {
+				start = ".50"
+			}
+			p, err := ParsePool("10.20.0.0/24", start, tt.end, ".1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := tt.lock.Clone()
+
+			got, err := p.Allocate(tt.hosts, tt.lock)
+			if len(tt.errContains) > 0 {
+				if err == nil {
+					t.Fatalf("Allocate() = %v, want an error", got)
+				}
+				for _, s := range tt.errContains {
+					if !strings.Contains(err.Error(), s) {
+						t.Errorf("Allocate() error = %v, want %q", err, s)
+					}
+				}
+				if !tt.lock.Equal(before) {
+					t.Errorf("Allocate() changed the lock to %v on error", tt.lock.Allocations)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Allocate() error = %v", err)
+			}
+
+			var addrs []string
+			for _, a := range got {
+				addrs = append(addrs, a.String())
+			}
+			if !reflect.DeepEqual(addrs, tt.want) {
+				t.Errorf("Allocate() = %v, want %v", addrs, tt.want)
+			}
+			if !tt.lock.Equal(tt.wantLock) {
+				t.Errorf("lock = %v, want %v", tt.lock.Allocations, tt.wantLock.Allocations)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package ipam
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// lockHeader is written at the top of every lock file
+const lockHeader = `# Addresses allocated to the hosts of an inventory by alpine-hero.
+# Keep this file next to the inventory so hosts keep their address.
+`
+
+// Lock records the address allocated to each host so that the hosts keep
+// their address when the inventory is generated again
+type Lock struct {
+	Allocations map[string]netip.Addr `yaml:"allocations"`
+}
+
+// LoadLock reads a lock file. A missing file gives an empty lock.
+func LoadLock(path string) (*Lock, error) {
+	lock := &Lock{Allocations: make(map[string]netip.Addr)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lock file %s: %w", path, err)
+	}
+	if lock.Allocations == nil {
+		lock.Allocations = make(map[string]netip.Addr)
+	}
+	return lock, nil
+}
+
+// Equal reports whether both locks record the same allocations
+func (l *Lock) Equal(other *Lock) bool {
+	return maps.Equal(l.Allocations, other.Allocations)
+}
+
+// Clone returns a copy of the lock
+func (l *Lock) Clone() *Lock {
+	return &Lock{Allocations: maps.Clone(l.Allocations)}
+}
+
+// Save writes the lock file. It is written to a temporary file and renamed
+// into place so an interrupted run cannot lose the allocations.
+func (l *Lock) Save(path string) error {
+	var buf bytes.Buffer
+	buf.WriteString(lockHeader)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(l); err != nil {
+		return fmt.Errorf("failed to encode lock file: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to encode lock file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	_, err = tmp.Write(buf.Bytes())
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package ipam
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLock_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.lock")
+
+	lock, err := LoadLock(path)
+	if err != nil {
+		t.Fatalf("LoadLock() of a missing file error = %v", err)
+	}
+	if len(lock.Allocations) != 0 {
+		t.Errorf("LoadLock() of a missing file = %v, want no allocations", lock.Allocations)
+	}
+
+	lock.Allocations["pi-office"] = netip.MustParseAddr("10.20.0.51")
+	lock.Allocations["pi-kitchen"] = netip.MustParseAddr("10.20.0.50")
+	if err := lock.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := lockHeader + "allocations:\n  pi-kitchen: 10.20.0.50\n  pi-office: 10.20.0.51\n"
+	if string(data) != want {
+		t.Errorf("lock file =\n%s\nwant\n%s", data, want)
+	}
+
+	loaded, err := LoadLock(path)
+	if err != nil {
+		t.Fatalf("LoadLock() error = %v", err)
+	}
+	if !loaded.Equal(lock) {
+		t.Errorf("LoadLock() = %v, want %v", loaded.Allocations, lock.Allocations)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the lock file", len(entries))
+	}
+}
+
+func TestLoadLock_Errors(t *testing.T) {
+	tmpDir := t.TempDir()
+	tests := []struct {
+		name        string
+		content     string
+		errContains string
+	}{
+		{name: "invalid address", content: "allocations:\n  a: 10.20.0.300\n", errContains: "failed to parse lock file"},
+		{name: "unknown key", content: "hosts:\n  a: 10.20.0.5\n", errContains: "field hosts not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, tt.name+".lock")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadLock(path)
+			if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("LoadLock() error = %v, want %q", err, tt.errContains)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package ipxe
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/btassone/alpine-hero/internal/apkovl"
+)
+
+// MenuFile is the name of the menu script
+const MenuFile = "boot.ipxe"
+
+// DefaultBootURL is the netboot directory of the Alpine release the scripts
+// boot when none is given
+const DefaultBootURL = "https://dl-cdn.alpinelinux.org/alpine/v3.20/releases/x86_64/netboot"
+
+// DefaultRepo is the repository the booted system installs packages from
+// when none is given
+const DefaultRepo = "https://dl-cdn.alpinelinux.org/alpine/v3.20/main"
+
+// DefaultFlavor is the kernel flavor booted when none is given
+const DefaultFlavor = "lts"
+
+// Options configure the boot scripts
+type Options struct {
+	// BootURL is the directory holding vmlinuz-<flavor>, initramfs-<flavor>
+	// and modloop-<flavor>, DefaultBootURL if empty
+	BootURL string
+	// Flavor is the kernel flavor, DefaultFlavor if empty
+	Flavor string
+	// Repo is the alpine_repo the booted system installs from, DefaultRepo
+	// if empty
+	Repo string
+	// Console lists the consoles of the kernel, for example ttyS0,115200
+	Console []string
+	// Cmdline holds additional kernel parameters
+	Cmdline []string
+}
+
+// Host is a machine to boot
+type Host struct {
+	Name string
+	// MAC selects the host in the menu and names its per-MAC script, in
+	// canonical form
+	MAC string
+	// Apkovl is the URL of the host's overlay, which installs the system
+	Apkovl string
+	// Answers is the URL of the answer file the overlay installs with
+	// instead of its own, empty to use the one in the overlay
+	Answers string
+}
+
+// MACFile returns the name of the per-MAC script of mac. It is the name
+// ${netX/mac:hexhyp}.ipxe expands to, so a generic script can load it with
+// chain ${netX/mac:hexhyp}.ipxe.
+func MACFile(mac string) string {
+	return strings.ReplaceAll(mac, ":", "-") + ".ipxe"
+}
+
+// Script returns the iPXE script that boots h
+func Script(h Host, opts Options) ([]byte, error) {
+	opts = withDefaults(opts)
+	if err := check(h, opts); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "#!ipxe\n# Generated by alpine-hero for %s.\n\n", h.Name)
+	fmt.Fprintf(&b, "set boot-url %s\n", opts.BootURL)
+	writeBoot(&b, h, opts)
+	return b.Bytes(), nil
+}
+
+// Menu returns an iPXE script that boots the host with the MAC address of
+// the booting interface, and offers a menu of every host otherwise
+func Menu(hosts []Host, opts Options) ([]byte, error) {
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("menu has no hosts")
+	}
+	opts = withDefaults(opts)
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		if err := check(h, opts); err != nil {
+			return nil, err
+		}
+		if seen[h.Name] {
+			return nil, fmt.Errorf("duplicate host %s", h.Name)
+		}
+		seen[h.Name] = true
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "#!ipxe\n# Generated by alpine-hero.\n\n")
+	fmt.Fprintf(&b, "set boot-url %s\n", opts.BootURL)
+	for _, h := range hosts {
+		if h.MAC != "" {
+			fmt.Fprintf(&b, "iseq ${netX/mac} %s && goto %s ||\n", h.MAC, h.Name)
+		}
+	}
+	fmt.Fprintf(&b, "\nmenu Install Alpine Linux\n")
+	for _, h := range hosts {
+		label := h.Name
+		if h.MAC != "" {
+			label += " (" + h.MAC + ")"
+		}
+		fmt.Fprintf(&b, "item %s %s\n", h.Name, label)
+	}
+	fmt.Fprintf(&b, "choose host || exit\ngoto ${host}\n")
+	for _, h := range hosts {
+		fmt.Fprintf(&b, "\n:%s\n", h.Name)
+		writeBoot(&b, h, opts)
+	}
+	return b.Bytes(), nil
+}
+
+// writeBoot writes the commands that boot h from ${boot-url}
+func writeBoot(b *bytes.Buffer, h Host, opts Options) {
+	params := []string{
+		"initrd=initramfs-" + opts.Flavor,
+		"ip=dhcp",
+		"modules=loop,squashfs",
+		"alpine_repo=" + opts.Repo,
+		"modloop=${boot-url}/modloop-" + opts.Flavor,
+	}
+	if h.Apkovl != "" {
+		params = append(params, "apkovl="+h.Apkovl)
+	}
+	if h.Answers != "" {
+		params = append(params, apkovl.AnswersParam+"="+h.Answers)
+	}
+	for _, c := range opts.Console {
+		params = append(params, "console="+c)
+	}
+	params = append(params, opts.Cmdline...)
+
+	fmt.Fprintf(b, "kernel ${boot-url}/vmlinuz-%s %s\n", opts.Flavor, strings.Join(params, " "))
+	fmt.Fprintf(b, "initrd ${boot-url}/initramfs-%s\n", opts.Flavor)
+	fmt.Fprintf(b, "boot\n")
+}
+
+func withDefaults(opts Options) Options {
+	if opts.BootURL == "" {
+		opts.BootURL = DefaultBootURL
+	}
+	opts.BootURL = strings.TrimSuffix(opts.BootURL, "/")
+	if opts.Flavor == "" {
+		opts.Flavor = DefaultFlavor
+	}
+	if opts.Repo == "" {
+		opts.Repo = DefaultRepo
+	}
+	return opts
+}
+
+// check rejects values that would break the script: iPXE splits commands at
+// whitespace and expands ${...} settings
+func check(h Host, opts Options) error {
+	if h.Name == "" {
+		return fmt.Errorf("a host has no name")
+	}
+	type field struct{ name, value string }
+	values := []field{
+		{"host name", h.Name},
+		{"mac", h.MAC},
+		{"apkovl URL", h.Apkovl},
+		{"answer file URL", h.Answers},
+		{"boot URL", opts.BootURL},
+		{"flavor", opts.Flavor},
+		{"repository", opts.Repo},
+	}
+	for _, c := range opts.Console {
+		if c == "" {
+			return fmt.Errorf("console cannot be empty")
+		}
+		values = append(values, field{"console", c})
+	}
+	for _, p := range opts.Cmdline {
+		if p == "" {
+			return fmt.Errorf("kernel parameter cannot be empty")
+		}
+		values = append(values, field{"kernel parameter", p})
+	}
+	for _, v := range values {
+		if strings.ContainsAny(v.value, " \t\r\n$") {
+			return fmt.Errorf("invalid %s %q, it cannot contain whitespace or $", v.name, v.value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package ipxe
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	h := Host{
+		Name:    "pi-kitchen",
+		MAC:     "52:54:00:ab:cd:ef",
+		Apkovl:  "http://10.0.0.1:8080/apkovl/pi-kitchen.apkovl.tar.gz",
+		Answers: "http://10.0.0.1:8080/answers/pi-kitchen?token=abc",
+	}
+	opts := Options{
+		BootURL: "http://10.0.0.1/netboot/",
+		Flavor:  "virt",
+		Console: []string{"tty0", "ttyS0,115200"},
+		Cmdline: []string{"quiet"},
+	}
+
+	data, err := Script(h, opts)
+	if err != nil {
+		t.Fatalf("Script() error = %v", err)
+	}
+	want := `#!ipxe
+# Generated by alpine-hero for pi-kitchen.
+
+set boot-url http://10.0.0.1/netboot
+kernel ${boot-url}/vmlinuz-virt initrd=initramfs-virt ip=dhcp modules=loop,squashfs alpine_repo=` + DefaultRepo + ` modloop=${boot-url}/modloop-virt apkovl=http://10.0.0.1:8080/apkovl/pi-kitchen.apkovl.tar.gz alpine_hero_answers=http://10.0.0.1:8080/answers/pi-kitchen?token=abc console=tty0 console=ttyS0,115200 quiet
+initrd ${boot-url}/initramfs-virt
+boot
+`
+	if string(data) != want {
+		t.Errorf("Script() =\n%s\nwant\n%s", data, want)
+	}
+
+	// without an answer file URL the overlay installs with its own
+	h.Answers = ""
+	data, err = Script(h, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"set boot-url " + DefaultBootURL + "\n", "vmlinuz-lts ", "initramfs-lts\n"} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("Script() missing %q\n%s", s, data)
+		}
+	}
+	if strings.Contains(string(data), "alpine_hero_answers") || strings.Contains(string(data), "console=") {
+		t.Errorf("Script() has parameters that were not asked for\n%s", data)
+	}
+}
+
+func TestMenu(t *testing.T) {
+	hosts := []Host{
+		{Name: "pi-kitchen", MAC: "52:54:00:ab:cd:ef", Apkovl: "http://10.0.0.1/pi-kitchen.apkovl.tar.gz"},
+		{Name: "pi-garage", Apkovl: "http://10.0.0.1/pi-garage.apkovl.tar.gz"},
+	}
+	data, err := Menu(hosts, Options{})
+	if err != nil {
+		t.Fatalf("Menu() error = %v", err)
+	}
+	script := string(data)
+	for _, s := range []string{
+		"#!ipxe\n",
+		"iseq ${netX/mac} 52:54:00:ab:cd:ef && goto pi-kitchen ||\n",
+		"item pi-kitchen pi-kitchen (52:54:00:ab:cd:ef)\n",
+		"item pi-garage pi-garage\n",
+		"choose host || exit\ngoto ${host}\n",
+		"\n:pi-garage\nkernel ${boot-url}/vmlinuz-lts ",
+		"apkovl=http://10.0.0.1/pi-garage.apkovl.tar.gz",
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("Menu() missing %q\n%s", s, script)
+		}
+	}
+	if strings.Count(script, "iseq ") != 1 || strings.Count(script, "\nboot\n") != 2 {
+		t.Errorf("Menu() =\n%s\nwant one MAC check and two boot entries", script)
+	}
+	// every goto has its label
+	for _, h := range hosts {
+		if !strings.Contains(script, "\n:"+h.Name+"\n") {
+			t.Errorf("Menu() has no label for %s", h.Name)
+		}
+	}
+}
+
+func TestMACFile(t *testing.T) {
+	if got := MACFile("52:54:00:ab:cd:ef"); got != "52-54-00-ab-cd-ef.ipxe" {
+		t.Errorf("MACFile() = %s", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	good := Host{Name: "a", Apkovl: "http://10.0.0.1/a.apkovl.tar.gz"}
+	tests := []struct {
+		name    string
+		hosts   []Host
+		opts    Options
+		wantErr string
+	}{
+		{name: "no hosts", wantErr: "menu has no hosts"},
+		{name: "no name", hosts: []Host{{}}, wantErr: "a host has no name"},
+		{name: "duplicate host", hosts: []Host{good, good}, wantErr: "duplicate host a"},
+		{name: "space in URL", hosts: []Host{{Name: "a", Apkovl: "http://h/a b"}}, wantErr: `invalid apkovl URL "http://h/a b"`},
+		{name: "expansion in repo", hosts: []Host{good}, opts: Options{Repo: "http://${next-server}/main"}, wantErr: "invalid repository"},
+		{name: "empty console", hosts: []Host{good}, opts: Options{Console: []string{""}}, wantErr: "console cannot be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Menu(tt.hosts, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Menu() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
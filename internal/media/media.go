@@ -0,0 +1,186 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+// Names of the files alpine-hero writes to the root of the boot media
+const (
+	UserConfig = "usercfg.txt"
+	Cmdline    = "cmdline.txt"
+	Answers    = "answers.txt"
+)
+
+// Markers around the block of usercfg.txt that alpine-hero manages
+const (
+	beginMarker = "# BEGIN alpine-hero"
+	endMarker   = "# END alpine-hero"
+)
+
+// File is a file to write to the root of the boot media
+type File struct {
+	Name string
+	Data []byte
+	// Merged is set for files merged with the one on the media, which keep
+	// what was there and can be rewritten without asking
+	Merged bool
+}
+
+// Files returns the files to write to the boot media mounted at dir: the
+// answer file, the overlay if there is one, and usercfg.txt and cmdline.txt
+// merged with what is already on the media. overlay may be nil.
+func Files(dir string, cfg *config.Config, answers, overlay []byte) ([]File, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open boot media: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("boot media %s is not a directory", dir)
+	}
+
+	files := []File{{Name: Answers, Data: answers}}
+
+	if overlay != nil {
+		name := cfg.Hostname + ".apkovl.tar.gz"
+		// the Alpine initramfs ignores every overlay if it finds more than one
+		others, err := filepath.Glob(filepath.Join(dir, "*.apkovl.tar.gz"))
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range others {
+			if filepath.Base(other) != name {
+				return nil, fmt.Errorf("boot media already has the overlay %s, remove it first: Alpine ignores all overlays when it finds more than one", filepath.Base(other))
+			}
+		}
+		files = append(files, File{Name: name, Data: overlay})
+	}
+
+	existing, err := readOptional(filepath.Join(dir, UserConfig))
+	if err != nil {
+		return nil, err
+	}
+	if data := MergeUserConfig(existing, cfg.Pi); data != nil {
+		files = append(files, File{Name: UserConfig, Data: data, Merged: true})
+	}
+
+	if len(cfg.Pi.Cmdline) > 0 {
+		existing, err := readOptional(filepath.Join(dir, Cmdline))
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			return nil, fmt.Errorf("%s not found in %s, unpack the Alpine tarball onto the boot media first", Cmdline, dir)
+		}
+		files = append(files, File{Name: Cmdline, Data: MergeCmdline(existing, cfg.Pi.Cmdline), Merged: true})
+	}
+	return files, nil
+}
+
+// readOptional reads a file that may not exist, returning nil if it does not
+func readOptional(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	return data, nil
+}
+
+// MergeUserConfig returns usercfg.txt with the settings of pi in a block
+// between marker comments. An existing block is replaced and everything
+// outside it is kept. The block is placed at the end under an [all] filter
+// so its settings win over earlier lines for every model. It returns nil if
+// there is nothing to write: no settings and no existing block.
+func MergeUserConfig(existing []byte, pi config.PiConfig) []byte {
+	var block []string
+	if pi.EnableUART {
+		block = append(block, "enable_uart=1")
+	}
+	if pi.GPUMem != 0 {
+		block = append(block, fmt.Sprintf("gpu_mem=%d", pi.GPUMem))
+	}
+	for _, o := range pi.DTOverlays {
+		block = append(block, "dtoverlay="+o)
+	}
+	for _, p := range pi.DTParams {
+		block = append(block, "dtparam="+p)
+	}
+
+	var kept []string
+	found := false
+	inBlock := false
+	for _, line := range splitLines(string(existing)) {
+		switch {
+		case strings.TrimSpace(line) == beginMarker:
+			inBlock, found = true, true
+		case strings.TrimSpace(line) == endMarker:
+			inBlock = false
+		case !inBlock:
+			kept = append(kept, line)
+		}
+	}
+	if len(block) == 0 && !found {
+		return nil
+	}
+
+	// drop blank lines left at the end by a removed block
+	for len(kept) > 0 && strings.TrimSpace(kept[len(kept)-1]) == "" {
+		kept = kept[:len(kept)-1]
+	}
+	if len(block) > 0 {
+		if len(kept) > 0 {
+			kept = append(kept, "")
+		}
+		kept = append(kept, beginMarker, "[all]")
+		kept = append(kept, block...)
+		kept = append(kept, endMarker)
+	}
+	if len(kept) == 0 {
+		return []byte{}
+	}
+	return []byte(strings.Join(kept, "\n") + "\n")
+}
+
+// MergeCmdline adds params to the single line kernel command line in
+// existing. A parameter replaces an existing one with the same name, except
+// console= which may be given several times and is only added if the exact
+// value is missing.
+func MergeCmdline(existing []byte, params []string) []byte {
+	fields := strings.Fields(string(existing))
+	for _, p := range params {
+		name, _, _ := strings.Cut(p, "=")
+		replaced := false
+		for i, f := range fields {
+			if f == p {
+				replaced = true
+				break
+			}
+			if fname, _, _ := strings.Cut(f, "="); fname == name && name != "console" {
+				fields[i] = p
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			fields = append(fields, p)
+		}
+	}
+	return []byte(strings.Join(fields, " ") + "\n")
+}
+
+// splitLines splits s into lines without their line endings
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,159 @@
+package media
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+func TestMergeUserConfig(t *testing.T) {
+	pi := config.PiConfig{
+		EnableUART: true,
+		GPUMem:     16,
+		DTOverlays: []string{"disable-bt"},
+		DTParams:   []string{"audio=on"},
+	}
+	block := "# BEGIN alpine-hero\n[all]\nenable_uart=1\ngpu_mem=16\ndtoverlay=disable-bt\ndtparam=audio=on\n# END alpine-hero\n"
+
+	tests := []struct {
+		name     string
+		existing string
+		pi       config.PiConfig
+		want     string
+		wantNil  bool
+	}{
+		{name: "new file", pi: pi, want: block},
+		{
+			name:     "user settings are kept",
+			existing: "# my settings\n[pi4]\narm_boost=1\n",
+			pi:       pi,
+			want:     "# my settings\n[pi4]\narm_boost=1\n\n" + block,
+		},
+		{
+			name:     "existing block is replaced",
+			existing: "hdmi_safe=1\n\n# BEGIN alpine-hero\n[all]\ngpu_mem=64\n# END alpine-hero\n",
+			pi:       config.PiConfig{GPUMem: 128},
+			want:     "hdmi_safe=1\n\n# BEGIN alpine-hero\n[all]\ngpu_mem=128\n# END alpine-hero\n",
+		},
+		{
+			name:     "settings after the block stay",
+			existing: "# BEGIN alpine-hero\n[all]\ngpu_mem=64\n# END alpine-hero\nhdmi_safe=1\r\n",
+			pi:       config.PiConfig{GPUMem: 64},
+			want:     "hdmi_safe=1\n\n# BEGIN alpine-hero\n[all]\ngpu_mem=64\n# END alpine-hero\n",
+		},
+		{
+			name:     "block is removed when there are no settings",
+			existing: "hdmi_safe=1\n\n# BEGIN alpine-hero\n[all]\ngpu_mem=64\n# END alpine-hero\n",
+			want:     "hdmi_safe=1\n",
+		},
+		{name: "nothing to write", existing: "hdmi_safe=1\n", wantNil: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergeUserConfig([]byte(tt.existing), tt.pi)
+			if tt.wantNil {
+				if got != nil {
+					t.Errorf("MergeUserConfig() = %q, want nil", got)
+				}
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("MergeUserConfig() =\n%s\nwant\n%s", got, tt.want)
+			}
+			// a second run changes nothing, or has nothing to write
+			if again := MergeUserConfig(got, tt.pi); again != nil && string(again) != string(got) {
+				t.Errorf("MergeUserConfig() is not idempotent:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestMergeCmdline(t *testing.T) {
+	base := "modules=loop,squashfs,sd-mod,usb-storage quiet console=tty1\n"
+	tests := []struct {
+		name   string
+		params []string
+		want   string
+	}{
+		{name: "added", params: []string{"cgroup_enable=memory"}, want: "modules=loop,squashfs,sd-mod,usb-storage quiet console=tty1 cgroup_enable=memory\n"},
+		{name: "replaced by name", params: []string{"modules=loop,squashfs"}, want: "modules=loop,squashfs quiet console=tty1\n"},
+		{name: "flag already present", params: []string{"quiet"}, want: base},
+		{name: "consoles add up", params: []string{"console=serial0,115200", "console=tty1"}, want: "modules=loop,squashfs,sd-mod,usb-storage quiet console=tty1 console=serial0,115200\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergeCmdline([]byte(base), tt.params)
+			if string(got) != tt.want {
+				t.Errorf("MergeCmdline() = %q, want %q", got, tt.want)
+			}
+			if again := MergeCmdline(got, tt.params); string(again) != string(got) {
+				t.Errorf("MergeCmdline() is not idempotent: %q", again)
+			}
+		})
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, Cmdline), []byte("modules=loop quiet\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.New()
+	cfg.Hostname = "pi-kitchen"
+	cfg.Pi = config.PiConfig{EnableUART: true, Cmdline: []string{"console=serial0,115200"}}
+
+	files, err := Files(dir, cfg, []byte("answers"), []byte("overlay"))
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	got := make(map[string]string)
+	var names []string
+	for _, f := range files {
+		got[f.Name] = string(f.Data)
+		names = append(names, f.Name)
+		if merged := f.Name == UserConfig || f.Name == Cmdline; f.Merged != merged {
+			t.Errorf("%s Merged = %v, want %v", f.Name, f.Merged, merged)
+		}
+	}
+	if strings.Join(names, " ") != "answers.txt pi-kitchen.apkovl.tar.gz usercfg.txt cmdline.txt" {
+		t.Errorf("Files() = %v", names)
+	}
+	if got[Cmdline] != "modules=loop quiet console=serial0,115200\n" || !strings.Contains(got[UserConfig], "enable_uart=1") {
+		t.Errorf("Files() cmdline = %q, usercfg = %q", got[Cmdline], got[UserConfig])
+	}
+
+	// without pi settings only the answer file is written
+	files, err = Files(dir, config.New(), []byte("answers"), nil)
+	if err != nil || len(files) != 1 || files[0].Name != Answers {
+		t.Errorf("Files() without pi settings = %v, %v", files, err)
+	}
+}
+
+func TestFiles_Errors(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.New()
+	cfg.Pi.Cmdline = []string{"quiet"}
+
+	_, err := Files(dir, cfg, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "unpack the Alpine tarball") {
+		t.Errorf("Files() error = %v, want the missing cmdline.txt reported", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "old-host.apkovl.tar.gz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Files(dir, config.New(), nil, []byte("overlay"))
+	if err == nil || !strings.Contains(err.Error(), "already has the overlay old-host.apkovl.tar.gz") {
+		t.Errorf("Files() error = %v, want the other overlay reported", err)
+	}
+
+	_, err = Files(filepath.Join(dir, "missing"), config.New(), nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to open boot media") {
+		t.Errorf("Files() error = %v, want the missing media reported", err)
+	}
+}
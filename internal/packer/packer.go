@@ -0,0 +1,221 @@
+package packer
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/generator"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// TemplateFile is the name of the Packer template in the build directory
+const TemplateFile = "alpine.pkr.hcl"
+
+// HTTPDir is the directory Packer serves to the machine during the build
+const HTTPDir = "http"
+
+// AnswersFile is the answer file in HTTPDir that the boot command fetches
+const AnswersFile = "answers.txt"
+
+// DefaultISOURL is the Alpine virt ISO the machine boots when none is given
+const DefaultISOURL = "https://dl-cdn.alpinelinux.org/alpine/v3.20/releases/x86_64/alpine-virt-3.20.3-x86_64.iso"
+
+// Defaults of the machine for settings left empty in config.VMConfig
+const (
+	DefaultDiskSize = "8G"
+	DefaultMemory   = 1024
+	DefaultCPUs     = 1
+)
+
+// header is the first line of the template
+const header = "# Generated by alpine-hero from the same settings as the answer file.\n"
+
+// Options configure the template
+type Options struct {
+	// ISOURL is the install ISO, DefaultISOURL if empty
+	ISOURL string
+	// ISOChecksum is the checksum of the ISO in a form Packer accepts. If
+	// empty the checksum file published next to the ISO is used.
+	ISOChecksum string
+	// Headless runs the machine without a display
+	Headless bool
+}
+
+// File is a file of the build directory, with a slash separated path
+// relative to the directory
+type File struct {
+	Path string
+	Data []byte
+}
+
+// Files returns the Packer template for cfg and the answer file it serves
+func Files(cfg *config.Config, answers []byte, opts Options) ([]File, error) {
+	tmpl, err := Template(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []File{
+		{Path: TemplateFile, Data: tmpl},
+		{Path: path.Join(HTTPDir, AnswersFile), Data: answers},
+	}, nil
+}
+
+// Template returns a Packer template building a qcow2 image of cfg with the
+// qemu builder. The machine boots the ISO, fetches the answer file from the
+// Packer HTTP server and runs setup-alpine with it, and Packer connects to
+// the installed system over SSH as the configured user. The password is not
+// written to the template, it is passed to Packer as the ssh_password
+// variable.
+func Template(cfg *config.Config, opts Options) ([]byte, error) {
+	diskInterface, err := DiskInterface(cfg.DiskDevice)
+	if err != nil {
+		return nil, err
+	}
+	bootCommand, err := BootCommand(cfg)
+	if err != nil {
+		return nil, err
+	}
+	isoURL := opts.ISOURL
+	if isoURL == "" {
+		isoURL = DefaultISOURL
+	}
+	isoChecksum := opts.ISOChecksum
+	if isoChecksum == "" {
+		isoChecksum = "file:" + isoURL + ".sha256"
+	}
+	diskSize := cfg.VM.DiskSize
+	if diskSize == "" {
+		diskSize = DefaultDiskSize
+	}
+	memory := cfg.VM.Memory
+	if memory == 0 {
+		memory = DefaultMemory
+	}
+	cpus := cfg.VM.CPUs
+	if cpus == 0 {
+		cpus = DefaultCPUs
+	}
+
+	f := hclwrite.NewEmptyFile()
+	root := f.Body()
+
+	plugins := root.AppendNewBlock("packer", nil).Body().AppendNewBlock("required_plugins", nil).Body()
+	plugins.SetAttributeValue("qemu", cty.ObjectVal(map[string]cty.Value{
+		"version": cty.StringVal(">= 1.1.0"),
+		"source":  cty.StringVal("github.com/hashicorp/qemu"),
+	}))
+
+	for _, v := range []struct {
+		name      string
+		value     string
+		sensitive bool
+	}{
+		{"iso_url", isoURL, false},
+		{"iso_checksum", isoChecksum, false},
+		{"ssh_password", "", true},
+	} {
+		root.AppendNewline()
+		body := root.AppendNewBlock("variable", []string{v.name}).Body()
+		body.SetAttributeRaw("type", hclwrite.TokensForIdentifier("string"))
+		// sensitive variables have no default, so the template never holds
+		// the password and Packer asks for it with -var or PKR_VAR_
+		if v.sensitive {
+			body.SetAttributeValue("sensitive", cty.True)
+		} else {
+			body.SetAttributeValue("default", cty.StringVal(v.value))
+		}
+	}
+
+	root.AppendNewline()
+	src := root.AppendNewBlock("source", []string{"qemu", "alpine"}).Body()
+	src.SetAttributeTraversal("iso_url", variable("iso_url"))
+	src.SetAttributeTraversal("iso_checksum", variable("iso_checksum"))
+	src.SetAttributeValue("vm_name", cty.StringVal(cfg.Hostname+".qcow2"))
+	src.SetAttributeValue("output_directory", cty.StringVal("output-"+cfg.Hostname))
+	src.SetAttributeValue("format", cty.StringVal("qcow2"))
+	src.SetAttributeValue("disk_size", cty.StringVal(diskSize))
+	src.SetAttributeValue("disk_interface", cty.StringVal(diskInterface))
+	src.SetAttributeValue("net_device", cty.StringVal("virtio-net"))
+	src.SetAttributeValue("memory", cty.NumberIntVal(int64(memory)))
+	src.SetAttributeValue("cpus", cty.NumberIntVal(int64(cpus)))
+	src.SetAttributeValue("headless", cty.BoolVal(opts.Headless))
+	src.SetAttributeValue("http_directory", cty.StringVal(HTTPDir))
+	src.SetAttributeValue("boot_wait", cty.StringVal("20s"))
+	src.SetAttributeRaw("boot_command", lines(bootCommand))
+	src.SetAttributeValue("ssh_username", cty.StringVal(cfg.Username))
+	src.SetAttributeTraversal("ssh_password", variable("ssh_password"))
+	src.SetAttributeValue("ssh_timeout", cty.StringVal("20m"))
+
+	root.AppendNewline()
+	build := root.AppendNewBlock("build", nil).Body()
+	build.SetAttributeValue("sources", stringList([]string{"source.qemu.alpine"}))
+
+	return append([]byte(header), hclwrite.Format(f.Bytes())...), nil
+}
+
+// BootCommand returns the keystrokes typed into the booted ISO: log in as
+// root, bring up the network, fetch the answer file from the Packer HTTP
+// server, install with it and reboot into the installed system
+func BootCommand(cfg *config.Config) ([]string, error) {
+	iface, err := generator.Quote(cfg.NetworkIface)
+	if err != nil {
+		return nil, fmt.Errorf("failed to quote interface: %w", err)
+	}
+	disk, err := generator.Quote(cfg.DiskDevice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to quote disk: %w", err)
+	}
+	return []string{
+		"root<enter><wait5>",
+		fmt.Sprintf("ip link set %s up && udhcpc -i %s -q<enter><wait10>", iface, iface),
+		"wget -q -O /tmp/" + AnswersFile + " http://{{ .HTTPIP }}:{{ .HTTPPort }}/" + AnswersFile + "<enter><wait5>",
+		fmt.Sprintf("ERASE_DISKS=%s setup-alpine -e -f /tmp/%s && reboot<enter>", disk, AnswersFile),
+	}, nil
+}
+
+// DiskInterface returns the qemu disk interface that makes the disk appear
+// as device in the machine
+func DiskInterface(device string) (string, error) {
+	switch {
+	case strings.HasPrefix(device, "/dev/vd"):
+		return "virtio", nil
+	case strings.HasPrefix(device, "/dev/sd"):
+		return "virtio-scsi", nil
+	}
+	return "", fmt.Errorf("disk %s cannot be attached by the qemu builder, use a virtio disk such as /dev/vda or a SCSI disk such as /dev/sda", device)
+}
+
+// variable returns the traversal var.name
+func variable(name string) hcl.Traversal {
+	return hcl.Traversal{hcl.TraverseRoot{Name: "var"}, hcl.TraverseAttr{Name: name}}
+}
+
+// lines returns the tokens of a list of strings with one element per line,
+// which keeps long lists such as the boot command readable
+func lines(list []string) hclwrite.Tokens {
+	tokens := hclwrite.Tokens{
+		{Type: hclsyntax.TokenOBrack, Bytes: []byte("[")},
+		{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")},
+	}
+	for _, s := range list {
+		tokens = append(tokens, hclwrite.TokensForValue(cty.StringVal(s))...)
+		tokens = append(tokens,
+			&hclwrite.Token{Type: hclsyntax.TokenComma, Bytes: []byte(",")},
+			&hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")},
+		)
+	}
+	return append(tokens, &hclwrite.Token{Type: hclsyntax.TokenCBrack, Bytes: []byte("]")})
+}
+
+func stringList(list []string) cty.Value {
+	values := make([]cty.Value, len(list))
+	for i, s := range list {
+		values[i] = cty.StringVal(s)
+	}
+	return cty.ListVal(values)
+}
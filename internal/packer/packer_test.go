@@ -0,0 +1,144 @@
+package packer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestTemplate(t *testing.T) {
+	cfg := config.New()
+	cfg.Hostname = "golden"
+	cfg.Username = "builder"
+	cfg.Password = "s3cret-builder"
+	cfg.DiskDevice = "/dev/vda"
+	cfg.VM = config.VMConfig{DiskSize: "20G", CPUs: 2}
+
+	data, err := Template(cfg, Options{Headless: true})
+	if err != nil {
+		t.Fatalf("Template() error = %v", err)
+	}
+	if !strings.HasPrefix(string(data), header) {
+		t.Errorf("Template() does not start with the header:\n%s", data)
+	}
+
+	file, diags := hclsyntax.ParseConfig(data, TemplateFile, hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("template does not parse: %v\n%s", diags, data)
+	}
+	body := file.Body.(*hclsyntax.Body)
+
+	var types []string
+	var source *hclsyntax.Body
+	variables := make(map[string]*hclsyntax.Body)
+	for _, block := range body.Blocks {
+		types = append(types, strings.Join(append([]string{block.Type}, block.Labels...), "."))
+		switch block.Type {
+		case "source":
+			source = block.Body
+		case "variable":
+			variables[block.Labels[0]] = block.Body
+		}
+	}
+	if got := strings.Join(types, " "); got != "packer variable.iso_url variable.iso_checksum variable.ssh_password source.qemu.alpine build" {
+		t.Fatalf("blocks = %s", got)
+	}
+
+	for name, want := range map[string]string{
+		"vm_name":        "golden.qcow2",
+		"disk_size":      "20G",
+		"disk_interface": "virtio",
+		"ssh_username":   "builder",
+		"http_directory": HTTPDir,
+	} {
+		if got := stringAttr(t, source, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	for name, want := range map[string]string{"memory": "1024", "cpus": "2"} {
+		v, diags := source.Attributes[name].Expr.Value(nil)
+		if diags.HasErrors() || v.AsBigFloat().String() != want {
+			t.Errorf("%s = %v, want %s", name, v, want)
+		}
+	}
+	vars := source.Attributes["ssh_password"].Expr.Variables()
+	if len(vars) != 1 || vars[0].RootName() != "var" || vars[0][1].(hcl.TraverseAttr).Name != "ssh_password" {
+		t.Errorf("ssh_password does not reference var.ssh_password")
+	}
+
+	// the password is sensitive and never written to the template
+	if _, ok := variables["ssh_password"].Attributes["default"]; ok {
+		t.Error("ssh_password has a default, want it passed with -var")
+	}
+	if strings.Contains(string(data), cfg.Password) {
+		t.Errorf("template contains the password:\n%s", data)
+	}
+	if _, ok := variables["ssh_password"].Attributes["sensitive"]; !ok {
+		t.Error("ssh_password is not sensitive")
+	}
+	if got := stringAttr(t, variables["iso_checksum"], "default"); got != "file:"+DefaultISOURL+".sha256" {
+		t.Errorf("iso_checksum default = %q", got)
+	}
+
+	v, diags := source.Attributes["boot_command"].Expr.Value(nil)
+	if diags.HasErrors() {
+		t.Fatalf("boot_command: %v", diags)
+	}
+	var boot []string
+	for _, line := range v.AsValueSlice() {
+		boot = append(boot, line.AsString())
+	}
+	want, err := BootCommand(cfg)
+	if err != nil {
+		t.Fatalf("BootCommand() error = %v", err)
+	}
+	if got, want := strings.Join(boot, "\n"), strings.Join(want, "\n"); got != want {
+		t.Errorf("boot_command =\n%s\nwant\n%s", got, want)
+	}
+	last := boot[len(boot)-1]
+	if !strings.Contains(last, "ERASE_DISKS='/dev/vda' setup-alpine -e -f /tmp/answers.txt") {
+		t.Errorf("boot_command does not run setup-alpine with the answer file: %s", last)
+	}
+	if !strings.Contains(boot[2], "http://{{ .HTTPIP }}:{{ .HTTPPort }}/answers.txt") {
+		t.Errorf("boot_command does not fetch the answer file: %s", boot[2])
+	}
+}
+
+func stringAttr(t *testing.T, body *hclsyntax.Body, name string) string {
+	t.Helper()
+	attr, ok := body.Attributes[name]
+	if !ok {
+		t.Fatalf("attribute %s missing", name)
+	}
+	v, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() {
+		t.Fatalf("attribute %s: %v", name, diags)
+	}
+	return v.AsString()
+}
+
+func TestFiles(t *testing.T) {
+	cfg := config.New()
+	cfg.DiskDevice = "/dev/sda"
+
+	files, err := Files(cfg, []byte("answers"), Options{ISOURL: "https://example.com/alpine.iso", ISOChecksum: "none"})
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	if len(files) != 2 || files[0].Path != TemplateFile || files[1].Path != "http/answers.txt" || string(files[1].Data) != "answers" {
+		t.Fatalf("Files() = %v", files)
+	}
+	for _, s := range []string{`"https://example.com/alpine.iso"`, `"none"`, `"virtio-scsi"`, `"8G"`} {
+		if !strings.Contains(string(files[0].Data), s) {
+			t.Errorf("template missing %s\n%s", s, files[0].Data)
+		}
+	}
+
+	cfg.DiskDevice = "/dev/mmcblk0"
+	if _, err := Files(cfg, nil, Options{}); err == nil || !strings.Contains(err.Error(), "cannot be attached by the qemu builder") {
+		t.Errorf("Files() error = %v, want the disk rejected", err)
+	}
+}
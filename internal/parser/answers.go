@@ -0,0 +1,255 @@
+package parser
+
+import (
+	"strings"
+)
+
+// Answers is the structured form of the variables setup-alpine reads from an
+// answer file. Variables that are absent keep their zero value; variables
+// without a structured field are kept verbatim in Other.
+type Answers struct {
+	Keymap     Keymap
+	Hostname   string
+	Interfaces []Interface
+	DNS        DNS
+	Timezone   string
+	User       User
+	Password   string
+	Disk       Disk
+	SSHKey     string
+	Other      map[string]string
+}
+
+// Keymap is the layout and variant passed to setup-keymap
+type Keymap struct {
+	Layout  string
+	Variant string
+}
+
+// Interface is a single stanza of the interfaces(5) snippet in INTERFACESOPTS
+type Interface struct {
+	Name    string
+	Auto    bool
+	Family  string
+	Method  string
+	Options map[string]string
+}
+
+// DNS holds the search domain and nameservers passed to setup-dns
+type DNS struct {
+	Domain      string
+	Nameservers []string
+}
+
+// User holds the options passed to setup-user
+type User struct {
+	Name     string
+	FullName string
+	Groups   []string
+	Admin    bool
+	SSHKey   string
+}
+
+// Disk holds the options passed to setup-disk
+type Disk struct {
+	Mode    string
+	Devices []string
+}
+
+// Answers converts the assignments of the file into their structured form.
+// Values that do not have the expected shape are returned as errors along
+// with everything that could be converted.
+func (f *File) Answers() (*Answers, error) {
+	a := &Answers{Other: make(map[string]string)}
+	var errs ErrorList
+
+	seen := make(map[string]bool)
+	for i := len(f.Assignments) - 1; i >= 0; i-- {
+		v := f.Assignments[i]
+		if seen[v.Name] {
+			continue
+		}
+		seen[v.Name] = true
+
+		switch v.Name {
+		case "KEYMAPOPTS":
+			fields := strings.Fields(v.Value)
+			if len(fields) > 0 && fields[0] != "none" {
+				a.Keymap.Layout = fields[0]
+			}
+			if len(fields) > 1 {
+				a.Keymap.Variant = fields[1]
+			}
+		case "HOSTNAMEOPTS":
+			opts, args := splitOptions(v.Value, "n")
+			switch {
+			case opts["n"] != "":
+				a.Hostname = opts["n"]
+			case len(args) == 1:
+				a.Hostname = args[0]
+			default:
+				errs.add(v.Line, "HOSTNAMEOPTS does not contain a hostname")
+			}
+		case "INTERFACESOPTS":
+			if v.Value == "none" {
+				continue
+			}
+			a.Interfaces = parseInterfaces(v.Value)
+			if primaryInterface(a.Interfaces) == nil {
+				errs.add(v.Line, "INTERFACESOPTS does not configure any interface besides lo")
+			}
+		case "DNSOPTS":
+			opts, args := splitOptions(v.Value, "dn")
+			a.DNS.Domain = opts["d"]
+			if ns := opts["n"]; ns != "" {
+				args = append([]string{ns}, args...)
+			}
+			a.DNS.Nameservers = args
+		case "TIMEZONEOPTS":
+			if v.Value == "none" {
+				continue
+			}
+			opts, args := splitOptions(v.Value, "zp")
+			switch {
+			case opts["z"] != "":
+				a.Timezone = opts["z"]
+			case len(args) == 1:
+				a.Timezone = args[0]
+			}
+		case "DISKOPTS":
+			if v.Value == "none" {
+				continue
+			}
+			opts, args := splitOptions(v.Value, "mksw")
+			if len(args) == 0 {
+				errs.add(v.Line, "DISKOPTS does not name a disk device")
+			}
+			a.Disk = Disk{Mode: opts["m"], Devices: args}
+		case "USEROPTS":
+			if v.Value == "none" {
+				continue
+			}
+			opts, args := splitOptions(v.Value, "fgk")
+			if len(args) != 1 {
+				errs.add(v.Line, "USEROPTS must name exactly one user")
+			} else {
+				a.User.Name = args[0]
+			}
+			if groups := opts["g"]; groups != "" {
+				a.User.Groups = strings.Split(groups, ",")
+			}
+			a.User.FullName = opts["f"]
+			a.User.SSHKey = opts["k"]
+			a.User.Admin = opts["a"] != ""
+		case "PWUSER":
+			a.Password = v.Value
+		case "SSHKEY":
+			a.SSHKey = v.Value
+		default:
+			a.Other[v.Name] = v.Value
+		}
+	}
+
+	// Errors were collected walking backwards; report them in file order
+	for i, j := 0, len(errs)-1; i < j; i, j = i+1, j-1 {
+		errs[i], errs[j] = errs[j], errs[i]
+	}
+	return a, errs.Err()
+}
+
+// splitOptions splits a setup-* option string into getopt-style flags and
+// positional arguments. withArg lists the single-letter flags that consume
+// the following word as their value.
+func splitOptions(s, withArg string) (map[string]string, []string) {
+	opts := make(map[string]string)
+	var args []string
+	fields := strings.Fields(s)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if len(field) < 2 || field[0] != '-' {
+			args = append(args, field)
+			continue
+		}
+		for j := 1; j < len(field); j++ {
+			flag := field[j : j+1]
+			if !strings.Contains(withArg, flag) {
+				opts[flag] = "true"
+				continue
+			}
+			if j+1 < len(field) {
+				opts[flag] = field[j+1:]
+			} else if i+1 < len(fields) {
+				i++
+				opts[flag] = fields[i]
+			}
+			break
+		}
+	}
+	return opts, args
+}
+
+// parseInterfaces reads the stanzas of an interfaces(5) snippet. Option
+// lines are attached to the iface stanza that precedes them.
+func parseInterfaces(s string) []Interface {
+	var ifaces []Interface
+	index := make(map[string]int)
+	get := func(name string) *Interface {
+		i, ok := index[name]
+		if !ok {
+			i = len(ifaces)
+			index[name] = i
+			ifaces = append(ifaces, Interface{Name: name, Options: make(map[string]string)})
+		}
+		return &ifaces[i]
+	}
+
+	current := ""
+	for _, line := range strings.Split(s, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch fields[0] {
+		case "auto", "allow-hotplug":
+			for _, name := range fields[1:] {
+				get(name).Auto = true
+			}
+			current = ""
+		case "iface":
+			if len(fields) < 2 {
+				continue
+			}
+			iface := get(fields[1])
+			if len(fields) > 2 {
+				iface.Family = fields[2]
+			}
+			if len(fields) > 3 {
+				iface.Method = fields[3]
+			}
+			current = fields[1]
+		default:
+			if current != "" {
+				get(current).Options[fields[0]] = strings.Join(fields[1:], " ")
+			}
+		}
+	}
+	return ifaces
+}
+
+// primaryInterface returns the first interface other than lo, preferring one
+// that is brought up automatically
+func primaryInterface(ifaces []Interface) *Interface {
+	var first *Interface
+	for i := range ifaces {
+		if ifaces[i].Name == "lo" {
+			continue
+		}
+		if ifaces[i].Auto {
+			return &ifaces[i]
+		}
+		if first == nil {
+			first = &ifaces[i]
+		}
+	}
+	return first
+}
@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+// knownVariables lists every variable setup-alpine reads from an answer file,
+// plus the ones written by alpine-hero's own template
+var knownVariables = map[string]bool{
+	"KEYMAPOPTS":     true,
+	"HOSTNAMEOPTS":   true,
+	"DEVDOPTS":       true,
+	"INTERFACESOPTS": true,
+	"DNSOPTS":        true,
+	"TIMEZONEOPTS":   true,
+	"PROXYOPTS":      true,
+	"APKREPOSOPTS":   true,
+	"USEROPTS":       true,
+	"USERSSHKEY":     true,
+	"ROOTSSHKEY":     true,
+	"SSHDOPTS":       true,
+	"NTPOPTS":        true,
+	"DISKOPTS":       true,
+	"LBUOPTS":        true,
+	"APKCACHEOPTS":   true,
+	"PWUSER":         true,
+	"SSHKEY":         true,
+}
+
+// KnownVariables returns the names of all known answer file variables in
+// sorted order
+func KnownVariables() []string {
+	names := make([]string, 0, len(knownVariables))
+	for name := range knownVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mandatoryVariables are the variables that carry the fields Config.Validate
+// requires to be set
+var mandatoryVariables = []string{
+	"HOSTNAMEOPTS",
+	"USEROPTS",
+	"PWUSER",
+	"DISKOPTS",
+}
+
+// Check reports unknown variables, repeated assignments and missing
+// mandatory variables
+func (f *File) Check() ErrorList {
+	var errs ErrorList
+	seen := make(map[string]int)
+	for _, a := range f.Assignments {
+		if !knownVariables[a.Name] {
+			errs.add(a.Line, "unknown variable %s", a.Name)
+		}
+		if prev, ok := seen[a.Name]; ok {
+			errs.add(a.Line, "%s is already assigned on line %d", a.Name, prev)
+		}
+		seen[a.Name] = a.Line
+	}
+	for _, name := range mandatoryVariables {
+		if _, ok := seen[name]; !ok {
+			errs.add(0, "missing mandatory variable %s", name)
+		}
+	}
+	return errs
+}
+
+// Config maps the known variables of the file back into a Config. Fields
+// whose variable is absent are left empty so that Config.Validate reports
+// them; values that do not have the expected shape are returned as errors.
+func (f *File) Config() (*config.Config, error) {
+	a, err := f.Answers()
+	return a.Config(), err
+}
+
+// Config converts the structured answers into a Config. Settings that Config
+// has no field for are dropped.
+func (a *Answers) Config() *config.Config {
+	cfg := &config.Config{
+		Hostname: a.Hostname,
+		Username: a.User.Name,
+		Password: a.Password,
+		Timezone: a.Timezone,
+		Keymap:   a.Keymap.Layout,
+		Groups:   a.User.Groups,
+		SSHKey:   a.SSHKey,
+		DNS:      a.DNS.Nameservers,
+	}
+	if iface := primaryInterface(a.Interfaces); iface != nil {
+		cfg.NetworkIface = iface.Name
+		if iface.Method == "static" {
+			cfg.Address = staticAddress(iface.Options)
+			cfg.Gateway = iface.Options["gateway"]
+		}
+	}
+	if len(a.Disk.Devices) > 0 {
+		cfg.DiskDevice = a.Disk.Devices[0]
+	}
+	return cfg
+}
+
+// staticAddress returns the address option of a static interface in CIDR
+// notation, converting an IPv4 netmask option if the address has no prefix
+// length
+func staticAddress(opts map[string]string) string {
+	address := opts["address"]
+	if address == "" || strings.Contains(address, "/") || opts["netmask"] == "" {
+		return address
+	}
+	addr, err := netip.ParseAddr(address)
+	mask, maskErr := netip.ParseAddr(opts["netmask"])
+	if err != nil || maskErr != nil || !addr.Is4() || !mask.Is4() {
+		return address
+	}
+	bits := 0
+	for _, b := range mask.As4() {
+		for ; b&0x80 != 0; b <<= 1 {
+			bits++
+		}
+	}
+	return netip.PrefixFrom(addr, bits).String()
+}
@@ -0,0 +1,337 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Assignment is a single VAR="value" statement read from an answer file
+type Assignment struct {
+	Name  string
+	Value string
+	Line  int
+}
+
+// File is the parsed representation of a setup-alpine answer file
+type File struct {
+	Assignments []Assignment
+}
+
+// Error describes a problem found at a specific line of an answer file
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	return e.Msg
+}
+
+// ErrorList is a list of problems found in an answer file
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Sort orders the list by line number, keeping errors without a line last
+func (l ErrorList) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].Line == 0 || l[j].Line == 0 {
+			return l[j].Line == 0 && l[i].Line != 0
+		}
+		return l[i].Line < l[j].Line
+	})
+}
+
+// Err returns the list as an error, or nil if it is empty
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+func (l *ErrorList) add(line int, format string, args ...interface{}) {
+	*l = append(*l, &Error{Line: line, Msg: fmt.Sprintf(format, args...)})
+}
+
+// Parse reads shell-style VAR="value" assignments from r. Statements that
+// cannot be parsed are reported in the returned ErrorList while the rest of
+// the file is still parsed, so callers can report every problem at once.
+func Parse(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read answer file: %w", err)
+	}
+
+	s := &scanner{src: string(data), line: 1}
+	f := &File{}
+	for {
+		s.skipBlank()
+		if s.eof() {
+			break
+		}
+		if s.peek() == '#' {
+			s.skipLine()
+			continue
+		}
+		if a, ok := s.assignment(); ok {
+			f.Assignments = append(f.Assignments, a)
+		}
+	}
+
+	return f, s.errs.Err()
+}
+
+// Lookup returns the last assignment of name, which is the value the shell
+// would see after sourcing the file
+func (f *File) Lookup(name string) (Assignment, bool) {
+	for i := len(f.Assignments) - 1; i >= 0; i-- {
+		if f.Assignments[i].Name == name {
+			return f.Assignments[i], true
+		}
+	}
+	return Assignment{}, false
+}
+
+type scanner struct {
+	src  string
+	pos  int
+	line int
+	errs ErrorList
+}
+
+func (s *scanner) eof() bool {
+	return s.pos >= len(s.src)
+}
+
+func (s *scanner) peek() byte {
+	return s.src[s.pos]
+}
+
+func (s *scanner) next() byte {
+	c := s.src[s.pos]
+	s.pos++
+	if c == '\n' {
+		s.line++
+	}
+	return c
+}
+
+// skipBlank skips whitespace, newlines and statement separators
+func (s *scanner) skipBlank() {
+	for !s.eof() {
+		switch s.peek() {
+		case ' ', '\t', '\r', '\n', ';':
+			s.next()
+		default:
+			return
+		}
+	}
+}
+
+func (s *scanner) skipLine() {
+	for !s.eof() && s.peek() != '\n' {
+		s.next()
+	}
+}
+
+// assignment parses a single statement, recording an error and skipping the
+// rest of the line when it is not a plain assignment
+func (s *scanner) assignment() (Assignment, bool) {
+	line := s.line
+	if strings.HasPrefix(s.src[s.pos:], "export ") {
+		s.pos += len("export ")
+		for !s.eof() && (s.peek() == ' ' || s.peek() == '\t') {
+			s.next()
+		}
+	}
+
+	start := s.pos
+	for !s.eof() && isNameChar(s.peek(), s.pos == start) {
+		s.next()
+	}
+	name := s.src[start:s.pos]
+	if name == "" || s.eof() || s.peek() != '=' {
+		s.errs.add(line, "expected VAR=value assignment")
+		s.skipLine()
+		return Assignment{}, false
+	}
+	s.next()
+
+	value, ok := s.word()
+	if !ok {
+		s.skipLine()
+		return Assignment{}, false
+	}
+
+	s.trailing()
+	return Assignment{Name: name, Value: value, Line: line}, true
+}
+
+// trailing checks that only whitespace or a comment follows an assignment
+func (s *scanner) trailing() {
+	for !s.eof() {
+		switch s.peek() {
+		case ' ', '\t', '\r':
+			s.next()
+		case '#':
+			s.skipLine()
+			return
+		case '\n', ';':
+			return
+		default:
+			s.errs.add(s.line, "unexpected text after assignment")
+			s.skipLine()
+			return
+		}
+	}
+}
+
+// word reads a shell word made of unquoted, single-quoted and double-quoted
+// parts and returns its value with all quoting removed
+func (s *scanner) word() (string, bool) {
+	var b strings.Builder
+	for !s.eof() {
+		switch c := s.peek(); c {
+		case ' ', '\t', '\r', '\n', ';':
+			return b.String(), true
+		case '\'':
+			if !s.singleQuoted(&b) {
+				return "", false
+			}
+		case '"':
+			if !s.doubleQuoted(&b) {
+				return "", false
+			}
+		case '\\':
+			s.next()
+			if s.eof() {
+				return b.String(), true
+			}
+			if c := s.next(); c != '\n' {
+				b.WriteByte(c)
+			}
+		case '$', '`':
+			if s.expansion() {
+				return "", false
+			}
+			b.WriteByte(s.next())
+		case '|', '&', '<', '>', '(', ')':
+			s.errs.add(s.line, "unquoted shell operator %q in value", c)
+			return "", false
+		default:
+			b.WriteByte(s.next())
+		}
+	}
+	return b.String(), true
+}
+
+func (s *scanner) singleQuoted(b *strings.Builder) bool {
+	line := s.line
+	s.next()
+	for !s.eof() {
+		c := s.next()
+		if c == '\'' {
+			return true
+		}
+		b.WriteByte(c)
+	}
+	s.errs.add(line, "unterminated single quote")
+	return false
+}
+
+func (s *scanner) doubleQuoted(b *strings.Builder) bool {
+	line := s.line
+	s.next()
+	for !s.eof() {
+		switch c := s.peek(); c {
+		case '"':
+			s.next()
+			return true
+		case '\\':
+			s.next()
+			if s.eof() {
+				break
+			}
+			switch e := s.next(); e {
+			case '$', '`', '"', '\\':
+				b.WriteByte(e)
+			case '\n':
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+		case '$', '`':
+			if s.expansion() {
+				s.skipQuoted('"')
+				return false
+			}
+			b.WriteByte(s.next())
+		default:
+			b.WriteByte(s.next())
+		}
+	}
+	s.errs.add(line, "unterminated double quote")
+	return false
+}
+
+// expansion reports whether the '$' or '`' at the current position starts a
+// parameter expansion or command substitution, which a static parser cannot
+// evaluate. A '$' that is not followed by a name is literal in sh.
+func (s *scanner) expansion() bool {
+	c := s.peek()
+	if c == '`' {
+		s.errs.add(s.line, "command substitution is not supported")
+		return true
+	}
+	if s.pos+1 >= len(s.src) {
+		return false
+	}
+	switch n := s.src[s.pos+1]; {
+	case n == '(':
+		s.errs.add(s.line, "command substitution is not supported")
+		return true
+	case n == '{' || isNameChar(n, true) || strings.IndexByte("0123456789@*#?$!-", n) >= 0:
+		s.errs.add(s.line, "variable expansion is not supported")
+		return true
+	}
+	return false
+}
+
+// skipQuoted advances past the closing quote after an error inside a quoted
+// string so that parsing can resume at the next statement
+func (s *scanner) skipQuoted(quote byte) {
+	for !s.eof() {
+		c := s.next()
+		if c == '\\' && !s.eof() {
+			s.next()
+			continue
+		}
+		if c == quote {
+			return
+		}
+	}
+}
+
+func isNameChar(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	}
+	return false
+}
@@ -0,0 +1,278 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+const sampleAnswers = `KEYMAPOPTS="us us"
+HOSTNAMEOPTS="-n test-host"
+INTERFACESOPTS="auto lo
+iface lo inet loopback
+
+auto eth0
+iface eth0 inet dhcp
+"
+TIMEZONEOPTS="-z Europe/London"
+PROXYOPTS="none"
+APKREPOSOPTS="-f"
+SSHDOPTS="-c openssh"
+NTPOPTS="-c chrony"
+DISKOPTS="-m sys /dev/sda"
+USEROPTS="-a -u -g audio,video testuser"
+PWUSER="testpass"
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Assignment
+		errLine int
+		errMsg  string
+	}{
+		{
+			name:  "double quoted value",
+			input: `HOSTNAMEOPTS="-n host"`,
+			want:  []Assignment{{Name: "HOSTNAMEOPTS", Value: "-n host", Line: 1}},
+		},
+		{
+			name:  "single quoted and unquoted parts",
+			input: `PWUSER='it''s'"$"\ ok`,
+			want:  []Assignment{{Name: "PWUSER", Value: "its$ ok", Line: 1}},
+		},
+		{
+			name:  "escapes inside double quotes",
+			input: `PWUSER="a\"b\$c\` + "`" + `d\\e\n"`,
+			want:  []Assignment{{Name: "PWUSER", Value: "a\"b$c`d\\e\\n", Line: 1}},
+		},
+		{
+			name:  "comments, blank lines and export",
+			input: "# comment\n\nexport KEYMAPOPTS=\"us us\" # trailing\nNTPOPTS=none",
+			want: []Assignment{
+				{Name: "KEYMAPOPTS", Value: "us us", Line: 3},
+				{Name: "NTPOPTS", Value: "none", Line: 4},
+			},
+		},
+		{
+			name:  "multi-line value keeps line of assignment",
+			input: "INTERFACESOPTS=\"auto lo\niface lo inet loopback\n\"\nPWUSER=x",
+			want: []Assignment{
+				{Name: "INTERFACESOPTS", Value: "auto lo\niface lo inet loopback\n", Line: 1},
+				{Name: "PWUSER", Value: "x", Line: 4},
+			},
+		},
+		{
+			name:    "unterminated double quote",
+			input:   "KEYMAPOPTS=\"us us\"\nPWUSER=\"secret\nNTPOPTS=none",
+			want:    []Assignment{{Name: "KEYMAPOPTS", Value: "us us", Line: 1}},
+			errLine: 2,
+			errMsg:  "unterminated double quote",
+		},
+		{
+			name:    "unterminated single quote",
+			input:   "PWUSER='secret",
+			errLine: 1,
+			errMsg:  "unterminated single quote",
+		},
+		{
+			name:    "variable expansion",
+			input:   "PWUSER=\"$HOME\"\nNTPOPTS=none",
+			want:    []Assignment{{Name: "NTPOPTS", Value: "none", Line: 2}},
+			errLine: 1,
+			errMsg:  "variable expansion is not supported",
+		},
+		{
+			name:    "command substitution",
+			input:   "PWUSER=\"`id`\"",
+			errLine: 1,
+			errMsg:  "command substitution is not supported",
+		},
+		{
+			name:    "not an assignment",
+			input:   "KEYMAPOPTS=us\nsetup-alpine -f answers\nNTPOPTS=none",
+			want:    []Assignment{{Name: "KEYMAPOPTS", Value: "us", Line: 1}, {Name: "NTPOPTS", Value: "none", Line: 3}},
+			errLine: 2,
+			errMsg:  "expected VAR=value assignment",
+		},
+		{
+			name:    "text after value",
+			input:   `PWUSER="a" b`,
+			want:    []Assignment{{Name: "PWUSER", Value: "a", Line: 1}},
+			errLine: 1,
+			errMsg:  "unexpected text after assignment",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(strings.NewReader(tt.input))
+			if tt.errMsg == "" && err != nil {
+				t.Fatalf("Parse() unexpected error = %v", err)
+			}
+			if tt.errMsg != "" {
+				var list ErrorList
+				if !errors.As(err, &list) || len(list) == 0 {
+					t.Fatalf("Parse() error = %v, want ErrorList", err)
+				}
+				if list[0].Line != tt.errLine || !strings.Contains(list[0].Msg, tt.errMsg) {
+					t.Errorf("Parse() error = %v, want line %d containing %q", list[0], tt.errLine, tt.errMsg)
+				}
+			}
+			if !reflect.DeepEqual(f.Assignments, tt.want) {
+				t.Errorf("Parse() assignments = %+v, want %+v", f.Assignments, tt.want)
+			}
+		})
+	}
+}
+
+func TestFile_Check(t *testing.T) {
+	input := "HOSTNAMEOPTS=\"-n a\"\nFOO=bar\nHOSTNAMEOPTS=\"-n b\"\nPWUSER=x\n"
+	f, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := f.Check()
+	got.Sort()
+	want := []string{
+		"line 2: unknown variable FOO",
+		"line 3: HOSTNAMEOPTS is already assigned on line 1",
+		"missing mandatory variable USEROPTS",
+		"missing mandatory variable DISKOPTS",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Check() returned %d errors, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].Error() != want[i] {
+			t.Errorf("Check()[%d] = %q, want %q", i, got[i].Error(), want[i])
+		}
+	}
+}
+
+func TestFile_Config(t *testing.T) {
+	f, err := Parse(strings.NewReader(sampleAnswers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := f.Check(); len(errs) > 0 {
+		t.Fatalf("Check() = %v", errs)
+	}
+
+	cfg, err := f.Config()
+	if err != nil {
+		t.Fatalf("Config() error = %v", err)
+	}
+
+	want := &config.Config{
+		Hostname:     "test-host",
+		Username:     "testuser",
+		Password:     "testpass",
+		Timezone:     "Europe/London",
+		Keymap:       "us",
+		NetworkIface: "eth0",
+		DiskDevice:   "/dev/sda",
+		Groups:       []string{"audio", "video"},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("Config() = %+v, want %+v", cfg, want)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestFile_ConfigMalformedValues(t *testing.T) {
+	input := "HOSTNAMEOPTS=\"-n\"\nUSEROPTS=\"-a -g wheel\"\nDISKOPTS=\"-m sys\"\n"
+	f, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.Config()
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("Config() error = %v, want ErrorList", err)
+	}
+	lines := make([]int, len(list))
+	for i, e := range list {
+		lines[i] = e.Line
+	}
+	if !reflect.DeepEqual(lines, []int{1, 2, 3}) {
+		t.Errorf("Config() error lines = %v, want [1 2 3]", lines)
+	}
+}
+
+func TestFile_Answers(t *testing.T) {
+	input := `KEYMAPOPTS="de de-nodeadkeys"
+HOSTNAMEOPTS=pi-garage
+INTERFACESOPTS="auto lo
+iface lo inet loopback
+
+iface wlan0 inet dhcp
+
+auto eth0
+iface eth0 inet static
+	address 10.0.0.5
+	netmask 255.255.255.0
+	gateway 10.0.0.1
+"
+DISKOPTS="-m sys -s 0 /dev/sda /dev/sdb"
+USEROPTS="-a -f Tester -gwheel,docker admin"
+DNSOPTS="-d example.com 10.0.0.1"
+`
+	f, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := f.Answers()
+	if err != nil {
+		t.Fatalf("Answers() error = %v", err)
+	}
+
+	if a.Keymap != (Keymap{Layout: "de", Variant: "de-nodeadkeys"}) {
+		t.Errorf("Keymap = %+v", a.Keymap)
+	}
+	if a.Hostname != "pi-garage" {
+		t.Errorf("Hostname = %q, want %q", a.Hostname, "pi-garage")
+	}
+	if len(a.Interfaces) != 3 {
+		t.Fatalf("Interfaces = %+v, want 3 interfaces", a.Interfaces)
+	}
+	eth0 := a.Interfaces[2]
+	if eth0.Name != "eth0" || !eth0.Auto || eth0.Family != "inet" || eth0.Method != "static" {
+		t.Errorf("eth0 = %+v", eth0)
+	}
+	if eth0.Options["address"] != "10.0.0.5" || eth0.Options["gateway"] != "10.0.0.1" {
+		t.Errorf("eth0 options = %v", eth0.Options)
+	}
+	if !reflect.DeepEqual(a.Disk, Disk{Mode: "sys", Devices: []string{"/dev/sda", "/dev/sdb"}}) {
+		t.Errorf("Disk = %+v", a.Disk)
+	}
+	if a.User.Name != "admin" || !a.User.Admin || !reflect.DeepEqual(a.User.Groups, []string{"wheel", "docker"}) {
+		t.Errorf("User = %+v", a.User)
+	}
+	if !reflect.DeepEqual(a.DNS, DNS{Domain: "example.com", Nameservers: []string{"10.0.0.1"}}) {
+		t.Errorf("DNS = %+v", a.DNS)
+	}
+
+	cfg := a.Config()
+	if cfg.NetworkIface != "eth0" {
+		t.Errorf("Config().NetworkIface = %q, want the auto interface eth0", cfg.NetworkIface)
+	}
+	if cfg.Address != "10.0.0.5/24" || cfg.Gateway != "10.0.0.1" {
+		t.Errorf("Config() address = %q gateway = %q, want 10.0.0.5/24 via 10.0.0.1", cfg.Address, cfg.Gateway)
+	}
+	if !reflect.DeepEqual(cfg.DNS, []string{"10.0.0.1"}) {
+		t.Errorf("Config().DNS = %v, want [10.0.0.1]", cfg.DNS)
+	}
+	if cfg.DiskDevice != "/dev/sda" {
+		t.Errorf("Config().DiskDevice = %q, want %q", cfg.DiskDevice, "/dev/sda")
+	}
+}
@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/generator"
+)
+
+const lowerAlnum = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// passwordChars holds every byte except NUL, including the ones the shell
+// treats specially inside double quotes
+var passwordChars = func() string {
+	b := make([]byte, 255)
+	for i := range b {
+		b[i] = byte(i + 1)
+	}
+	return string(b)
+}()
+
+// randomConfig is a quick.Generator for configurations the default template
+// can represent
+type randomConfig struct {
+	*config.Config
+}
+
+func (randomConfig) Generate(r *rand.Rand, size int) reflect.Value {
+	cfg := &config.Config{
+		Hostname:     randomString(r, "abcdefghijklmnopqrstuvwxyz", 1, 1) + randomString(r, lowerAlnum+"-", 0, 62),
+		Username:     randomString(r, "abcdefghijklmnopqrstuvwxyz_", 1, 1) + randomString(r, lowerAlnum+"_-.", 0, 31),
+		Password:     randomString(r, passwordChars, 1, 64),
+		Timezone:     randomString(r, "ABCDEFGHIJKLMNOPQRSTUVWXYZ", 1, 1) + randomString(r, "abcdefghijklmnopqrstuvwxyz_", 1, 10) + "/" + randomString(r, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz_", 1, 14),
+		Keymap:       randomString(r, "abcdefghijklmnopqrstuvwxyz-", 1, 8),
+		NetworkIface: "eth" + randomString(r, lowerAlnum, 0, 4),
+		DiskDevice:   "/dev/" + randomString(r, lowerAlnum, 1, 10),
+	}
+	for i := r.Intn(5); i > 0; i-- {
+		cfg.Groups = append(cfg.Groups, randomString(r, "abcdefghijklmnopqrstuvwxyz", 1, 12))
+	}
+	if r.Intn(2) == 0 {
+		cfg.Address = fmt.Sprintf("10.%d.%d.%d/%d", r.Intn(256), r.Intn(256), 1+r.Intn(254), 24)
+		if r.Intn(2) == 0 {
+			cfg.Gateway = "10.0.0.1"
+		}
+		for i := 1 + r.Intn(3); i > 0; i-- {
+			cfg.DNS = append(cfg.DNS, fmt.Sprintf("10.0.%d.%d", r.Intn(256), 1+r.Intn(254)))
+		}
+	}
+	if r.Intn(2) == 0 {
+		cfg.SSHKey = "/home/" + cfg.Username + "/.ssh/" + randomString(r, lowerAlnum+"_.", 1, 16)
+	}
+	return reflect.ValueOf(randomConfig{cfg})
+}
+
+func randomString(r *rand.Rand, chars string, minLen, maxLen int) string {
+	b := make([]byte, minLen+r.Intn(maxLen-minLen+1))
+	for i := range b {
+		b[i] = chars[r.Intn(len(chars))]
+	}
+	return string(b)
+}
+
+func render(t *testing.T, cfg *config.Config) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := generator.New(cfg, "").Render(&buf); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	roundTrip := func(rc randomConfig) bool {
+		first := render(t, rc.Config)
+
+		f, err := Parse(bytes.NewReader(first))
+		if err != nil {
+			t.Logf("Parse() error = %v\n%s", err, first)
+			return false
+		}
+		parsed, err := f.Config()
+		if err != nil {
+			t.Logf("Config() error = %v\n%s", err, first)
+			return false
+		}
+
+		second := render(t, parsed)
+		if !bytes.Equal(first, second) {
+			t.Logf("generate -> parse -> generate differs\nfirst:\n%s\nsecond:\n%s", first, second)
+			return false
+		}
+		return true
+	}
+
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRoundTrip_Defaults(t *testing.T) {
+	cfg := config.New()
+	f, err := Parse(bytes.NewReader(render(t, cfg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := f.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, cfg) {
+		t.Errorf("Config() = %+v, want %+v", parsed, cfg)
+	}
+}
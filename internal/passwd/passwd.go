@@ -0,0 +1,149 @@
+package passwd
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const (
+	// saltChars are the characters crypt(3) allows in a salt
+	saltChars = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	saltLength    = 16
+	defaultRounds = 5000
+	minRounds     = 1000
+	maxRounds     = 999999999
+)
+
+// Hash returns the SHA-512 crypt(3) hash of password with a random salt, in
+// the "$6$salt$hash" form understood by /etc/shadow, chpasswd -e and
+// cloud-init
+func Hash(password string) (string, error) {
+	salt := make([]byte, saltLength)
+	for i := range salt {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(saltChars))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate salt: %w", err)
+		}
+		salt[i] = saltChars[n.Int64()]
+	}
+	return sha512Crypt(password, string(salt), defaultRounds), nil
+}
+
+// sha512Crypt implements the SHA-512 based crypt(3) scheme described in
+// https://www.akkadia.org/drepper/SHA-crypt.txt
+func sha512Crypt(password, salt string, rounds int) string {
+	if len(salt) > saltLength {
+		salt = salt[:saltLength]
+	}
+	customRounds := rounds != defaultRounds
+	if rounds < minRounds {
+		rounds = minRounds
+	}
+	if rounds > maxRounds {
+		rounds = maxRounds
+	}
+
+	pw := []byte(password)
+	s := []byte(salt)
+
+	b := sha512.New()
+	b.Write(pw)
+	b.Write(s)
+	b.Write(pw)
+	digestB := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(pw)
+	a.Write(s)
+	a.Write(repeat(digestB, len(pw)))
+	for n := len(pw); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(digestB)
+		} else {
+			a.Write(pw)
+		}
+	}
+	digestA := a.Sum(nil)
+
+	dp := sha512.New()
+	for range pw {
+		dp.Write(pw)
+	}
+	p := repeat(dp.Sum(nil), len(pw))
+
+	ds := sha512.New()
+	for i := 0; i < 16+int(digestA[0]); i++ {
+		ds.Write(s)
+	}
+	sBytes := repeat(ds.Sum(nil), len(s))
+
+	digest := digestA
+	for i := 0; i < rounds; i++ {
+		c := sha512.New()
+		if i&1 != 0 {
+			c.Write(p)
+		} else {
+			c.Write(digest)
+		}
+		if i%3 != 0 {
+			c.Write(sBytes)
+		}
+		if i%7 != 0 {
+			c.Write(p)
+		}
+		if i&1 != 0 {
+			c.Write(digest)
+		} else {
+			c.Write(p)
+		}
+		digest = c.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString("$6$")
+	if customRounds {
+		out.WriteString("rounds=" + strconv.Itoa(rounds) + "$")
+	}
+	out.WriteString(salt)
+	out.WriteByte('$')
+	encode(&out, digest)
+	return out.String()
+}
+
+// repeat returns digest repeated to exactly n bytes
+func repeat(digest []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out)+len(digest) <= n {
+		out = append(out, digest...)
+	}
+	return append(out, digest[:n-len(out)]...)
+}
+
+// encodeOrder is the byte permutation crypt(3) applies before encoding a
+// SHA-512 digest
+var encodeOrder = [21][3]int{
+	{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+	{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+	{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+	{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+	{62, 20, 41},
+}
+
+// encode writes digest in the base64 variant used by crypt(3)
+func encode(out *strings.Builder, digest []byte) {
+	write := func(w uint32, n int) {
+		for ; n > 0; n-- {
+			out.WriteByte(saltChars[w&0x3f])
+			w >>= 6
+		}
+	}
+	for _, o := range encodeOrder {
+		write(uint32(digest[o[0]])<<16|uint32(digest[o[1]])<<8|uint32(digest[o[2]]), 4)
+	}
+	write(uint32(digest[63]), 2)
+}
@@ -0,0 +1,84 @@
+package passwd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSHA512Crypt(t *testing.T) {
+	// Test vectors from https://www.akkadia.org/drepper/SHA-crypt.txt
+	tests := []struct {
+		password string
+		salt     string
+		rounds   int
+		want     string
+	}{
+		{
+			password: "Hello world!",
+			salt:     "saltstring",
+			rounds:   5000,
+			want:     "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+		},
+		{
+			password: "Hello world!",
+			salt:     "saltstringsaltstring",
+			rounds:   10000,
+			want:     "$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+		},
+		{
+			password: "This is just a test",
+			salt:     "toolongsaltstring",
+			rounds:   5000,
+			want:     "$6$toolongsaltstrin$lQ8jolhgVRVhY4b5pZKaysCLi0QBxGoNeKQzQ3glMhwllF7oGDZxUhx1yxdYcz/e1JSbq3y6JMxxl8audkUEm0",
+		},
+		{
+			password: "a very much longer text to encrypt.  This one even stretches over morethan one line.",
+			salt:     "anotherlongsaltstring",
+			rounds:   1400,
+			want:     "$6$rounds=1400$anotherlongsalts$POfYwTEok97VWcjxIiSOjiykti.o/pQs.wPvMxQ6Fm7I6IoYN3CmLs66x9t0oSwbtEW7o7UmJEiDwGqd8p4ur1",
+		},
+		{
+			password: "we have a short salt string but not a short password",
+			salt:     "short",
+			rounds:   77777,
+			want:     "$6$rounds=77777$short$WuQyW2YR.hBNpjjRhpYD/ifIw05xdfeEyQoMxIXbkvr0gge1a1x3yRULJ5CCaUeOxFmtlcGZelFl5CxtgfiAc0",
+		},
+		{
+			password: "the minimum number is still observed",
+			salt:     "roundstoolow",
+			rounds:   10,
+			want:     "$6$rounds=1000$roundstoolow$kUMsbe306n21p9R.FRkW3IGn.S9NPN0x50YhH1xhLsPuWGsUSklZt58jaTfF4ZEQpyUNGc0dqbpBYYBaHHrsX.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.salt, func(t *testing.T) {
+			if got := sha512Crypt(tt.password, tt.salt, tt.rounds); got != tt.want {
+				t.Errorf("sha512Crypt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	first, err := Hash("changeme")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	second, err := Hash("changeme")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+
+	if first == second {
+		t.Error("Hash() should use a random salt")
+	}
+
+	parts := strings.Split(first, "$")
+	if len(parts) != 4 || parts[1] != "6" || len(parts[2]) != saltLength || len(parts[3]) != 86 {
+		t.Fatalf("Hash() = %q, want $6$<16 char salt>$<86 char hash>", first)
+	}
+	if got := sha512Crypt("changeme", parts[2], defaultRounds); got != first {
+		t.Errorf("Hash() = %q is not reproducible from its salt: %q", first, got)
+	}
+}
@@ -0,0 +1,403 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/inventory"
+	"github.com/btassone/alpine-hero/internal/ipxe"
+)
+
+// HealthPath is the path of the health endpoint
+const HealthPath = "/healthz"
+
+// MenuPath is the path of the iPXE menu
+const MenuPath = "/" + ipxe.MenuFile
+
+// overlaySuffix ends the file name of an overlay
+const overlaySuffix = ".apkovl.tar.gz"
+
+// RenderFunc renders the answer file of a host
+type RenderFunc func(cfg *config.Config) ([]byte, error)
+
+// Options configure the server
+type Options struct {
+	// Render renders an answer file on every request, so changes to the
+	// template are served without a restart
+	Render RenderFunc
+	// Tokens gives every host a one-time token that has to be passed as the
+	// token query parameter. A token is used up by the first successful
+	// fetch. Unknown hosts, wrong tokens and used tokens get the same 403,
+	// so a client without a token learns nothing about the hosts.
+	Tokens bool
+	// Log receives a line for every request, nothing is logged if nil
+	Log io.Writer
+	// Overlay builds the apkovl of a host on every request, served at
+	// ApkovlPath. It is served without a token, so it must not contain the
+	// answer file; network booted hosts fetch that from this server.
+	Overlay RenderFunc
+	// IPXE enables iPXE scripts that boot the hosts with the overlay and
+	// answer file of this server, a menu of every host at MenuPath and a
+	// script per host with a MAC at /ipxe/<mac>.ipxe. It needs Overlay. The
+	// scripts are served without a token, so with Tokens a script only
+	// carries the token of a host when it is fetched from the host's static
+	// address.
+	IPXE *ipxe.Options
+}
+
+// Server serves the answer files of a fleet over HTTP. A host's answer file
+// is found by hostname, by MAC address or by the address of the client:
+//
+//	GET /answers/{hostname}
+//	GET /answers/mac/{mac}
+//	GET /answers
+//
+// With Options.Overlay and Options.IPXE it also serves the overlays and iPXE
+// scripts that network boot the hosts into an install with these answer
+// files.
+type Server struct {
+	render  RenderFunc
+	overlay RenderFunc
+	ipxe    *ipxe.Options
+	hosts   []*inventory.Host
+	log     *log.Logger
+	mux     *http.ServeMux
+
+	byName map[string]*inventory.Host
+	byMAC  map[string]*inventory.Host
+	byAddr map[netip.Addr]*inventory.Host
+
+	mu     sync.Mutex
+	tokens map[string]*token
+}
+
+// token is the one-time token of a host
+type token struct {
+	value string
+	used  bool
+}
+
+// New returns a server for hosts. Hosts are matched by their hostname, MAC
+// and static address, each of which has to be unique.
+func New(hosts []inventory.Host, opts Options) (*Server, error) {
+	if opts.Render == nil {
+		return nil, fmt.Errorf("server needs a render function")
+	}
+	if opts.IPXE != nil && opts.Overlay == nil {
+		return nil, fmt.Errorf("iPXE scripts need an overlay function")
+	}
+	s := &Server{
+		render:  opts.Render,
+		overlay: opts.Overlay,
+		ipxe:    opts.IPXE,
+		log:     log.New(io.Discard, "", log.LstdFlags),
+		mux:     http.NewServeMux(),
+		byName:  make(map[string]*inventory.Host),
+		byMAC:   make(map[string]*inventory.Host),
+		byAddr:  make(map[netip.Addr]*inventory.Host),
+	}
+	if opts.Log != nil {
+		s.log.SetOutput(opts.Log)
+	}
+
+	for i := range hosts {
+		h := &hosts[i]
+		name := h.Config.Hostname
+		if name == "" {
+			return nil, fmt.Errorf("%s has no hostname", h.Name())
+		}
+		if _, dup := s.byName[name]; dup {
+			return nil, fmt.Errorf("duplicate hostname %s", name)
+		}
+		s.byName[name] = h
+		s.hosts = append(s.hosts, h)
+		if h.MAC != "" {
+			if other, dup := s.byMAC[h.MAC]; dup {
+				return nil, fmt.Errorf("mac %s is used by %s and %s", h.MAC, other.Config.Hostname, name)
+			}
+			s.byMAC[h.MAC] = h
+		}
+		if prefix, err := netip.ParsePrefix(h.Config.Address); err == nil {
+			if other, dup := s.byAddr[prefix.Addr()]; dup {
+				return nil, fmt.Errorf("address %s is used by %s and %s", prefix.Addr(), other.Config.Hostname, name)
+			}
+			s.byAddr[prefix.Addr()] = h
+		}
+	}
+
+	if opts.Tokens {
+		s.tokens = make(map[string]*token, len(s.byName))
+		for name := range s.byName {
+			value, err := newToken()
+			if err != nil {
+				return nil, err
+			}
+			s.tokens[name] = &token{value: value}
+		}
+	}
+
+	s.mux.HandleFunc("GET "+HealthPath, s.health)
+	s.mux.HandleFunc("GET /answers", s.answers(s.hostByClient))
+	s.mux.HandleFunc("GET /answers/{hostname}", s.answers(s.hostByName))
+	s.mux.HandleFunc("GET /answers/mac/{mac}", s.answers(s.hostByMAC))
+	if s.overlay != nil {
+		s.mux.HandleFunc("GET /apkovl/{file}", s.apkovl)
+	}
+	if s.ipxe != nil {
+		s.mux.HandleFunc("GET "+MenuPath, s.menu)
+		s.mux.HandleFunc("GET /ipxe/{file}", s.script)
+	}
+	return s, nil
+}
+
+// Token returns the one-time token of a host, empty if tokens are disabled
+// or the host is unknown
+func (s *Server) Token(hostname string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tokens[hostname]; ok {
+		return t.value
+	}
+	return ""
+}
+
+// AnswersPath returns the path the answer file of a host is served at
+func AnswersPath(hostname string) string {
+	return "/answers/" + hostname
+}
+
+// ApkovlPath returns the path the overlay of a host is served at
+func ApkovlPath(hostname string) string {
+	return "/apkovl/" + hostname + overlaySuffix
+}
+
+// ServeHTTP serves a request and logs it
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+	s.mux.ServeHTTP(rec, r)
+	host := rec.host
+	if host == "" {
+		host = "-"
+	}
+	// the query is left out because it holds the token
+	s.log.Printf("%s %s %s %d %d %s", clientAddr(r), r.Method, r.URL.Path, rec.status, rec.bytes, host)
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+// lookup finds the host a request is for. It returns the HTTP status and a
+// message when there is none.
+type lookup func(r *http.Request) (*inventory.Host, int, string)
+
+func (s *Server) hostByName(r *http.Request) (*inventory.Host, int, string) {
+	name := r.PathValue("hostname")
+	if h, ok := s.byName[name]; ok {
+		return h, 0, ""
+	}
+	return nil, http.StatusNotFound, fmt.Sprintf("no host named %s", name)
+}
+
+func (s *Server) hostByMAC(r *http.Request) (*inventory.Host, int, string) {
+	hw, err := net.ParseMAC(r.PathValue("mac"))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Sprintf("invalid mac %q", r.PathValue("mac"))
+	}
+	if h, ok := s.byMAC[hw.String()]; ok {
+		return h, 0, ""
+	}
+	return nil, http.StatusNotFound, fmt.Sprintf("no host with mac %s", hw)
+}
+
+func (s *Server) hostByClient(r *http.Request) (*inventory.Host, int, string) {
+	addr := clientAddr(r)
+	if addr.IsValid() {
+		if h, ok := s.byAddr[addr]; ok {
+			return h, 0, ""
+		}
+	}
+	return nil, http.StatusNotFound, fmt.Sprintf("no host with address %s", addr)
+}
+
+// answers returns a handler serving the answer file of the host found by
+// find, rendered for this request
+func (s *Server) answers(find lookup) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h, status, msg := find(r)
+		if s.tokens != nil && (h == nil || !s.useToken(h.Config.Hostname, r.URL.Query().Get("token"))) {
+			http.Error(w, "missing or invalid token", http.StatusForbidden)
+			return
+		}
+		if h == nil {
+			http.Error(w, msg, status)
+			return
+		}
+		name := h.Config.Hostname
+		w.(*recorder).host = name
+
+		data, err := s.render(h.Config)
+		if err != nil {
+			if s.tokens != nil {
+				s.restoreToken(name)
+			}
+			s.log.Printf("failed to render the answer file of %s: %v", name, err)
+			http.Error(w, fmt.Sprintf("failed to render the answer file of %s", name), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(data)
+	}
+}
+
+// apkovl serves the overlay of a host
+func (s *Server) apkovl(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.PathValue("file"), overlaySuffix)
+	h := s.byName[name]
+	if !ok || h == nil {
+		http.Error(w, fmt.Sprintf("no overlay named %s", r.PathValue("file")), http.StatusNotFound)
+		return
+	}
+	w.(*recorder).host = name
+	data, err := s.overlay(h.Config)
+	if err != nil {
+		s.log.Printf("failed to build the overlay of %s: %v", name, err)
+		http.Error(w, fmt.Sprintf("failed to build the overlay of %s", name), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(data)
+}
+
+// menu serves the iPXE menu of every host
+func (s *Server) menu(w http.ResponseWriter, r *http.Request) {
+	hosts := make([]ipxe.Host, len(s.hosts))
+	for i, h := range s.hosts {
+		hosts[i] = s.bootHost(r, h)
+	}
+	data, err := ipxe.Menu(hosts, *s.ipxe)
+	s.writeScript(w, data, err)
+}
+
+// script serves the iPXE script of the host with the MAC in the file name
+func (s *Server) script(w http.ResponseWriter, r *http.Request) {
+	mac, ok := strings.CutSuffix(r.PathValue("file"), ".ipxe")
+	hw, err := net.ParseMAC(mac)
+	if !ok || err != nil {
+		http.Error(w, fmt.Sprintf("no script named %s", r.PathValue("file")), http.StatusNotFound)
+		return
+	}
+	h, ok := s.byMAC[hw.String()]
+	if !ok {
+		http.Error(w, fmt.Sprintf("no host with mac %s", hw), http.StatusNotFound)
+		return
+	}
+	w.(*recorder).host = h.Config.Hostname
+	data, err := ipxe.Script(s.bootHost(r, h), *s.ipxe)
+	s.writeScript(w, data, err)
+}
+
+// bootHost returns h with the URLs of its overlay and answer file on this
+// server, as reached by the client of r. The answer file URL has the token
+// of h only if the client is h, known by its static address; a MAC in the
+// request proves nothing, anyone can ask for any script.
+func (s *Server) bootHost(r *http.Request, h *inventory.Host) ipxe.Host {
+	base := "http://" + r.Host
+	answers := base + AnswersPath(h.Config.Hostname)
+	if client, ok := s.byAddr[clientAddr(r)]; ok && client == h {
+		if token := s.Token(h.Config.Hostname); token != "" {
+			answers += "?token=" + token
+		}
+	}
+	return ipxe.Host{
+		Name:    h.Config.Hostname,
+		MAC:     h.MAC,
+		Apkovl:  base + ApkovlPath(h.Config.Hostname),
+		Answers: answers,
+	}
+}
+
+func (s *Server) writeScript(w http.ResponseWriter, data []byte, err error) {
+	if err != nil {
+		s.log.Printf("failed to render the iPXE script: %v", err)
+		http.Error(w, "failed to render the iPXE script", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(data)
+}
+
+// useToken checks the token given for a host and marks it used, so two
+// clients racing with the same token cannot both get the answer file. It
+// reports whether the token was accepted; a used token is rejected like a
+// wrong one.
+func (s *Server) useToken(hostname, given string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.tokens[hostname]
+	if subtle.ConstantTimeCompare([]byte(given), []byte(t.value)) != 1 || t.used {
+		return false
+	}
+	t.used = true
+	return true
+}
+
+// restoreToken makes a used token valid again after the answer file could
+// not be served
+func (s *Server) restoreToken(hostname string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[hostname].used = false
+}
+
+// newToken returns a random token
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate a token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// clientAddr returns the address of the client, without the port and with
+// IPv4-mapped IPv6 addresses unmapped
+func clientAddr(r *http.Request) netip.Addr {
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ap.Addr().Unmap()
+}
+
+// recorder remembers the status, size and host of a response for the log
+type recorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	host   string
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
@@ -0,0 +1,344 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/inventory"
+	"github.com/btassone/alpine-hero/internal/ipxe"
+)
+
+// testHosts returns a fleet of a host with a MAC and a static address and a
+// host using DHCP
+func testHosts() []inventory.Host {
+	kitchen := config.New()
+	kitchen.Hostname = "pi-kitchen"
+	kitchen.Address = "192.0.2.10/24"
+	garage := config.New()
+	garage.Hostname = "pi-garage"
+	return []inventory.Host{
+		{Line: 2, MAC: "52:54:00:ab:cd:ef", Config: kitchen},
+		{Line: 3, Config: garage},
+	}
+}
+
+// renderHostname renders a fake answer file and counts the renders
+type renderHostname struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (r *renderHostname) render(cfg *config.Config) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	return []byte(fmt.Sprintf("HOSTNAMEOPTS=\"-n %s\"\n", cfg.Hostname)), nil
+}
+
+func get(t *testing.T, h http.Handler, remote, target string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if remote != "" {
+		req.RemoteAddr = remote
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Result().Body)
+	return rec.Code, string(body)
+}
+
+func TestServer(t *testing.T) {
+	r := &renderHostname{}
+	var logBuf bytes.Buffer
+	s, err := New(testHosts(), Options{Render: r.render, Log: &logBuf})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remote     string
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "health", target: HealthPath, wantStatus: http.StatusOK, wantBody: "ok\n"},
+		{name: "hostname", target: "/answers/pi-garage", wantStatus: http.StatusOK, wantBody: `-n pi-garage`},
+		{name: "unknown hostname", target: "/answers/pi-attic", wantStatus: http.StatusNotFound, wantBody: "no host named pi-attic"},
+		{name: "mac", target: "/answers/mac/52-54-00-AB-CD-EF", wantStatus: http.StatusOK, wantBody: `-n pi-kitchen`},
+		{name: "unknown mac", target: "/answers/mac/52:54:00:00:00:00", wantStatus: http.StatusNotFound, wantBody: "no host with mac 52:54:00:00:00:00"},
+		{name: "invalid mac", target: "/answers/mac/kitchen", wantStatus: http.StatusBadRequest, wantBody: `invalid mac "kitchen"`},
+		{name: "client address", remote: "192.0.2.10:40112", target: "/answers", wantStatus: http.StatusOK, wantBody: `-n pi-kitchen`},
+		{name: "mapped client address", remote: "[::ffff:192.0.2.10]:40112", target: "/answers", wantStatus: http.StatusOK, wantBody: `-n pi-kitchen`},
+		{name: "unknown client address", remote: "192.0.2.99:40112", target: "/answers", wantStatus: http.StatusNotFound, wantBody: "no host with address 192.0.2.99"},
+		{name: "wrong method", target: "/answers/pi-garage", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var status int
+			var body string
+			if tt.wantStatus == http.StatusMethodNotAllowed {
+				rec := httptest.NewRecorder()
+				s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.target, nil))
+				status = rec.Code
+			} else {
+				status, body = get(t, s, tt.remote, tt.target)
+			}
+			if status != tt.wantStatus || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("GET %s = %d %q, want %d %q", tt.target, status, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+
+	// every fetch renders again, and the requests are logged with the host
+	before := r.calls
+	get(t, s, "", "/answers/pi-garage")
+	get(t, s, "", "/answers/pi-garage")
+	if r.calls != before+2 {
+		t.Errorf("render calls = %d, want %d", r.calls, before+2)
+	}
+	for _, line := range []string{
+		"192.0.2.10 GET /answers 200 29 pi-kitchen\n",
+		"GET /answers/pi-attic 404 23 -\n",
+		"GET " + HealthPath + " 200 3 -\n",
+	} {
+		if !strings.Contains(logBuf.String(), line) {
+			t.Errorf("log missing %q\n%s", line, logBuf.String())
+		}
+	}
+}
+
+func TestServer_Tokens(t *testing.T) {
+	r := &renderHostname{}
+	var logBuf bytes.Buffer
+	s, err := New(testHosts(), Options{Render: r.render, Tokens: true, Log: &logBuf})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	token := s.Token("pi-kitchen")
+	if len(token) != 32 || token == s.Token("pi-garage") {
+		t.Fatalf("Token() = %q, want distinct random tokens", token)
+	}
+	if s.Token("pi-attic") != "" {
+		t.Error("Token() of an unknown host is not empty")
+	}
+
+	if status, _ := get(t, s, "", "/answers/pi-kitchen"); status != http.StatusForbidden {
+		t.Errorf("fetch without a token = %d, want 403", status)
+	}
+	if status, _ := get(t, s, "", "/answers/pi-kitchen?token="+s.Token("pi-garage")); status != http.StatusForbidden {
+		t.Errorf("fetch with another host's token = %d, want 403", status)
+	}
+	if r.calls != 0 {
+		t.Errorf("rejected fetches rendered %d answer files", r.calls)
+	}
+
+	// the token works once, whichever way the host is found
+	if status, body := get(t, s, "", "/answers/mac/52:54:00:ab:cd:ef?token="+token); status != http.StatusOK || !strings.Contains(body, "pi-kitchen") {
+		t.Errorf("fetch with the token = %d %q", status, body)
+	}
+
+	// unknown hosts, wrong tokens and used tokens get the same answer
+	want := "missing or invalid token\n"
+	for _, target := range []string{
+		"/answers?token=" + token,
+		"/answers/pi-kitchen?token=" + token,
+		"/answers/pi-garage?token=" + token,
+		"/answers/pi-attic?token=" + token,
+		"/answers/mac/52:54:00:00:00:99?token=" + token,
+	} {
+		if status, body := get(t, s, "192.0.2.10:1234", target); status != http.StatusForbidden || body != want {
+			t.Errorf("GET %s = %d %q, want 403 %q", target, status, body, want)
+		}
+	}
+	if strings.Contains(logBuf.String(), token) {
+		t.Errorf("log contains the token:\n%s", logBuf.String())
+	}
+}
+
+func TestServer_TokenRace(t *testing.T) {
+	r := &renderHostname{}
+	s, err := New(testHosts(), Options{Render: r.render, Tokens: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	url := ts.URL + "/answers/pi-garage?token=" + s.Token("pi-garage")
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ok := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(url)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				mu.Lock()
+				ok++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if ok != 1 {
+		t.Errorf("%d clients got the answer file with one token, want 1", ok)
+	}
+}
+
+func TestServer_RenderError(t *testing.T) {
+	var logBuf bytes.Buffer
+	fail := true
+	render := func(cfg *config.Config) ([]byte, error) {
+		if fail {
+			return nil, fmt.Errorf("template: missing partial")
+		}
+		return []byte("ok"), nil
+	}
+	s, err := New(testHosts(), Options{Render: render, Tokens: true, Log: &logBuf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := "/answers/pi-garage?token=" + s.Token("pi-garage")
+	if status, body := get(t, s, "", target); status != http.StatusInternalServerError || strings.Contains(body, "missing partial") {
+		t.Errorf("fetch = %d %q, want 500 without the error details", status, body)
+	}
+	if !strings.Contains(logBuf.String(), "failed to render the answer file of pi-garage: template: missing partial") {
+		t.Errorf("log =\n%s", logBuf.String())
+	}
+
+	// a failed render does not use up the token
+	fail = false
+	if status, _ := get(t, s, "", target); status != http.StatusOK {
+		t.Errorf("fetch after fixing the template = %d, want 200", status)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	render := func(*config.Config) ([]byte, error) { return nil, nil }
+	dupMAC := testHosts()
+	dupMAC[1].MAC = dupMAC[0].MAC
+	dupAddr := testHosts()
+	dupAddr[1].Config.Address = "192.0.2.10/16"
+	dupName := testHosts()
+	dupName[1].Config.Hostname = "pi-kitchen"
+
+	tests := []struct {
+		name    string
+		hosts   []inventory.Host
+		opts    Options
+		wantErr string
+	}{
+		{name: "no render function", hosts: testHosts(), wantErr: "needs a render function"},
+		{name: "duplicate hostname", hosts: dupName, opts: Options{Render: render}, wantErr: "duplicate hostname pi-kitchen"},
+		{name: "duplicate mac", hosts: dupMAC, opts: Options{Render: render}, wantErr: "mac 52:54:00:ab:cd:ef is used by pi-kitchen and pi-garage"},
+		{name: "duplicate address", hosts: dupAddr, opts: Options{Render: render}, wantErr: "address 192.0.2.10 is used by pi-kitchen and pi-garage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.hosts, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("New() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServer_IPXE(t *testing.T) {
+	r := &renderHostname{}
+	overlay := func(cfg *config.Config) ([]byte, error) {
+		return []byte("overlay of " + cfg.Hostname), nil
+	}
+	s, err := New(testHosts(), Options{Render: r.render, Overlay: overlay, IPXE: &ipxe.Options{Flavor: "virt"}, Tokens: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	fetch := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, menu := fetch(MenuPath)
+	if status != http.StatusOK {
+		t.Fatalf("GET %s = %d\n%s", MenuPath, status, menu)
+	}
+	for _, want := range []string{
+		"iseq ${netX/mac} 52:54:00:ab:cd:ef && goto pi-kitchen ||\n",
+		"apkovl=" + ts.URL + "/apkovl/pi-garage.apkovl.tar.gz ",
+		"alpine_hero_answers=" + ts.URL + "/answers/pi-garage\n",
+		"vmlinuz-virt",
+	} {
+		if !strings.Contains(menu, want) {
+			t.Errorf("menu missing %q\n%s", want, menu)
+		}
+	}
+	if strings.Contains(menu, "token=") {
+		t.Errorf("menu for a client that is no host contains a token\n%s", menu)
+	}
+
+	status, script := fetch("/ipxe/52-54-00-ab-cd-ef.ipxe")
+	if status != http.StatusOK || !strings.Contains(script, "# Generated by alpine-hero for pi-kitchen.") {
+		t.Errorf("GET per-MAC script = %d\n%s", status, script)
+	}
+	if strings.Contains(script, "token=") {
+		t.Errorf("script for a client that is not pi-kitchen contains its token\n%s", script)
+	}
+
+	// only the host itself, known by its static address, gets its token
+	token := "alpine_hero_answers=http://example.com/answers/pi-kitchen?token=" + s.Token("pi-kitchen")
+	if status, script := get(t, s, "192.0.2.10:1234", "/ipxe/52-54-00-ab-cd-ef.ipxe"); status != http.StatusOK || !strings.Contains(script, token) {
+		t.Errorf("GET per-MAC script from pi-kitchen = %d, want it to contain %q\n%s", status, token, script)
+	}
+	status, menu = get(t, s, "192.0.2.10:1234", MenuPath)
+	if status != http.StatusOK || !strings.Contains(menu, token) || strings.Count(menu, "token=") != 1 {
+		t.Errorf("GET %s from pi-kitchen = %d, want only the token of pi-kitchen\n%s", MenuPath, status, menu)
+	}
+	if status, _ := fetch("/ipxe/52-54-00-00-00-00.ipxe"); status != http.StatusNotFound {
+		t.Errorf("GET script of an unknown mac = %d, want 404", status)
+	}
+
+	// the overlay is served without a token, the answer file URL of the
+	// host's script works once
+	if status, body := fetch("/apkovl/pi-kitchen.apkovl.tar.gz"); status != http.StatusOK || body != "overlay of pi-kitchen" {
+		t.Errorf("GET overlay = %d %q", status, body)
+	}
+	if status, _ := fetch("/apkovl/pi-kitchen.tar"); status != http.StatusNotFound {
+		t.Errorf("GET overlay with a wrong name = %d, want 404", status)
+	}
+	answers := strings.TrimPrefix(token, "alpine_hero_answers=http://example.com")
+	for i, want := range []int{http.StatusOK, http.StatusForbidden} {
+		if status, _ := get(t, s, "192.0.2.10:1234", answers); status != want {
+			t.Errorf("fetch %d of the script's answer file URL = %d, want %d", i+1, status, want)
+		}
+	}
+
+	if _, err := New(testHosts(), Options{Render: r.render, IPXE: &ipxe.Options{}}); err == nil {
+		t.Error("New() accepted iPXE scripts without an overlay")
+	}
+	plain, _ := New(testHosts(), Options{Render: r.render})
+	if status, _ := get(t, plain, "", MenuPath); status != http.StatusNotFound {
+		t.Errorf("GET %s without iPXE = %d, want 404", MenuPath, status)
+	}
+}
@@ -0,0 +1,183 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/parser"
+)
+
+// Shell is the interpreter used to source answer files, the same one
+// setup-alpine runs under
+var Shell = "/bin/sh"
+
+// sourceScript sources the answer file given as $1 and prints every variable
+// named in the remaining arguments as NUL-separated name, set flag and value
+const sourceScript = `. "$1" >&2 || exit 1
+shift
+for name do
+	eval "isset=\${$name+1} value=\${$name-}"
+	printf '%s\000%s\000%s\000' "$name" "$isset" "$value"
+done`
+
+// Source runs the answer file at path in a shell with an empty environment and
+// a scratch working directory, and returns the answer variables that are set
+// once it has been sourced
+func Source(ctx context.Context, path string) (map[string]string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path: %w", err)
+	}
+	if _, err := os.Stat(absPath); err != nil {
+		return nil, fmt.Errorf("cannot access answer file: %w", err)
+	}
+
+	workDir, err := os.MkdirTemp("", "alpine-hero-verify")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(workDir)
+	}()
+
+	args := append([]string{"-c", sourceScript, "sh", absPath}, parser.KnownVariables()...)
+	cmd := exec.CommandContext(ctx, Shell, args...)
+	cmd.Env = []string{}
+	cmd.Dir = workDir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to source answer file: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	fields := strings.Split(stdout.String(), "\x00")
+	vars := make(map[string]string)
+	for i := 0; i+2 < len(fields); i += 3 {
+		if fields[i+1] == "1" {
+			vars[fields[i]] = fields[i+2]
+		}
+	}
+	return vars, nil
+}
+
+// Expected returns the value setup-alpine should see for every answer
+// variable when installing the system described by cfg. The values are built
+// from the fields of cfg, not from a rendered template, so a template that
+// renders a field wrongly shows up as a mismatch.
+func Expected(cfg *config.Config) map[string]string {
+	userOpts := "-a -u "
+	if len(cfg.Groups) > 0 {
+		userOpts += "-g " + strings.Join(cfg.Groups, ",") + " "
+	}
+
+	iface := "iface " + cfg.NetworkIface + " inet dhcp\n"
+	if cfg.Address != "" {
+		iface = "iface " + cfg.NetworkIface + " inet static\n" +
+			"\taddress " + cfg.Address + "\n"
+		if cfg.Gateway != "" {
+			iface += "\tgateway " + cfg.Gateway + "\n"
+		}
+	}
+
+	vars := map[string]string{
+		"KEYMAPOPTS":   cfg.Keymap + " " + cfg.Keymap,
+		"HOSTNAMEOPTS": "-n " + cfg.Hostname,
+		"INTERFACESOPTS": "auto lo\n" +
+			"iface lo inet loopback\n" +
+			"\n" +
+			"auto " + cfg.NetworkIface + "\n" +
+			iface,
+		"TIMEZONEOPTS": "-z " + cfg.Timezone,
+		"PROXYOPTS":    "none",
+		"APKREPOSOPTS": "-f",
+		"SSHDOPTS":     "-c openssh",
+		"NTPOPTS":      "-c chrony",
+		"DISKOPTS":     "-m sys " + cfg.DiskDevice,
+		"USEROPTS":     userOpts + cfg.Username,
+		"PWUSER":       cfg.Password,
+	}
+	if len(cfg.DNS) > 0 {
+		vars["DNSOPTS"] = strings.Join(cfg.DNS, " ")
+	}
+	if cfg.SSHKey != "" {
+		vars["SSHKEY"] = cfg.SSHKey
+	}
+	return vars
+}
+
+// Variables returns the answer variables assigned in an answer file, read by
+// the parser without running the shell
+func Variables(answers []byte) (map[string]string, error) {
+	f, err := parser.Parse(bytes.NewReader(answers))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the rendered answer file: %w", err)
+	}
+	if _, err := f.Answers(); err != nil {
+		return nil, fmt.Errorf("rendered answer file is invalid: %w", err)
+	}
+
+	vars := make(map[string]string)
+	for _, name := range parser.KnownVariables() {
+		if v, ok := f.Lookup(name); ok {
+			vars[name] = v.Value
+		}
+	}
+	return vars, nil
+}
+
+// Only returns the variables of vars that are also set in keep. A custom
+// template sets only some of the answer variables, and only those are
+// compared.
+func Only(vars, keep map[string]string) map[string]string {
+	only := make(map[string]string)
+	for name, value := range vars {
+		if _, ok := keep[name]; ok {
+			only[name] = value
+		}
+	}
+	return only
+}
+
+// Mismatch is an answer variable whose sourced value differs from the
+// expected one. Set flags distinguish an unset variable from an empty one.
+type Mismatch struct {
+	Name    string
+	Want    string
+	WantSet bool
+	Got     string
+	GotSet  bool
+}
+
+// Compare returns every variable that differs between want and got, sorted by
+// name
+func Compare(want, got map[string]string) []Mismatch {
+	names := make(map[string]bool)
+	for name := range want {
+		names[name] = true
+	}
+	for name := range got {
+		names[name] = true
+	}
+
+	var mismatches []Mismatch
+	for name := range names {
+		w, wantSet := want[name]
+		g, gotSet := got[name]
+		if wantSet != gotSet || w != g {
+			mismatches = append(mismatches, Mismatch{Name: name, Want: w, WantSet: wantSet, Got: g, GotSet: gotSet})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].Name < mismatches[j].Name
+	})
+	return mismatches
+}
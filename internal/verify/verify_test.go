@@ -0,0 +1,221 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"github.com/btassone/alpine-hero/internal/generator"
+)
+
+func writeAnswers(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "answers")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSource(t *testing.T) {
+	if _, err := os.Stat(Shell); err != nil {
+		t.Skipf("%s is not available", Shell)
+	}
+
+	path := writeAnswers(t, `HOSTNAMEOPTS="-n test-host"
+PWUSER='it"s'
+DNSOPTS=""
+echo "output is ignored"
+SSHKEY="${HOME-unset}"
+`)
+
+	got, err := Source(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Source() error = %v", err)
+	}
+
+	want := map[string]string{
+		"HOSTNAMEOPTS": "-n test-host",
+		"PWUSER":       `it"s`,
+		"DNSOPTS":      "",
+		"SSHKEY":       "unset",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Source() = %q, want %q", got, want)
+	}
+}
+
+func TestSource_Errors(t *testing.T) {
+	if _, err := os.Stat(Shell); err != nil {
+		t.Skipf("%s is not available", Shell)
+	}
+
+	tests := []struct {
+		name        string
+		path        func(t *testing.T) string
+		errContains string
+	}{
+		{
+			name:        "missing file",
+			path:        func(t *testing.T) string { return filepath.Join(t.TempDir(), "missing") },
+			errContains: "cannot access answer file",
+		},
+		{
+			name:        "shell syntax error",
+			path:        func(t *testing.T) string { return writeAnswers(t, "PWUSER=\"unterminated\n") },
+			errContains: "failed to source answer file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Source(context.Background(), tt.path(t))
+			if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("Source() error = %v, want error containing %q", err, tt.errContains)
+			}
+		})
+	}
+}
+
+func TestExpected_MatchesTemplate(t *testing.T) {
+	if _, err := os.Stat(Shell); err != nil {
+		t.Skipf("%s is not available", Shell)
+	}
+
+	withKey := config.New()
+	withKey.SSHKey = "/home/alpine/.ssh/id_ed25519.pub"
+	withKey.Password = `pa"ss $HOME`
+	noGroups := config.New()
+	noGroups.Groups = nil
+	static := config.New()
+	static.Address = "10.20.0.50/24"
+	static.Gateway = "10.20.0.1"
+	static.DNS = []string{"10.20.0.1", "9.9.9.9"}
+
+	for name, cfg := range map[string]*config.Config{
+		"defaults":       config.New(),
+		"ssh key":        withKey,
+		"without groups": noGroups,
+		"static address": static,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := generator.New(cfg, "").Render(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Source(context.Background(), writeAnswers(t, buf.String()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mismatches := Compare(Expected(cfg), got); len(mismatches) > 0 {
+				t.Errorf("Compare() = %+v", mismatches)
+			}
+			if got["PWUSER"] != cfg.Password || got["HOSTNAMEOPTS"] != "-n "+cfg.Hostname {
+				t.Errorf("sourced PWUSER = %q and HOSTNAMEOPTS = %q, want the configured values", got["PWUSER"], got["HOSTNAMEOPTS"])
+			}
+		})
+	}
+}
+
+func TestExpected_TemplateBug(t *testing.T) {
+	if _, err := os.Stat(Shell); err != nil {
+		t.Skipf("%s is not available", Shell)
+	}
+
+	// a template that renders the hostname wrongly is caught, since the
+	// expected values come from the configuration
+	cfg := config.New()
+	cfg.Hostname = "web-01"
+	path := writeAnswers(t, "HOSTNAMEOPTS=\"-n web-1\"\nPWUSER=\""+cfg.Password+"\"\n")
+	got, err := Source(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Expected(cfg)
+	mismatches := Compare(Only(want, got), got)
+	expected := []Mismatch{{Name: "HOSTNAMEOPTS", Want: "-n web-01", WantSet: true, Got: "-n web-1", GotSet: true}}
+	if !reflect.DeepEqual(mismatches, expected) {
+		t.Errorf("Compare() = %+v, want %+v", mismatches, expected)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	tests := []struct {
+		name        string
+		answers     string
+		want        map[string]string
+		errContains string
+	}{
+		{
+			name: "custom template",
+			answers: `# a custom template
+HOSTNAMEOPTS="-n web-01"
+DNSOPTS="-d example.com 10.0.0.1"
+PWUSER='it"s'
+PWUSER="last wins"
+CUSTOM="not an answer variable"
+`,
+			want: map[string]string{
+				"HOSTNAMEOPTS": "-n web-01",
+				"DNSOPTS":      "-d example.com 10.0.0.1",
+				"PWUSER":       "last wins",
+			},
+		},
+		{
+			name:        "syntax error",
+			answers:     "PWUSER=\"unterminated\n",
+			errContains: "failed to parse",
+		},
+		{
+			name:        "invalid answers",
+			answers:     "HOSTNAMEOPTS=\"-n\"\n",
+			errContains: "does not contain a hostname",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Variables([]byte(tt.answers))
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("Variables() error = %v, want error containing %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Variables() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Variables() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	want := map[string]string{
+		"HOSTNAMEOPTS": "-n a",
+		"PWUSER":       "secret",
+		"DNSOPTS":      "",
+	}
+	got := map[string]string{
+		"HOSTNAMEOPTS": "-n b",
+		"PWUSER":       "secret",
+		"SSHKEY":       "",
+	}
+
+	expected := []Mismatch{
+		{Name: "DNSOPTS", WantSet: true},
+		{Name: "HOSTNAMEOPTS", Want: "-n a", WantSet: true, Got: "-n b", GotSet: true},
+		{Name: "SSHKEY", GotSet: true},
+	}
+	if mismatches := Compare(want, got); !reflect.DeepEqual(mismatches, expected) {
+		t.Errorf("Compare() = %+v, want %+v", mismatches, expected)
+	}
+}
@@ -0,0 +1,280 @@
+package wizard
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/btassone/alpine-hero/internal/config"
+	"golang.org/x/term"
+)
+
+// Timezones are offered as a selection list. Any other zone can be typed in.
+var Timezones = []string{
+	"UTC",
+	"Africa/Johannesburg",
+	"America/Chicago",
+	"America/Denver",
+	"America/Los_Angeles",
+	"America/New_York",
+	"America/Sao_Paulo",
+	"Asia/Kolkata",
+	"Asia/Shanghai",
+	"Asia/Singapore",
+	"Asia/Tokyo",
+	"Australia/Sydney",
+	"Europe/Amsterdam",
+	"Europe/Berlin",
+	"Europe/London",
+	"Europe/Madrid",
+	"Europe/Paris",
+	"Pacific/Auckland",
+}
+
+// Keymaps are the keyboard layouts offered as a selection list. Any other
+// layout known to setup-keymap can be typed in.
+var Keymaps = []string{
+	"us", "uk", "be", "br", "ch", "cz", "de", "dk", "es", "fi",
+	"fr", "hu", "it", "jp", "nl", "no", "pl", "pt", "ru", "se",
+}
+
+// field describes how to prompt for one config.Config field
+type field struct {
+	label    string
+	get      func(*config.Config) string
+	set      func(*config.Config, string)
+	validate func(string) error
+	// check validates a value against the answers given before it
+	check func(*config.Config, string) error
+	// skip leaves the field empty without asking when it does not apply
+	skip     func(*config.Config) bool
+	choices  []string
+	secret   bool
+	optional bool
+}
+
+var fields = []field{
+	{
+		label:    "Hostname",
+		get:      func(c *config.Config) string { return c.Hostname },
+		set:      func(c *config.Config, v string) { c.Hostname = v },
+		validate: config.ValidateHostname,
+	},
+	{
+		label:    "Username",
+		get:      func(c *config.Config) string { return c.Username },
+		set:      func(c *config.Config, v string) { c.Username = v },
+		validate: config.ValidateUsername,
+	},
+	{
+		label:    "Password",
+		get:      func(c *config.Config) string { return c.Password },
+		set:      func(c *config.Config, v string) { c.Password = v },
+		validate: config.ValidatePassword,
+		secret:   true,
+	},
+	{
+		label:   "Timezone",
+		get:     func(c *config.Config) string { return c.Timezone },
+		set:     func(c *config.Config, v string) { c.Timezone = v },
+		choices: Timezones,
+	},
+	{
+		label:   "Keyboard layout",
+		get:     func(c *config.Config) string { return c.Keymap },
+		set:     func(c *config.Config, v string) { c.Keymap = v },
+		choices: Keymaps,
+	},
+	{
+		label: "Network interface",
+		get:   func(c *config.Config) string { return c.NetworkIface },
+		set:   func(c *config.Config, v string) { c.NetworkIface = v },
+	},
+	{
+		label:    "Static address (CIDR)",
+		get:      func(c *config.Config) string { return c.Address },
+		set:      func(c *config.Config, v string) { c.Address = v },
+		validate: config.ValidateAddress,
+		optional: true,
+	},
+	{
+		label:    "Gateway",
+		get:      func(c *config.Config) string { return c.Gateway },
+		set:      func(c *config.Config, v string) { c.Gateway = v },
+		check:    func(c *config.Config, v string) error { return config.ValidateGateway(v, c.Address) },
+		skip:     func(c *config.Config) bool { return c.Address == "" },
+		optional: true,
+	},
+	{
+		label: "Nameservers (comma-separated)",
+		get:   func(c *config.Config) string { return strings.Join(c.DNS, ",") },
+		set:   func(c *config.Config, v string) { c.DNS = splitList(v) },
+		check: func(c *config.Config, v string) error { return config.ValidateDNS(splitList(v), c.Address) },
+		skip:  func(c *config.Config) bool { return c.Address == "" },
+	},
+	{
+		label:    "Disk device",
+		get:      func(c *config.Config) string { return c.DiskDevice },
+		set:      func(c *config.Config, v string) { c.DiskDevice = v },
+		validate: config.ValidateDiskDevice,
+	},
+	{
+		label:    "User groups (comma-separated)",
+		get:      func(c *config.Config) string { return strings.Join(c.Groups, ",") },
+		set:      func(c *config.Config, v string) { c.Groups = splitList(v) },
+		optional: true,
+	},
+	{
+		label:    "SSH public key file",
+		get:      func(c *config.Config) string { return c.SSHKey },
+		set:      func(c *config.Config, v string) { c.SSHKey = v },
+		validate: config.ValidateSSHKey,
+		optional: true,
+	},
+}
+
+// Wizard prompts for configuration values on a plain text stream
+type Wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+	// readSecret reads a secret answer without echoing it, nil if in is not
+	// a terminal
+	readSecret func() (string, error)
+}
+
+// New creates a Wizard reading answers from in and writing prompts to out.
+// Secrets typed on a terminal are not echoed.
+func New(in io.Reader, out io.Writer) *Wizard {
+	w := &Wizard{
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		w.readSecret = func() (string, error) {
+			b, err := term.ReadPassword(int(f.Fd()))
+			// the newline typed by the user was not echoed either
+			_, _ = fmt.Fprintln(w.out)
+			return string(b), err
+		}
+	}
+	return w
+}
+
+// Run prompts for every configuration field, offering the current value of
+// cfg as the default, and stores the answers in cfg. Each answer is validated
+// as soon as it is entered and asked for again if it is invalid.
+func (w *Wizard) Run(cfg *config.Config) error {
+	for _, f := range fields {
+		if f.skip != nil && f.skip(cfg) {
+			f.set(cfg, "")
+			continue
+		}
+		value, err := w.ask(f, cfg)
+		if err != nil {
+			return err
+		}
+		f.set(cfg, value)
+	}
+	return nil
+}
+
+// ask prompts for a single field until it gets a valid answer
+func (w *Wizard) ask(f field, cfg *config.Config) (string, error) {
+	def := f.get(cfg)
+	if len(f.choices) > 0 {
+		_, _ = fmt.Fprintf(w.out, "%s:\n", f.label)
+		for i, choice := range f.choices {
+			_, _ = fmt.Fprintf(w.out, "  %2d) %s\n", i+1, choice)
+		}
+	}
+
+	for {
+		w.prompt(f, def)
+		line, err := w.readLine(f)
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+			if errors.Is(err, io.EOF) {
+				return "", fmt.Errorf("unexpected end of input while reading %s", strings.ToLower(f.label))
+			}
+			return "", fmt.Errorf("failed to read answer: %w", err)
+		}
+
+		value := strings.TrimSpace(line)
+		if value == "" {
+			value = def
+		} else if f.optional && value == "-" {
+			value = ""
+		} else if n, err := strconv.Atoi(value); err == nil && len(f.choices) > 0 {
+			if n < 1 || n > len(f.choices) {
+				_, _ = fmt.Fprintf(w.out, "  Please choose a number between 1 and %d\n", len(f.choices))
+				continue
+			}
+			value = f.choices[n-1]
+		}
+
+		if err := f.validateValue(cfg, value); err != nil {
+			_, _ = fmt.Fprintf(w.out, "  Invalid value: %v\n", err)
+			continue
+		}
+		return value, nil
+	}
+}
+
+// readLine reads one answer for f, without echo for secrets on a terminal
+func (w *Wizard) readLine(f field) (string, error) {
+	if f.secret && w.readSecret != nil {
+		line, err := w.readSecret()
+		if err != nil {
+			return line, err
+		}
+		return line + "\n", nil
+	}
+	return w.in.ReadString('\n')
+}
+
+// validateValue runs the checks of f on value
+func (f field) validateValue(cfg *config.Config, value string) error {
+	if f.validate != nil {
+		if err := f.validate(value); err != nil {
+			return err
+		}
+	}
+	if f.check != nil {
+		return f.check(cfg, value)
+	}
+	return nil
+}
+
+func (w *Wizard) prompt(f field, def string) {
+	label := f.label
+	if len(f.choices) > 0 {
+		label = "Choose a number or enter a value"
+	}
+	if f.optional {
+		label += " (optional, - for none)"
+	}
+
+	shown := def
+	if f.secret && def != "" {
+		shown = config.Mask
+	}
+	if shown == "" {
+		_, _ = fmt.Fprintf(w.out, "%s: ", label)
+		return
+	}
+	_, _ = fmt.Fprintf(w.out, "%s [%s]: ", label, shown)
+}
+
+// splitList parses a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
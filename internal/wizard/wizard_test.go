@@ -0,0 +1,163 @@
+package wizard
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btassone/alpine-hero/internal/config"
+)
+
+func TestWizard_Run(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519.pub")
+	if err := os.WriteFile(keyPath, []byte("ssh-ed25519 AAAA test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    func(c *config.Config)
+		output  []string
+		wantErr string
+	}{
+		{
+			name:  "accept defaults",
+			input: strings.Repeat("\n", len(fields)),
+			want:  func(c *config.Config) {},
+		},
+		{
+			name:  "custom answers",
+			input: "pi-kitchen\nkitchen\ns3cret\n15\nde\nwlan0\n10.20.0.50/24\n10.20.0.1\n10.20.0.1, 2001:db8::53\n/dev/sda\nwheel, docker\n" + keyPath + "\n",
+			want: func(c *config.Config) {
+				c.Hostname = "pi-kitchen"
+				c.Username = "kitchen"
+				c.Password = "s3cret"
+				c.Timezone = "Europe/London"
+				c.Keymap = "de"
+				c.NetworkIface = "wlan0"
+				c.Address = "10.20.0.50/24"
+				c.Gateway = "10.20.0.1"
+				c.DNS = []string{"10.20.0.1", "2001:db8::53"}
+				c.DiskDevice = "/dev/sda"
+				c.Groups = []string{"wheel", "docker"}
+				c.SSHKey = keyPath
+			},
+			output: []string{"Hostname [alpinehost]: ", "Password [********]: ", "  15) Europe/London\n"},
+		},
+		{
+			name:  "value outside the list",
+			input: "\n\n\nAntarctica/Troll\n\n\n\n\n\n\n",
+			want:  func(c *config.Config) { c.Timezone = "Antarctica/Troll" },
+		},
+		{
+			name:  "invalid answers are asked again",
+			input: "\n\n\n99\n\n\n\n\n\n\n" + filepath.Join(t.TempDir(), "missing.pub") + "\n\n",
+			want:  func(c *config.Config) {},
+			output: []string{
+				"  Please choose a number between 1 and 18\n",
+				"  Invalid value: failed to read SSH key file",
+			},
+		},
+		{
+			name:  "optional values can be cleared",
+			input: "\n\n\n\n\n\n\n\n-\n\n",
+			want:  func(c *config.Config) { c.Groups = nil },
+		},
+		{
+			name:  "gateway and nameservers are checked against the address",
+			input: "\n\n\n\n\n\n10.20.0.300/24\n10.20.0.50/24\n10.30.0.1\n10.20.0.1\n\nrouter.lan\n10.20.0.1\n\n\n\n",
+			want: func(c *config.Config) {
+				c.Address = "10.20.0.50/24"
+				c.Gateway = "10.20.0.1"
+				c.DNS = []string{"10.20.0.1"}
+			},
+			output: []string{
+				`Invalid value: invalid address "10.20.0.300/24"`,
+				"Invalid value: gateway 10.30.0.1 is not in the subnet 10.20.0.0/24",
+				"Invalid value: static address 10.20.0.50/24 needs dns nameservers",
+				`Invalid value: invalid nameserver "router.lan"`,
+			},
+		},
+		{
+			name:    "input ends early",
+			input:   "pi-kitchen\n",
+			wantErr: "unexpected end of input while reading username",
+		},
+		{
+			name: "last answer without newline",
+			// the gateway and nameservers are not asked for without a
+			// static address
+			input: strings.Repeat("\n", len(fields)-3) + "-",
+			want:  func(c *config.Config) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.New()
+			var out strings.Builder
+			err := New(strings.NewReader(tt.input), &out).Run(cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Run() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run() error = %v\noutput:\n%s", err, out.String())
+			}
+
+			want := config.New()
+			tt.want(want)
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("Run() config = %+v, want %+v", cfg, want)
+			}
+			for _, s := range tt.output {
+				if !strings.Contains(out.String(), s) {
+					t.Errorf("output missing %q\ngot:\n%s", s, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestWizard_RejectsEmptyRequiredValues(t *testing.T) {
+	cfg := config.New()
+	cfg.Hostname = ""
+
+	var out strings.Builder
+	input := "\n" + "pi\n" + strings.Repeat("\n", len(fields)-1)
+	if err := New(strings.NewReader(input), &out).Run(cfg); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Hostname: ") || !strings.Contains(out.String(), "Invalid value: hostname cannot be empty") {
+		t.Errorf("output = %q, want the empty hostname rejected", out.String())
+	}
+	if cfg.Hostname != "pi" {
+		t.Errorf("Hostname = %q, want %q", cfg.Hostname, "pi")
+	}
+}
+
+func TestWizard_SecretsAreNotEchoed(t *testing.T) {
+	var out strings.Builder
+	w := New(strings.NewReader("pi\n\n"+strings.Repeat("\n", len(fields))), &out)
+	var asked int
+	w.readSecret = func() (string, error) {
+		asked++
+		return "s3cret", nil
+	}
+
+	cfg := config.New()
+	if err := w.Run(cfg); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if asked != 1 || cfg.Password != "s3cret" {
+		t.Errorf("password read %d times without echo as %q, want once as %q", asked, cfg.Password, "s3cret")
+	}
+	if cfg.Hostname != "pi" || cfg.Timezone != "UTC" {
+		t.Errorf("Run() config = %+v, want the other answers read from the input", cfg)
+	}
+}
@@ -0,0 +1,11 @@
+// Package templates holds the answer file template built into alpine-hero
+package templates
+
+import (
+	_ "embed"
+)
+
+// Answers is the default setup-alpine answer file template
+//
+//go:embed answers.tmpl
+var Answers string